@@ -0,0 +1,716 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/blob"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+)
+
+// the authenticated user's own account, includes the email
+type accountRes struct {
+    Id          string  `json:"id"`
+    CreatedAt   string  `json:"created_at"`
+    UpdatedAt   string  `json:"updated_at"`
+    Email       string  `json:"email"`
+    IsChirpyRed bool    `json:"is_chirpy_red"`
+    Handle      *string `json:"handle"`
+    DisplayName string  `json:"display_name"`
+    Bio         string  `json:"bio"`
+    AvatarURL   string  `json:"avatar_url"`
+}
+
+func toAccountRes(user database.User) accountRes {
+    res := accountRes{
+        Id: user.ID.String(),
+        CreatedAt: user.CreatedAt.String(),
+        UpdatedAt: user.UpdatedAt.String(),
+        Email: user.Email,
+        IsChirpyRed: user.IsChirpyRed,
+        DisplayName: user.DisplayName,
+        Bio: user.Bio,
+        AvatarURL: user.AvatarUrl,
+    }
+    if user.Handle.Valid {
+        res.Handle = &user.Handle.String
+    }
+    return res
+}
+
+// partial update of the authenticated user
+// changing email or password requires the current password,
+// a new password revokes the refresh tokens of every other session
+func (cfg *apiConfig) patch_user(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    type parameters struct {
+        Email           *string `json:"email"`
+        Password        *string `json:"password"`
+        CurrentPassword string  `json:"current_password"`
+        // refresh token of the session making the change, kept on password change
+        RefreshToken    string  `json:"refresh_token"`
+        profileParams
+    }
+
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+
+    v := validate.Validator{}
+    if params.Email != nil {
+        v.Email("email", *params.Email)
+    }
+    if params.Password != nil {
+        v.Password("password", *params.Password)
+    }
+    params.profileParams.check(&v)
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error, couldn't find user to update", "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+
+    changeEmail := params.Email != nil && *params.Email != user.Email
+    changePassword := params.Password != nil
+    if changeEmail || changePassword {
+        if params.CurrentPassword == "" {
+            v.Add("current_password", validate.CodeRequired, "Current password is required")
+        }
+        if !checkValid(w, r, &v) {
+            return
+        }
+        if err := cfg.checkPassword(r.Context(), user.HashedPassword, params.CurrentPassword); err != nil {
+            slog.WarnContext(r.Context(), "Wrong current password for user", "user_id", userID)
+            if changePassword {
+                cfg.recordAudit(r, audit.Event{
+                    Type: audit.PasswordChanged,
+                    ActorID: userID,
+                    TargetType: "user",
+                    TargetID: userID.String(),
+                    Outcome: audit.Failure,
+                    Detail: "wrong current password",
+                })
+            }
+            respondError(w, r, 401, codeInvalidCredentials, "Incorrect password")
+            return
+        }
+    }
+
+    updateUserParams := database.UpdateUserParams{
+        ID: userID,
+        Email: user.Email,
+        HashedPassword: user.HashedPassword,
+    }
+    if changeEmail {
+        updateUserParams.Email = *params.Email
+    }
+    if changePassword {
+        hashedPassw, err := cfg.hashPassword(r.Context(), *params.Password)
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error hashing the user's password", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+        updateUserParams.HashedPassword = hashedPassw
+    }
+
+    var profile database.UpdateUserProfileParams
+    if !params.profileParams.isEmpty() {
+        profile = mergeProfile(user, params.profileParams)
+    }
+
+    // every change is applied or none is
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error starting transaction", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    defer tx.Rollback()
+    qtx := cfg.txQueries(tx)
+
+    if changeEmail || changePassword {
+        err = qtx.UpdateUser(r.Context(), updateUserParams)
+        if isUniqueViolation(err) {
+            respondError(w, r, 409, codeEmailTaken, "Email is already in use")
+            return
+        }
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error updating user in db", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+    }
+
+    if !params.profileParams.isEmpty() {
+        _, err = qtx.UpdateUserProfile(r.Context(), profile)
+        if isUniqueViolation(err) {
+            respondError(w, r, 409, codeHandleTaken, "Handle is already taken")
+            return
+        }
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error updating user profile in db", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+    }
+
+    if changePassword {
+        err = qtx.RevokeUserRTokensExcept(r.Context(), database.RevokeUserRTokensExceptParams{
+            UserID: userID,
+            Token: params.RefreshToken,
+        })
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error revoking refresh tokens", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+    }
+
+    updated, err := qtx.GetUserByID(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error, couldn't find user after update", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    if err := tx.Commit(); err != nil {
+        slog.ErrorContext(r.Context(), "Error committing user update", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if changePassword {
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.PasswordChanged,
+            ActorID: userID,
+            TargetType: "user",
+            TargetID: userID.String(),
+            Outcome: audit.Success,
+            Detail: "other sessions revoked",
+        })
+    }
+
+    respondJSON(w, r, 200, toAccountRes(updated))
+}
+
+// deleted accounts are purged after this grace period
+const accountGracePeriod = time.Hour * 24 * 30
+
+// delete the authenticated user, requires the password again
+// the account is disabled right away and purged after the grace period
+func (cfg *apiConfig) delete_user_me(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    type parameters struct {
+        Password string `json:"password"`
+    }
+
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    v.Required("password", params.Password)
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error, couldn't find user to delete", "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+    if err := cfg.checkPassword(r.Context(), user.HashedPassword, params.Password); err != nil {
+        slog.WarnContext(r.Context(), "Wrong password deleting user", "user_id", userID)
+        respondError(w, r, 401, codeInvalidCredentials, "Incorrect password")
+        return
+    }
+
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error starting transaction", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    defer tx.Rollback()
+    qtx := cfg.txQueries(tx)
+
+    if err := qtx.SoftDeleteUser(r.Context(), userID); err != nil {
+        slog.ErrorContext(r.Context(), "Error deleting user", "user_id", userID, "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    // log out every session
+    if err := qtx.RevokeUserRTokens(r.Context(), userID); err != nil {
+        slog.ErrorContext(r.Context(), "Error revoking refresh tokens", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if err := tx.Commit(); err != nil {
+        slog.ErrorContext(r.Context(), "Error committing user deletion", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    slog.InfoContext(r.Context(), "User deleted", "user_id", userID, "purge_after", accountGracePeriod)
+
+    type deleteRes struct {
+        PurgeAfter string `json:"purge_after"`
+    }
+    respondJSON(w, r, 202, deleteRes{
+        PurgeAfter: time.Now().Add(accountGracePeriod).UTC().Format(time.RFC3339),
+    })
+}
+
+// hard delete accounts whose grace period is over,
+// chirps, tokens and the rest cascade
+// their media blobs are deleted first, the cascade would leave them on disk
+func (cfg *apiConfig) purgeDeletedUsers(ctx context.Context) {
+    deletedBefore := sql.NullTime{
+        Time: time.Now().Add(-accountGracePeriod),
+        Valid: true,
+    }
+    media, err := cfg.dbQueries.GetMediaFilesOfDeletedUsers(ctx, deletedBefore)
+    if err != nil {
+        slog.ErrorContext(ctx, "Error getting media of deleted users", "err", err)
+        return
+    }
+    // try again on the next run rather than lose track of a blob
+    if cfg.deleteMediaFiles(ctx, media) < len(media) {
+        slog.ErrorContext(ctx, "Couldn't delete every media file of deleted users, not purging them yet")
+        return
+    }
+
+    purged, err := cfg.dbQueries.PurgeDeletedUsers(ctx, deletedBefore)
+    if err != nil {
+        slog.ErrorContext(ctx, "Error purging deleted users", "err", err)
+        return
+    }
+    if purged > 0 {
+        slog.InfoContext(ctx, "Purged deleted users", "count", purged)
+    }
+}
+
+type exportChirp struct {
+    Id        string `json:"id"`
+    CreatedAt string `json:"created_at"`
+    UpdatedAt string `json:"updated_at"`
+    Body      string `json:"body"`
+    RepostOf  string `json:"repost_of,omitempty"`
+    QuoteOf   string `json:"quote_of,omitempty"`
+    InReplyTo string `json:"in_reply_to,omitempty"`
+    PublishAt string `json:"publish_at,omitempty"`
+}
+
+// refresh tokens are never exported, only when they were used
+type exportSession struct {
+    CreatedAt string  `json:"created_at"`
+    UpdatedAt string  `json:"updated_at"`
+    ExpiresAt string  `json:"expires_at"`
+    RevokedAt *string `json:"revoked_at"`
+}
+
+type exportSubscriptionEvent struct {
+    CreatedAt string `json:"created_at"`
+    Event     string `json:"event"`
+}
+
+type exportSubscription struct {
+    IsChirpyRed bool                      `json:"is_chirpy_red"`
+    History     []exportSubscriptionEvent `json:"history"`
+}
+
+type exportRemoteFollower struct {
+    ActorID   string `json:"actor_id"`
+    CreatedAt string `json:"created_at"`
+}
+
+// uploads, the zip export has the files themselves under media/
+type exportMedia struct {
+    Id          string `json:"id"`
+    CreatedAt   string `json:"created_at"`
+    ContentType string `json:"content_type"`
+    SizeBytes   int64  `json:"size_bytes"`
+    Width       int32  `json:"width,omitempty"`
+    Height      int32  `json:"height,omitempty"`
+    Status      string `json:"status"`
+    File        string `json:"file"`
+}
+
+// a bookmarked or liked chirp
+type exportChirpRef struct {
+    ChirpID   string `json:"chirp_id"`
+    CreatedAt string `json:"created_at"`
+}
+
+// a blocked or muted user
+type exportHiddenUser struct {
+    UserID    string `json:"user_id"`
+    CreatedAt string `json:"created_at"`
+}
+
+type exportNotification struct {
+    Id        string  `json:"id"`
+    CreatedAt string  `json:"created_at"`
+    Type      string  `json:"type"`
+    ActorID   string  `json:"actor_id,omitempty"`
+    ChirpID   string  `json:"chirp_id,omitempty"`
+    ReadAt    *string `json:"read_at"`
+}
+
+// reports filed are left out, they belong to the moderation trail,
+// and so are the audit log entries
+type userExport struct {
+    ExportedAt              string                 `json:"exported_at"`
+    Profile                 accountRes             `json:"profile"`
+    Chirps                  []exportChirp          `json:"chirps"`
+    Drafts                  []exportChirp          `json:"drafts"`
+    Media                   []exportMedia          `json:"media"`
+    Bookmarks               []exportChirpRef       `json:"bookmarks"`
+    Likes                   []exportChirpRef       `json:"likes"`
+    Blocks                  []exportHiddenUser     `json:"blocks"`
+    Mutes                   []exportHiddenUser     `json:"mutes"`
+    Notifications           []exportNotification   `json:"notifications"`
+    Sessions                []exportSession        `json:"sessions"`
+    Subscription            exportSubscription     `json:"subscription"`
+    NotificationPreferences map[string]bool        `json:"notification_preferences"`
+    RemoteFollowers         []exportRemoteFollower `json:"remote_followers"`
+}
+
+// the sessions of a user, also shown to admins
+func (cfg *apiConfig) userSessions(ctx context.Context, userID uuid.UUID) ([]exportSession, error) {
+    sessions := []exportSession{}
+    tokens, err := cfg.dbQueries.GetRTokensFromUser(ctx, userID)
+    if err != nil {
+        return sessions, err
+    }
+    for _, t := range tokens {
+        session := exportSession{
+            CreatedAt: t.CreatedAt.String(),
+            UpdatedAt: t.UpdatedAt.String(),
+            ExpiresAt: t.ExpiresAt.String(),
+        }
+        if t.RevokedAt.Valid {
+            revoked := t.RevokedAt.Time.String()
+            session.RevokedAt = &revoked
+        }
+        sessions = append(sessions, session)
+    }
+    return sessions, nil
+}
+
+func (cfg *apiConfig) userSubscription(ctx context.Context, user database.User) (exportSubscription, error) {
+    sub := exportSubscription{
+        IsChirpyRed: user.IsChirpyRed,
+        History: []exportSubscriptionEvent{},
+    }
+    events, err := cfg.dbQueries.GetSubscriptionEvents(ctx, user.ID)
+    if err != nil {
+        return sub, err
+    }
+    for _, e := range events {
+        sub.History = append(sub.History, exportSubscriptionEvent{
+            CreatedAt: e.CreatedAt.String(),
+            Event: e.Event,
+        })
+    }
+    return sub, nil
+}
+
+func (cfg *apiConfig) buildUserExport(ctx context.Context, user database.User) (userExport, error) {
+    export := userExport{
+        ExportedAt: time.Now().UTC().Format(time.RFC3339),
+        Profile: toAccountRes(user),
+        Chirps: []exportChirp{},
+        Drafts: []exportChirp{},
+        Media: []exportMedia{},
+        Bookmarks: []exportChirpRef{},
+        Likes: []exportChirpRef{},
+        Blocks: []exportHiddenUser{},
+        Mutes: []exportHiddenUser{},
+        Notifications: []exportNotification{},
+        RemoteFollowers: []exportRemoteFollower{},
+    }
+
+    // scheduled chirps too, they are the user's data already
+    chirps, err := cfg.dbQueries.GetAllChirpsFromUser(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, c := range chirps {
+        ec := exportChirp{
+            Id: c.ID.String(),
+            CreatedAt: c.CreatedAt.String(),
+            UpdatedAt: c.UpdatedAt.String(),
+            Body: c.Body,
+        }
+        if c.RepostOf.Valid {
+            ec.RepostOf = c.RepostOf.UUID.String()
+        }
+        if c.QuoteOf.Valid {
+            ec.QuoteOf = c.QuoteOf.UUID.String()
+        }
+        if c.InReplyTo.Valid {
+            ec.InReplyTo = c.InReplyTo.UUID.String()
+        }
+        if c.PublishAt.Valid {
+            ec.PublishAt = c.PublishAt.Time.String()
+        }
+        export.Chirps = append(export.Chirps, ec)
+    }
+
+    drafts, err := cfg.dbQueries.GetDraftsFromUser(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, d := range drafts {
+        export.Drafts = append(export.Drafts, exportChirp{
+            Id: d.ID.String(),
+            CreatedAt: d.CreatedAt.String(),
+            UpdatedAt: d.UpdatedAt.String(),
+            Body: d.Body,
+        })
+    }
+
+    media, err := cfg.dbQueries.GetMediaFilesFromUser(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, m := range media {
+        export.Media = append(export.Media, exportMedia{
+            Id: m.ID.String(),
+            CreatedAt: m.CreatedAt.String(),
+            ContentType: m.ContentType,
+            SizeBytes: m.SizeBytes,
+            Width: m.Width,
+            Height: m.Height,
+            Status: m.Status,
+            File: exportMediaDir + m.BlobKey,
+        })
+    }
+
+    bookmarks, err := cfg.dbQueries.GetAllBookmarksFromUser(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, b := range bookmarks {
+        export.Bookmarks = append(export.Bookmarks, exportChirpRef{
+            ChirpID: b.ChirpID.String(),
+            CreatedAt: b.CreatedAt.String(),
+        })
+    }
+
+    likes, err := cfg.dbQueries.GetAllLikesFromUser(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, l := range likes {
+        export.Likes = append(export.Likes, exportChirpRef{
+            ChirpID: l.ChirpID.String(),
+            CreatedAt: l.CreatedAt.String(),
+        })
+    }
+
+    blocks, err := cfg.dbQueries.GetBlocks(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, b := range blocks {
+        export.Blocks = append(export.Blocks, exportHiddenUser{
+            UserID: b.BlockedID.String(),
+            CreatedAt: b.CreatedAt.String(),
+        })
+    }
+
+    mutes, err := cfg.dbQueries.GetMutes(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, m := range mutes {
+        export.Mutes = append(export.Mutes, exportHiddenUser{
+            UserID: m.MutedID.String(),
+            CreatedAt: m.CreatedAt.String(),
+        })
+    }
+
+    notifications, err := cfg.dbQueries.GetAllNotificationsFromUser(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, n := range notifications {
+        en := exportNotification{
+            Id: n.ID.String(),
+            CreatedAt: n.CreatedAt.String(),
+            Type: n.Type,
+        }
+        if n.ActorID.Valid {
+            en.ActorID = n.ActorID.UUID.String()
+        }
+        if n.ChirpID.Valid {
+            en.ChirpID = n.ChirpID.UUID.String()
+        }
+        if n.ReadAt.Valid {
+            read := n.ReadAt.Time.String()
+            en.ReadAt = &read
+        }
+        export.Notifications = append(export.Notifications, en)
+    }
+
+    export.Sessions, err = cfg.userSessions(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+
+    export.Subscription, err = cfg.userSubscription(ctx, user)
+    if err != nil {
+        return export, err
+    }
+
+    export.NotificationPreferences, err = cfg.notificationPreferences(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+
+    followers, err := cfg.dbQueries.GetRemoteFollowers(ctx, user.ID)
+    if err != nil {
+        return export, err
+    }
+    for _, f := range followers {
+        export.RemoteFollowers = append(export.RemoteFollowers, exportRemoteFollower{
+            ActorID: f.ActorID,
+            CreatedAt: f.CreatedAt.String(),
+        })
+    }
+
+    return export, nil
+}
+
+// every piece of data Chirpy has about the authenticated user
+// json by default, "format=zip" for a zip with a file per section
+func (cfg *apiConfig) export_user_me(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error, couldn't find user to export", "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+
+    export, err := cfg.buildUserExport(r.Context(), user)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error exporting user", "user_id", userID, "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    filename := "chirpy-export-" + user.ID.String()
+    if r.URL.Query().Get("format") != "zip" {
+        w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+        respondJSON(w, r, 200, export)
+        return
+    }
+
+    files := []struct {
+        name string
+        data any
+    }{
+        {"profile.json", export.Profile},
+        {"chirps.json", export.Chirps},
+        {"drafts.json", export.Drafts},
+        {"media.json", export.Media},
+        {"bookmarks.json", export.Bookmarks},
+        {"likes.json", export.Likes},
+        {"blocks.json", export.Blocks},
+        {"mutes.json", export.Mutes},
+        {"notifications.json", export.Notifications},
+        {"sessions.json", export.Sessions},
+        {"subscription.json", export.Subscription},
+        {"notification_preferences.json", export.NotificationPreferences},
+        {"remote_followers.json", export.RemoteFollowers},
+    }
+
+    // streamed as it's written, past the headers an error can only cut it short
+    w.Header().Set("Content-Type", "application/zip")
+    w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+    w.WriteHeader(200)
+    zw := zip.NewWriter(w)
+    for _, f := range files {
+        fw, err := zw.Create(filename + "/" + f.name)
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error creating export zip", "err", err)
+            return
+        }
+        encoder := json.NewEncoder(fw)
+        encoder.SetIndent("", "  ")
+        if err := encoder.Encode(f.data); err != nil {
+            slog.ErrorContext(r.Context(), "Error writing export zip", "err", err)
+            return
+        }
+    }
+    // the uploaded files, a failed upload has none left
+    for _, m := range export.Media {
+        if err := cfg.addExportFile(r.Context(), zw, filename+"/"+m.File, strings.TrimPrefix(m.File, exportMediaDir)); err != nil {
+            slog.ErrorContext(r.Context(), "Error adding media to export zip", "media_id", m.Id, "err", err)
+            return
+        }
+    }
+    if err := zw.Close(); err != nil {
+        slog.ErrorContext(r.Context(), "Error closing export zip", "err", err)
+    }
+}
+
+// directory of the uploaded files in the zip export
+const exportMediaDir = "media/"
+
+// copy the blob under key into the zip as name, nothing when it's gone
+func (cfg *apiConfig) addExportFile(ctx context.Context, zw *zip.Writer, name, key string) error {
+    f, err := cfg.media.Open(ctx, key)
+    if errors.Is(err, blob.ErrNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    fw, err := zw.Create(name)
+    if err != nil {
+        return err
+    }
+    _, err = io.Copy(fw, f)
+    return err
+}
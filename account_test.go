@@ -0,0 +1,293 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const testPassword = "correct horse battery staple"
+
+// a user with testPassword as the password
+func testUserWithPassword(t *testing.T, fake *fakeDB) database.User {
+    t.Helper()
+    hash, err := auth.HahsPassword(testPassword)
+    if err != nil {
+        t.Fatalf("Couldn't hash password: %v", err)
+    }
+    user := testUser(fake, "user")
+    user.HashedPassword = hash
+    fake.addUser(user)
+    return user
+}
+
+func TestPatchUserCurrentPassword(t *testing.T) {
+    tests := []struct {
+        name    string
+        // "{email}" is replaced by the user's own email
+        body    string
+        taken   bool
+        status  int
+        code    string
+        // the credentials are written
+        updated bool
+        // the password changed, other sessions are revoked
+        revoked bool
+        audit   []string
+    }{
+        {name: "email without the current password", body: `{"email": "new@example.com"}`, status: 422, code: codeValidation},
+        {name: "password without the current password", body: `{"password": "a new long password 42"}`, status: 422, code: codeValidation},
+        {name: "wrong current password for the email", body: `{"email": "new@example.com", "current_password": "nope"}`,
+            status: 401, code: codeInvalidCredentials},
+        {name: "wrong current password for the password", body: `{"password": "a new long password 42", "current_password": "nope"}`,
+            status: 401, code: codeInvalidCredentials, audit: []string{audit.Failure}},
+        {name: "same email needs no password", body: `{"email": "{email}", "display_name": "Alice"}`, status: 200},
+        {name: "email", body: `{"email": "new@example.com", "current_password": "` + testPassword + `"}`, status: 200, updated: true},
+        {name: "email taken", body: `{"email": "taken@example.com", "current_password": "` + testPassword + `"}`,
+            taken: true, status: 409, code: codeEmailTaken},
+        {name: "password", body: `{"password": "a new long password 42", "current_password": "` + testPassword + `", "refresh_token": "this-session"}`,
+            status: 200, updated: true, revoked: true, audit: []string{audit.Success}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUserWithPassword(t, fake)
+            fake.on("UpdateUser", func(args []any) (any, error) {
+                if tt.taken {
+                    return nil, &pq.Error{Code: "23505"}
+                }
+                return nil, nil
+            })
+            fake.answer("UpdateUserProfile", user)
+
+            body := strings.ReplaceAll(tt.body, "{email}", user.Email)
+            rec := serve(t, "PATCH /api/users/me", http.HandlerFunc(cfg.patch_user), "/api/users/me", testToken(t, user.ID, time.Hour), body)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            if tt.code != "" {
+                if code := errorCode(t, rec); code != tt.code {
+                    t.Errorf("Got code %q, want %q", code, tt.code)
+                }
+            }
+
+            updates := fake.called("UpdateUser")
+            if tt.updated != (len(updates) == 1 && !tt.taken) {
+                t.Errorf("Got credential updates %v", updates)
+            }
+            if tt.updated && tt.revoked {
+                if updates[0].args[2] == user.HashedPassword {
+                    t.Errorf("The password hash didn't change")
+                }
+            } else if tt.updated && updates[0].args[2] != user.HashedPassword {
+                t.Errorf("The password hash changed")
+            }
+
+            revoked := fake.called("RevokeUserRTokensExcept")
+            if tt.revoked && (len(revoked) != 1 || revoked[0].args[0] != user.ID || revoked[0].args[1] != "this-session") {
+                t.Errorf("Got revocations %v", revoked)
+            }
+            if !tt.revoked && len(revoked) != 0 {
+                t.Errorf("Revoked sessions: %v", revoked)
+            }
+
+            if got := fake.audited(audit.PasswordChanged); len(got) != len(tt.audit) || (len(got) == 1 && got[0] != tt.audit[0]) {
+                t.Errorf("Got password audit %v, want %v", got, tt.audit)
+            }
+        })
+    }
+}
+
+// the deprecated PUT keeps its old contract and says so
+func TestPutUserDeprecated(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUserWithPassword(t, fake)
+    fake.answer("UpdateUserProfile", user)
+
+    body := `{"email": "new@example.com", "password": "a new long password 42"}`
+    rec := serve(t, "PUT /api/users", http.HandlerFunc(cfg.update_user), "/api/users", testToken(t, user.ID, time.Hour), body)
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    if rec.Header().Get("Deprecation") != "true" || !strings.Contains(rec.Header().Get("Link"), `rel="successor-version"`) {
+        t.Errorf("Got headers %v", rec.Header())
+    }
+
+    updates := fake.called("UpdateUser")
+    if len(updates) != 1 || updates[0].args[1] != "new@example.com" || updates[0].args[2] == user.HashedPassword {
+        t.Errorf("Got credential updates %v", updates)
+    }
+    if revoked := fake.called("RevokeUserRTokensExcept"); len(revoked) != 0 {
+        t.Errorf("Revoked sessions: %v", revoked)
+    }
+}
+
+func TestDeleteUserMe(t *testing.T) {
+    tests := []struct {
+        name    string
+        body    string
+        status  int
+        deleted bool
+    }{
+        {name: "no password", body: `{}`, status: 422},
+        {name: "wrong password", body: `{"password": "nope"}`, status: 401},
+        {name: "password", body: `{"password": "` + testPassword + `"}`, status: 202, deleted: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUserWithPassword(t, fake)
+            fake.on("SoftDeleteUser", func(args []any) (any, error) {
+                user.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+                fake.addUser(user)
+                return nil, nil
+            })
+            token := testToken(t, user.ID, time.Hour)
+
+            rec := serve(t, "DELETE /api/users/me", http.HandlerFunc(cfg.delete_user_me), "/api/users/me", token, tt.body)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            if !tt.deleted {
+                if calls := fake.called("SoftDeleteUser"); len(calls) != 0 {
+                    t.Errorf("Deleted the user: %v", calls)
+                }
+                return
+            }
+
+            // every session is logged out, none is kept
+            revoked := fake.called("RevokeUserRTokens")
+            if len(revoked) != 1 || revoked[0].args[0] != user.ID {
+                t.Errorf("Got revocations %v", revoked)
+            }
+            // and the access token left stops working
+            rec = serve(t, "GET /api/users/me/export", http.HandlerFunc(cfg.export_user_me), "/api/users/me/export", token, "")
+            if rec.Code != 401 {
+                t.Errorf("The export of a deleted user got status %d", rec.Code)
+            }
+        })
+    }
+}
+
+func TestExportUserMe(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    now := time.Now().UTC()
+    published := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: user.ID}
+    scheduled := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "later", UserID: user.ID,
+        PublishAt: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}
+    fake.answer("GetAllChirpsFromUser", []database.Chirp{published, scheduled})
+    fake.answer("GetDraftsFromUser", []database.Draft{{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID, Body: "unsent"}})
+    fake.answer("GetRTokensFromUser", []database.RefreshToken{
+        {Token: "secret-refresh-token", CreatedAt: now, UpdatedAt: now, UserID: user.ID, ExpiresAt: now.Add(time.Hour)},
+    })
+    fake.answer("GetRemoteFollowers", []database.RemoteFollower{
+        {UserID: user.ID, ActorID: "https://social.example/users/alice", CreatedAt: now},
+    })
+    media := testMedia(t, cfg, fake, user.ID, mediaReady)
+    fake.answer("GetMediaFilesFromUser", []database.MediaFile{media})
+    fake.answer("GetAllBookmarksFromUser", []database.Bookmark{{UserID: user.ID, ChirpID: uuid.New(), CreatedAt: now}})
+    fake.answer("GetBlocks", []database.Block{{BlockerID: user.ID, BlockedID: uuid.New(), CreatedAt: now}})
+    fake.answer("GetMutes", []database.Mute{{MuterID: user.ID, MutedID: uuid.New(), CreatedAt: now}})
+    fake.answer("GetAllNotificationsFromUser", []database.Notification{{ID: uuid.New(), CreatedAt: now, UserID: user.ID,
+        Type: "follow", ReadAt: sql.NullTime{Time: now, Valid: true}}})
+    token := testToken(t, user.ID, time.Hour)
+
+    rec := serve(t, "GET /api/users/me/export", http.HandlerFunc(cfg.export_user_me), "/api/users/me/export", token, "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    if strings.Contains(rec.Body.String(), "secret-refresh-token") {
+        t.Errorf("The export has a refresh token")
+    }
+    export := userExport{}
+    json.Unmarshal(rec.Body.Bytes(), &export)
+    if export.Profile.Email != user.Email || len(export.Drafts) != 1 || len(export.Sessions) != 1 || len(export.RemoteFollowers) != 1 {
+        t.Errorf("Got export %+v", export)
+    }
+    if len(export.Media) != 1 || len(export.Bookmarks) != 1 || len(export.Blocks) != 1 || len(export.Mutes) != 1 ||
+        len(export.Notifications) != 1 || export.Notifications[0].ReadAt == nil {
+        t.Errorf("Got export %+v", export)
+    }
+    // scheduled chirps are the user's data too
+    if len(export.Chirps) != 2 || export.Chirps[0].PublishAt != "" || export.Chirps[1].PublishAt == "" {
+        t.Errorf("Got chirps %+v", export.Chirps)
+    }
+    if calls := fake.called("GetAllChirpsFromUser"); len(calls) != 1 || calls[0].args[0] != user.ID {
+        t.Errorf("Got queries %v", calls)
+    }
+
+    rec = serve(t, "GET /api/users/me/export", http.HandlerFunc(cfg.export_user_me), "/api/users/me/export?format=zip", token, "")
+    if rec.Code != 200 || rec.Header().Get("Content-Type") != "application/zip" {
+        t.Fatalf("Got status %d, %s", rec.Code, rec.Header().Get("Content-Type"))
+    }
+    zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+    if err != nil {
+        t.Fatalf("Couldn't read zip: %v", err)
+    }
+    files := map[string]bool{}
+    for _, f := range zr.File {
+        files[path.Base(f.Name)] = true
+    }
+    for _, name := range []string{"profile.json", "chirps.json", "drafts.json", "media.json", "bookmarks.json", "blocks.json",
+        "mutes.json", "notifications.json", "sessions.json", "remote_followers.json", media.BlobKey} {
+        if !files[name] {
+            t.Errorf("No %s in the zip, got %v", name, files)
+        }
+    }
+}
+
+func TestUpgradeUser(t *testing.T) {
+    tests := []struct {
+        name     string
+        // rows the update touches, 0 for unknown or deleted users
+        rows     int64
+        status   int
+        outcome  string
+        notified bool
+    }{
+        {name: "user", rows: 1, status: 204, outcome: audit.Success, notified: true},
+        {name: "unknown or deleted user", rows: 0, status: 404, outcome: audit.Failure},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            cfg.polka_key = "polka"
+            fake.answer("UpgradeUser", tt.rows)
+            userID := uuid.New()
+
+            body := `{"event": "user.upgraded", "data": {"user_id": "` + userID.String() + `"}}`
+            req := httptest.NewRequest("POST", "/api/polka/webhooks", strings.NewReader(body))
+            req.Header.Set("Authorization", "ApiKey polka")
+            rec := httptest.NewRecorder()
+            cfg.upgrade_user(rec, req)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+
+            if got := fake.audited(audit.SubscriptionChanged); len(got) != 1 || got[0] != tt.outcome {
+                t.Errorf("Got subscription audit %v, want %s", got, tt.outcome)
+            }
+            if notified := fake.called("CreateNotification"); (len(notified) == 1) != tt.notified {
+                t.Errorf("Got notifications %v", notified)
+            }
+            if events := fake.called("CreateSubscriptionEvent"); (len(events) == 1) != tt.notified {
+                t.Errorf("Got subscription events %v", events)
+            }
+        })
+    }
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+)
+
+// how long a forced password reset token can be used
+const passwordResetTTL = 24 * time.Hour
+
+// authenticatedUser's error for users with a pending forced reset
+var errPasswordResetRequired = errors.New("password reset required")
+
+// a forced reset only holds while its token can be used,
+// once it expires the old password works again
+func passwordResetPending(user database.User) bool {
+    return user.PasswordResetHash != "" &&
+        user.PasswordResetExpiresAt.Valid && user.PasswordResetExpiresAt.Time.After(time.Now())
+}
+
+// an account as admins see it
+type adminUserRes struct {
+    accountRes
+    Role                  string     `json:"role"`
+    SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+    SuspensionReason      string     `json:"suspension_reason,omitempty"`
+    DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+    PasswordResetRequired bool       `json:"password_reset_required"`
+}
+
+func toAdminUserRes(user database.User) adminUserRes {
+    res := adminUserRes{
+        accountRes: toAccountRes(user),
+        Role: user.Role,
+        SuspensionReason: user.SuspensionReason,
+        PasswordResetRequired: passwordResetPending(user),
+    }
+    if user.SuspendedAt.Valid {
+        res.SuspendedAt = &user.SuspendedAt.Time
+    }
+    if user.DeletedAt.Valid {
+        res.DeletedAt = &user.DeletedAt.Time
+    }
+    return res
+}
+
+// the user of the {userID} path value, deleted users are not found
+func (cfg *apiConfig) adminTarget(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return database.User{}, false
+    }
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        slog.InfoContext(r.Context(), "User to manage not found", "err", err)
+        respondStatus(w, r, 404)
+        return database.User{}, false
+    }
+    return user, true
+}
+
+// the token is only ever shown to the admin, its hash is stored
+func hashResetToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// users whose email or handle contain query "q", deleted users included
+// optional query "limit"
+func (cfg *apiConfig) search_users(w http.ResponseWriter, r *http.Request) {
+    limit, ok := queryLimit(r)
+    if !ok {
+        respondStatus(w, r, 400)
+        return
+    }
+
+    // q is matched literally
+    q := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(r.URL.Query().Get("q"))
+    users, err := cfg.dbQueries.SearchUsers(r.Context(), database.SearchUsersParams{
+        Pattern: "%" + q + "%",
+        RowLimit: limit,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error searching users", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    res := []adminUserRes{}
+    for _, user := range users {
+        res = append(res, toAdminUserRes(user))
+    }
+    respondJSON(w, r, 200, res)
+}
+
+// an account with its sessions and subscription state
+func (cfg *apiConfig) get_admin_user(w http.ResponseWriter, r *http.Request) {
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    user, err := cfg.dbQueries.GetAnyUserByID(r.Context(), userID)
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    type userDetailRes struct {
+        adminUserRes
+        Sessions     []exportSession    `json:"sessions"`
+        Subscription exportSubscription `json:"subscription"`
+    }
+    res := userDetailRes{
+        adminUserRes: toAdminUserRes(user),
+    }
+
+    res.Sessions, err = cfg.userSessions(r.Context(), user.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting sessions of user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    res.Subscription, err = cfg.userSubscription(r.Context(), user)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting subscription of user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    respondJSON(w, r, 200, res)
+}
+
+// log the user out everywhere and make them pick a new password,
+// refresh tokens are revoked and access tokens and websockets
+// stop working until the reset
+// with the returned token, there's no email to send it with,
+// the admin hands it over
+func (cfg *apiConfig) force_password_reset(w http.ResponseWriter, r *http.Request) {
+    user, ok := cfg.adminTarget(w, r)
+    if !ok {
+        return
+    }
+
+    token, err := auth.MakeRefreshToken()
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error generating reset token", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    expiresAt := time.Now().UTC().Add(passwordResetTTL)
+
+    if err := cfg.dbQueries.RequirePasswordReset(r.Context(), database.RequirePasswordResetParams{
+        ID: user.ID,
+        PasswordResetHash: hashResetToken(token),
+        PasswordResetExpiresAt: sql.NullTime{Time: expiresAt, Valid: true},
+    }); err != nil {
+        slog.ErrorContext(r.Context(), "Error requiring password reset", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if err := cfg.dbQueries.RevokeUserRTokens(r.Context(), user.ID); err != nil {
+        slog.ErrorContext(r.Context(), "Error revoking tokens for password reset", "err", err)
+    }
+
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: adminUser(r),
+        Action: actionRequirePasswordReset,
+        UserID: nullID(user.ID),
+    })
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.PasswordResetRequired,
+        ActorID: adminUser(r),
+        TargetType: "user",
+        TargetID: user.ID.String(),
+        Outcome: audit.Success,
+        Detail: "all sessions revoked",
+    })
+
+    type resetRes struct {
+        ResetToken string    `json:"reset_token"`
+        ExpiresAt  time.Time `json:"expires_at"`
+    }
+    respondJSON(w, r, 200, resetRes{
+        ResetToken: token,
+        ExpiresAt: expiresAt,
+    })
+}
+
+// set a new password with the token from a forced reset
+func (cfg *apiConfig) reset_password(w http.ResponseWriter, r *http.Request) {
+    type parameters struct {
+        Token    string `json:"token"`
+        Password string `json:"password"`
+    }
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    v.Required("token", params.Token)
+    v.Password("password", params.Password)
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    hashedPassw, err := cfg.hashPassword(r.Context(), params.Password)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error hashing the user's password", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    user, err := cfg.dbQueries.ResetPassword(r.Context(), database.ResetPasswordParams{
+        PasswordResetHash: hashResetToken(params.Token),
+        HashedPassword: hashedPassw,
+    })
+    if err == sql.ErrNoRows {
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.PasswordReset,
+            Outcome: audit.Failure,
+            Detail: "invalid or expired token",
+        })
+        respondError(w, r, 400, codeBadRequest, "Invalid or expired reset token")
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error resetting password", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.PasswordReset,
+        ActorID: user.ID,
+        TargetType: "user",
+        TargetID: user.ID.String(),
+        Outcome: audit.Success,
+    })
+    w.WriteHeader(204)
+}
+
+// log the user out of every session
+func (cfg *apiConfig) revoke_user_tokens(w http.ResponseWriter, r *http.Request) {
+    user, ok := cfg.adminTarget(w, r)
+    if !ok {
+        return
+    }
+
+    if err := cfg.dbQueries.RevokeUserRTokens(r.Context(), user.ID); err != nil {
+        slog.ErrorContext(r.Context(), "Error revoking user tokens", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: adminUser(r),
+        Action: actionRevokeTokens,
+        UserID: nullID(user.ID),
+    })
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.TokenRevoked,
+        ActorID: adminUser(r),
+        TargetType: "user",
+        TargetID: user.ID.String(),
+        Outcome: audit.Success,
+        Detail: "all sessions",
+    })
+    w.WriteHeader(204)
+}
+
+// grant or take Chirpy Red without going through Polka
+// kept in the subscription history like the webhook events
+func (cfg *apiConfig) set_chirpy_red(w http.ResponseWriter, r *http.Request) {
+    type parameters struct {
+        IsChirpyRed *bool `json:"is_chirpy_red"`
+    }
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    v.Check(params.IsChirpyRed != nil, "is_chirpy_red", validate.CodeRequired, "Is required")
+    if !checkValid(w, r, &v) {
+        return
+    }
+    red := *params.IsChirpyRed
+
+    user, ok := cfg.adminTarget(w, r)
+    if !ok {
+        return
+    }
+
+    if err := cfg.dbQueries.SetChirpyRed(r.Context(), database.SetChirpyRedParams{
+        ID: user.ID,
+        IsChirpyRed: red,
+    }); err != nil {
+        slog.ErrorContext(r.Context(), "Error setting chirpy red", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    event := "admin.downgraded"
+    if red {
+        event = "admin.upgraded"
+    }
+    if err := cfg.dbQueries.CreateSubscriptionEvent(r.Context(), database.CreateSubscriptionEventParams{
+        UserID: user.ID,
+        Event: event,
+    }); err != nil {
+        slog.ErrorContext(r.Context(), "Couldn't record subscription event for user", "user_id", user.ID, "err", err)
+    }
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: adminUser(r),
+        Action: actionSetChirpyRed,
+        UserID: nullID(user.ID),
+        Note: fmt.Sprint(red),
+    })
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.SubscriptionChanged,
+        ActorID: adminUser(r),
+        TargetType: "user",
+        TargetID: user.ID.String(),
+        Outcome: audit.Success,
+        Detail: event,
+    })
+    if red && !user.IsChirpyRed {
+        cfg.notify(r.Context(), user.ID, notificationUpgrade, uuid.Nil, uuid.Nil)
+    }
+    w.WriteHeader(204)
+}
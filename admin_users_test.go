@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestSearchUsers(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    admin := testUser(fake, auth.RoleAdmin)
+    moderator := testUser(fake, auth.RoleModerator)
+    user := testUserWithPassword(t, fake)
+    user.DeletedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+    fake.answer("SearchUsers", []database.User{user})
+    handler := cfg.requireRole(auth.RoleAdmin, cfg.search_users)
+
+    rec := serve(t, "GET /admin/users", handler, "/admin/users?q="+url.QueryEscape(`50%_off\`), testToken(t, admin.ID, time.Hour), "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    if strings.Contains(rec.Body.String(), user.HashedPassword) {
+        t.Errorf("The password hash is shown: %s", rec.Body)
+    }
+    res := []adminUserRes{}
+    json.Unmarshal(rec.Body.Bytes(), &res)
+    // deleted users are found too
+    if len(res) != 1 || res[0].DeletedAt == nil {
+        t.Errorf("Got %+v", res)
+    }
+    // q is matched literally
+    if calls := fake.called("SearchUsers"); len(calls) != 1 || calls[0].args[0] != `%50\%\_off\\%` || calls[0].args[1] != int32(20) {
+        t.Errorf("Got searches %v", calls)
+    }
+
+    if rec := serve(t, "GET /admin/users", handler, "/admin/users?limit=101", testToken(t, admin.ID, time.Hour), ""); rec.Code != 400 {
+        t.Errorf("An invalid limit got status %d", rec.Code)
+    }
+    if rec := serve(t, "GET /admin/users", handler, "/admin/users", testToken(t, moderator.ID, time.Hour), ""); rec.Code != 403 {
+        t.Errorf("A moderator got status %d", rec.Code)
+    }
+}
+
+func TestGetAdminUser(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    admin := testUser(fake, auth.RoleAdmin)
+    user := testUser(fake, "user")
+    user.IsChirpyRed = true
+    user.SuspendedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+    user.SuspensionReason = "spam"
+    fake.on("GetAnyUserByID", func(args []any) (any, error) {
+        if args[0] == user.ID {
+            return user, nil
+        }
+        return nil, nil
+    })
+    now := time.Now().UTC()
+    fake.answer("GetRTokensFromUser", []database.RefreshToken{
+        {Token: "secret-refresh-token", CreatedAt: now, UpdatedAt: now, UserID: user.ID, ExpiresAt: now.Add(time.Hour)},
+    })
+    handler := cfg.requireRole(auth.RoleAdmin, cfg.get_admin_user)
+    token := testToken(t, admin.ID, time.Hour)
+
+    rec := serve(t, "GET /admin/users/{userID}", handler, "/admin/users/"+user.ID.String(), token, "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    if strings.Contains(rec.Body.String(), "secret-refresh-token") {
+        t.Errorf("The refresh token is shown: %s", rec.Body)
+    }
+    res := struct {
+        adminUserRes
+        Sessions     []exportSession    `json:"sessions"`
+        Subscription exportSubscription `json:"subscription"`
+    }{}
+    json.Unmarshal(rec.Body.Bytes(), &res)
+    if res.SuspendedAt == nil || res.SuspensionReason != "spam" || len(res.Sessions) != 1 || !res.Subscription.IsChirpyRed {
+        t.Errorf("Got %+v", res)
+    }
+
+    if rec := serve(t, "GET /admin/users/{userID}", handler, "/admin/users/"+uuid.NewString(), token, ""); rec.Code != 404 {
+        t.Errorf("An unknown user got status %d", rec.Code)
+    }
+}
+
+func TestForcePasswordReset(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    admin := testUser(fake, auth.RoleAdmin)
+    user := testUserWithPassword(t, fake)
+    handler := cfg.requireRole(auth.RoleAdmin, cfg.force_password_reset)
+
+    rec := serve(t, "POST /admin/users/{userID}/password-reset", handler, "/admin/users/"+uuid.NewString()+"/password-reset", testToken(t, admin.ID, time.Hour), "")
+    if rec.Code != 404 {
+        t.Errorf("An unknown user got status %d", rec.Code)
+    }
+
+    rec = serve(t, "POST /admin/users/{userID}/password-reset", handler, "/admin/users/"+user.ID.String()+"/password-reset", testToken(t, admin.ID, time.Hour), "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    res := struct {
+        ResetToken string    `json:"reset_token"`
+        ExpiresAt  time.Time `json:"expires_at"`
+    }{}
+    json.Unmarshal(rec.Body.Bytes(), &res)
+    if res.ResetToken == "" || res.ExpiresAt.Before(time.Now()) {
+        t.Fatalf("Got %+v", res)
+    }
+
+    // only the hash of the token is stored
+    required := fake.called("RequirePasswordReset")
+    if len(required) != 1 || required[0].args[0] != user.ID || required[0].args[1] != hashResetToken(res.ResetToken) {
+        t.Fatalf("Got %v", required)
+    }
+    if revoked := fake.called("RevokeUserRTokens"); len(revoked) != 1 || revoked[0].args[0] != user.ID {
+        t.Errorf("Got revocations %v", revoked)
+    }
+    if actions := fake.called("CreateModerationAction"); len(actions) != 1 || actions[0].args[0] != admin.ID || actions[0].args[1] != actionRequirePasswordReset {
+        t.Errorf("Got actions %v", actions)
+    }
+    if got := fake.audited(audit.PasswordResetRequired); len(got) != 1 || got[0] != audit.Success {
+        t.Errorf("Got audit %v", got)
+    }
+}
+
+// a pending reset locks the user out of logins and their access tokens,
+// an expired one no longer does
+func TestPasswordResetLocksOut(t *testing.T) {
+    tests := []struct {
+        name      string
+        expiresIn time.Duration
+        locked    bool
+    }{
+        {name: "pending", expiresIn: time.Hour, locked: true},
+        {name: "expired", expiresIn: -time.Hour},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUserWithPassword(t, fake)
+            user.PasswordResetHash = hashResetToken("reset-token")
+            user.PasswordResetExpiresAt = sql.NullTime{Time: time.Now().Add(tt.expiresIn), Valid: true}
+            fake.addUser(user)
+            fake.answer("GetUserByEmail", user)
+            fake.answer("InsertRToken", database.RefreshToken{Token: "refresh", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+
+            body, _ := json.Marshal(map[string]string{"email": user.Email, "password": testPassword})
+            rec := serve(t, "POST /api/login", http.HandlerFunc(cfg.login_user), "/api/login", "", string(body))
+            if tt.locked && (rec.Code != 403 || errorCode(t, rec) != codePasswordResetRequired) {
+                t.Errorf("Login got status %d: %s", rec.Code, rec.Body)
+            }
+            if !tt.locked && rec.Code != 200 {
+                t.Errorf("Login got status %d: %s", rec.Code, rec.Body)
+            }
+
+            rec = serve(t, "GET /api/users/me/blocks", http.HandlerFunc(cfg.get_blocks), "/api/users/me/blocks", testToken(t, user.ID, time.Hour), "")
+            if tt.locked && (rec.Code != 403 || errorCode(t, rec) != codePasswordResetRequired) {
+                t.Errorf("An access token got status %d: %s", rec.Code, rec.Body)
+            }
+            if !tt.locked && rec.Code != 200 {
+                t.Errorf("An access token got status %d: %s", rec.Code, rec.Body)
+            }
+        })
+    }
+}
+
+func TestResetPassword(t *testing.T) {
+    tests := []struct {
+        name     string
+        token    string
+        password string
+        status   int
+        audit    []string
+    }{
+        {name: "token", token: "reset-token", password: "a new long password 42", status: 204, audit: []string{audit.Success}},
+        {name: "wrong token", token: "nope", password: "a new long password 42", status: 400, audit: []string{audit.Failure}},
+        {name: "weak password", token: "reset-token", password: "short", status: 422},
+        {name: "no token", password: "a new long password 42", status: 422},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, "user")
+            // as the query does it, a matching and unexpired token
+            fake.on("ResetPassword", func(args []any) (any, error) {
+                if args[0] != hashResetToken("reset-token") {
+                    return nil, nil
+                }
+                return user, nil
+            })
+
+            body, _ := json.Marshal(map[string]string{"token": tt.token, "password": tt.password})
+            rec := serve(t, "POST /api/password-reset", http.HandlerFunc(cfg.reset_password), "/api/password-reset", "", string(body))
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            if resets := fake.called("ResetPassword"); tt.status == 204 {
+                hash, _ := resets[0].args[1].(string)
+                if err := cfg.checkPassword(context.Background(), hash, tt.password); err != nil {
+                    t.Errorf("The new password wasn't stored")
+                }
+            }
+            if got := fake.audited(audit.PasswordReset); len(got) != len(tt.audit) || (len(got) == 1 && got[0] != tt.audit[0]) {
+                t.Errorf("Got audit %v, want %v", got, tt.audit)
+            }
+        })
+    }
+}
+
+func TestSetChirpyRed(t *testing.T) {
+    tests := []struct {
+        name   string
+        body   string
+        // the user had it before
+        red    bool
+        status int
+        event  string
+        // the user is told about the upgrade
+        notify bool
+    }{
+        {name: "upgrade", body: `{"is_chirpy_red": true}`, status: 204, event: "admin.upgraded", notify: true},
+        {name: "already red", body: `{"is_chirpy_red": true}`, red: true, status: 204, event: "admin.upgraded"},
+        {name: "downgrade", body: `{"is_chirpy_red": false}`, red: true, status: 204, event: "admin.downgraded"},
+        {name: "missing", body: `{}`, status: 422},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            admin := testUser(fake, auth.RoleAdmin)
+            user := testUser(fake, "user")
+            user.IsChirpyRed = tt.red
+            fake.addUser(user)
+
+            rec := serve(t, "PUT /admin/users/{userID}/red", cfg.requireRole(auth.RoleAdmin, cfg.set_chirpy_red), "/admin/users/"+user.ID.String()+"/red", testToken(t, admin.ID, time.Hour), tt.body)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            set := fake.called("SetChirpyRed")
+            if tt.status != 204 {
+                if len(set) != 0 {
+                    t.Errorf("Got %v", set)
+                }
+                return
+            }
+            if len(set) != 1 || set[0].args[0] != user.ID {
+                t.Errorf("Got %v", set)
+            }
+            if events := fake.called("CreateSubscriptionEvent"); len(events) != 1 || events[0].args[1] != tt.event {
+                t.Errorf("Got subscription events %v, want %s", events, tt.event)
+            }
+            if got := fake.audited(audit.SubscriptionChanged); len(got) != 1 || got[0] != audit.Success {
+                t.Errorf("Got audit %v", got)
+            }
+            if notified := fake.called("CreateNotification"); (len(notified) == 1) != tt.notify {
+                t.Errorf("Got notifications %v", notified)
+            }
+        })
+    }
+}
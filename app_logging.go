@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/logging"
+	"github.com/google/uuid"
+)
+
+// tag every request with an id, the caller's X-Request-ID when it's sane,
+// sent back on the response and put in the context for the log lines
+// the request is logged once done, so failures that log nothing still show up
+func (cfg *apiConfig) middlewareRequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(logging.RequestIDHeader)
+        if !logging.ValidRequestID(id) {
+            id = uuid.NewString()
+        }
+        w.Header().Set(logging.RequestIDHeader, id)
+        ctx := logging.WithRequestID(r.Context(), id)
+
+        start := time.Now()
+        rec := &statusRecorder{ResponseWriter: w}
+        next.ServeHTTP(rec, r.WithContext(ctx))
+
+        level := slog.LevelInfo
+        if rec.code() >= 500 {
+            level = slog.LevelError
+        }
+        // no query string, it may carry tokens
+        slog.Log(ctx, level, "Request",
+            "method", r.Method,
+            "path", r.URL.Path,
+            "status", rec.code(),
+            "duration_ms", time.Since(start).Milliseconds(),
+        )
+    })
+}
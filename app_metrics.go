@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// every series served on /metrics
+type appMetrics struct {
+    handler         http.Handler
+    requests        *prometheus.CounterVec
+    requestDuration *prometheus.HistogramVec
+    queryDuration   *prometheus.HistogramVec
+    // live updates are only served over WebSocket, there is no SSE endpoint
+    websocketConnections prometheus.Gauge
+    logins          *prometheus.CounterVec
+    chirpsCreated   prometheus.Counter
+    // visits to /app, the old hit counter, also shown on /admin/metrics
+    fileserverHits atomic.Int64
+}
+
+func newAppMetrics() *appMetrics {
+    reg := prometheus.NewRegistry()
+    reg.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+    )
+    factory := promauto.With(reg)
+
+    m := &appMetrics{
+        handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{}),
+        requests: factory.NewCounterVec(prometheus.CounterOpts{
+            Name: "chirpy_http_requests_total",
+            Help: "HTTP requests by route pattern, method and status code.",
+        }, []string{"route", "method", "code"}),
+        requestDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+            Name: "chirpy_http_request_duration_seconds",
+            Help: "HTTP request latency by route pattern, method and status code.",
+            Buckets: prometheus.DefBuckets,
+        }, []string{"route", "method", "code"}),
+        queryDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+            Name: "chirpy_db_query_duration_seconds",
+            Help: "Database query latency by sqlc query name.",
+            Buckets: prometheus.DefBuckets,
+        }, []string{"query"}),
+        websocketConnections: factory.NewGauge(prometheus.GaugeOpts{
+            Name: "chirpy_websocket_connections",
+            Help: "Open WebSocket connections on /api/ws, the live updates.",
+        }),
+        logins: factory.NewCounterVec(prometheus.CounterOpts{
+            Name: "chirpy_logins_total",
+            Help: "Login attempts by outcome: success, failure or denied.",
+        }, []string{"outcome"}),
+        chirpsCreated: factory.NewCounter(prometheus.CounterOpts{
+            Name: "chirpy_chirps_created_total",
+            Help: "Chirps published, rechirps and scheduled chirps included.",
+        }),
+    }
+    factory.NewCounterFunc(prometheus.CounterOpts{
+        Name: "chirpy_fileserver_hits_total",
+        Help: "Requests to the /app file server.",
+    }, func() float64 {
+        return float64(m.fileserverHits.Load())
+    })
+    return m
+}
+
+// count and time every request by the pattern that matched it,
+// so ids in paths don't make a series each
+func (cfg *apiConfig) middlewareMetrics(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        rec := &statusRecorder{ResponseWriter: w}
+        next.ServeHTTP(rec, r)
+
+        // set on r by the mux
+        route := r.Pattern
+        if route == "" {
+            route = "unmatched"
+        }
+        code := strconv.Itoa(rec.code())
+        cfg.metrics.requests.WithLabelValues(route, r.Method, code).Inc()
+        cfg.metrics.requestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+    })
+}
+
+// the status code written by a handler
+type statusRecorder struct {
+    http.ResponseWriter
+    status   int
+    hijacked bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+    if s.status == 0 {
+        s.status = code
+    }
+    s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+    if s.status == 0 {
+        s.status = 200
+    }
+    return s.ResponseWriter.Write(b)
+}
+
+// websocket upgrades take the connection over
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    hj, ok := s.ResponseWriter.(http.Hijacker)
+    if !ok {
+        return nil, nil, http.ErrNotSupported
+    }
+    s.hijacked = true
+    return hj.Hijack()
+}
+
+func (s *statusRecorder) Flush() {
+    if f, ok := s.ResponseWriter.(http.Flusher); ok {
+        f.Flush()
+    }
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+    return s.ResponseWriter
+}
+
+func (s *statusRecorder) code() int {
+    switch {
+    case s.hijacked:
+        return http.StatusSwitchingProtocols
+    case s.status == 0:
+        return 200
+    }
+    return s.status
+}
+
+// Prometheus scrape endpoint
+// scrapers send METRICS_TOKEN as a bearer token, without one
+// the metrics are only served with PLATFORM=dev
+func (cfg *apiConfig) serve_metrics(w http.ResponseWriter, r *http.Request) {
+    if cfg.metricsToken == "" {
+        if cfg.platform != "dev" {
+            respondStatus(w, r, 403)
+            return
+        }
+    } else {
+        want := "Bearer " + cfg.metricsToken
+        if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+            respondStatus(w, r, 401)
+            return
+        }
+    }
+    cfg.metrics.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// name of the tracer of every span started here
+const tracerName = "github.com/elfabri/bdd-Chirpy-project"
+
+// only the w3c traceparent header, in and out
+var tracePropagator = propagation.TraceContext{}
+
+// the exporter picked by the usual OpenTelemetry variables:
+// OTEL_TRACES_EXPORTER "otlp", "console" or "none",
+// otlp by default when an endpoint is set, none otherwise.
+// otlptracehttp reads the endpoint and headers variables itself
+func newTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+    res, err := resource.New(ctx,
+        resource.WithAttributes(attribute.String("service.name", "chirpy")),
+        // OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win
+        resource.WithFromEnv(),
+        resource.WithTelemetrySDK(),
+    )
+    if err != nil {
+        return nil, err
+    }
+    opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+
+    kind := os.Getenv("OTEL_TRACES_EXPORTER")
+    if kind == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+        kind = "otlp"
+    }
+    switch kind {
+    case "otlp":
+        exporter, err := otlptracehttp.New(ctx)
+        if err != nil {
+            return nil, err
+        }
+        opts = append(opts, sdktrace.WithBatcher(exporter))
+    case "console":
+        exporter, err := stdouttrace.New()
+        if err != nil {
+            return nil, err
+        }
+        opts = append(opts, sdktrace.WithBatcher(exporter))
+    }
+    // without an exporter spans still get ids, for the logs
+    return sdktrace.NewTracerProvider(opts...), nil
+}
+
+// a server span for every request, child of the caller's traceparent if any
+// queries and password hashing show up under it,
+// the time left is the handler's own work and the response encoding
+func (cfg *apiConfig) middlewareTracing(next http.Handler) http.Handler {
+    named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        next.ServeHTTP(w, r)
+
+        // set on r by the mux, without ids in it
+        if r.Pattern != "" {
+            route := r.Pattern
+            if _, path, ok := strings.Cut(route, " "); ok {
+                route = path
+            }
+            span := trace.SpanFromContext(r.Context())
+            span.SetName(r.Method + " " + route)
+            span.SetAttributes(attribute.String("http.route", route))
+        }
+    })
+    return otelhttp.NewHandler(named, "http.request",
+        otelhttp.WithTracerProvider(cfg.tracerProvider),
+        otelhttp.WithPropagators(tracePropagator),
+        otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+            return r.Method
+        }),
+    )
+}
+
+// a client span for every outgoing request, with the traceparent header
+func (cfg *apiConfig) tracingTransport(base http.RoundTripper) http.RoundTripper {
+    return otelhttp.NewTransport(base,
+        otelhttp.WithTracerProvider(cfg.tracerProvider),
+        otelhttp.WithPropagators(tracePropagator),
+    )
+}
+
+// bcrypt is slow on purpose, so it gets its own span
+func (cfg *apiConfig) hashPassword(ctx context.Context, password string) (string, error) {
+    _, span := cfg.tracer.Start(ctx, "bcrypt.hash")
+    defer span.End()
+    hash, err := auth.HahsPassword(password)
+    span.RecordError(err)
+    return hash, err
+}
+
+// a wrong password isn't an error of the span
+func (cfg *apiConfig) checkPassword(ctx context.Context, hash, password string) error {
+    _, span := cfg.tracer.Start(ctx, "bcrypt.compare")
+    defer span.End()
+    err := auth.CheckPasswordHash(hash, password)
+    span.SetAttributes(attribute.Bool("password.match", err == nil))
+    return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a database.DBTX whose statements always succeed
+type execOnlyDB struct{}
+
+func (execOnlyDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+    return driverResult(1), nil
+}
+
+func (execOnlyDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+    return nil, nil
+}
+
+func (execOnlyDB) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+    return nil, sql.ErrConnDone
+}
+
+func (execOnlyDB) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+    return nil
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func newTracedConfig() (*apiConfig, *tracetest.InMemoryExporter) {
+    exporter := tracetest.NewInMemoryExporter()
+    tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+    return &apiConfig{
+        metrics: newAppMetrics(),
+        tracerProvider: tp,
+        tracer: tp.Tracer(tracerName),
+    }, exporter
+}
+
+func spanNamed(spans tracetest.SpanStubs, name string) (tracetest.SpanStub, bool) {
+    for _, s := range spans {
+        if s.Name == name {
+            return s, true
+        }
+    }
+    return tracetest.SpanStub{}, false
+}
+
+func TestMiddlewareTracing(t *testing.T) {
+    cfg, exporter := newTracedConfig()
+    db := cfg.instrumentDB(execOnlyDB{})
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("DELETE /api/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+        db.ExecContext(r.Context(), "-- name: DeleteThing :exec\nDELETE FROM things WHERE id = $1", r.PathValue("id"))
+        respondJSON(w, r, 200, map[string]string{"ok": "yes"})
+    })
+    handler := cfg.middlewareTracing(mux)
+
+    const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+    req := httptest.NewRequest("DELETE", "/api/things/42", nil)
+    req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+    rec := httptest.NewRecorder()
+    handler.ServeHTTP(rec, req)
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d", rec.Code)
+    }
+
+    spans := exporter.GetSpans()
+    server, ok := spanNamed(spans, "DELETE /api/things/{id}")
+    if !ok {
+        t.Fatalf("No server span named after the route in %v", spans)
+    }
+    if server.SpanKind != trace.SpanKindServer {
+        t.Errorf("Server span kind is %v", server.SpanKind)
+    }
+    if server.SpanContext.TraceID().String() != traceID {
+        t.Errorf("Server span isn't part of the caller's trace: %s", server.SpanContext.TraceID())
+    }
+    route := ""
+    for _, a := range server.Attributes {
+        if a.Key == "http.route" {
+            route = a.Value.AsString()
+        }
+    }
+    if route != "/api/things/{id}" {
+        t.Errorf("Got http.route %q", route)
+    }
+
+    for _, name := range []string{"DeleteThing", "json.encode"} {
+        child, ok := spanNamed(spans, name)
+        if !ok {
+            t.Errorf("No %s span", name)
+            continue
+        }
+        if child.Parent.SpanID() != server.SpanContext.SpanID() {
+            t.Errorf("%s span isn't a child of the server span", name)
+        }
+    }
+    if query, _ := spanNamed(spans, "DeleteThing"); query.SpanKind != trace.SpanKindClient {
+        t.Errorf("Query span kind is %v", query.SpanKind)
+    }
+}
+
+func TestQueriesWithoutSpanAreNotTraced(t *testing.T) {
+    cfg, exporter := newTracedConfig()
+    db := cfg.instrumentDB(execOnlyDB{})
+    db.ExecContext(context.Background(), "-- name: PurgeThings :execrows\nDELETE FROM things")
+    if spans := exporter.GetSpans(); len(spans) != 0 {
+        t.Errorf("Expected no spans for a background query, got %v", spans)
+    }
+}
+
+func TestTracingTransport(t *testing.T) {
+    cfg, exporter := newTracedConfig()
+
+    got := ""
+    remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = r.Header.Get("traceparent")
+    }))
+    defer remote.Close()
+
+    client := &http.Client{Transport: cfg.tracingTransport(http.DefaultTransport)}
+    ctx, parent := cfg.tracer.Start(context.Background(), "federate")
+    req, _ := http.NewRequestWithContext(ctx, "POST", remote.URL+"/inbox", nil)
+    resp, err := client.Do(req)
+    if err != nil {
+        t.Fatalf("Request failed: %v", err)
+    }
+    resp.Body.Close()
+    parent.End()
+
+    traceID := parent.SpanContext().TraceID().String()
+    if len(got) != 55 || got[3:35] != traceID {
+        t.Errorf("Got traceparent %q, want one in trace %s", got, traceID)
+    }
+    clientSpans := 0
+    for _, s := range exporter.GetSpans() {
+        if s.SpanKind == trace.SpanKindClient {
+            clientSpans++
+        }
+    }
+    if clientSpans != 1 {
+        t.Errorf("Got %d client spans, want 1", clientSpans)
+    }
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+)
+
+// largest json body a handler reads, media uploads have their own limits
+const maxJSONBody = 1 << 20
+
+// decode the json body of r into dst, unknown fields are an error
+// writes the 400 or 413 response when the body can't be used
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+    return decodeBody(w, r, dst, validate.Decode, false)
+}
+
+// like decodeJSON, but an empty body is fine and leaves dst as it is
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+    return decodeBody(w, r, dst, validate.Decode, true)
+}
+
+// like decodeJSON, but unknown fields are ignored
+// only for webhooks, whose senders add fields without asking us
+func decodeWebhookJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+    return decodeBody(w, r, dst, validate.DecodeLenient, false)
+}
+
+type decodeFunc func(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) error
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any, decode decodeFunc, optional bool) bool {
+    err := decode(w, r, dst, maxJSONBody)
+    if err == nil || optional && errors.Is(err, validate.ErrEmpty) {
+        return true
+    }
+    slog.WarnContext(r.Context(), "Error decoding request body", "err", err)
+
+    var fe *validate.FieldError
+    switch {
+    case errors.Is(err, validate.ErrTooLarge):
+        respondError(w, r, 413, codePayloadTooLarge, "Request body is too large")
+    case errors.Is(err, validate.ErrEmpty):
+        respondError(w, r, 400, codeInvalidJSON, "Request body is empty")
+    case errors.As(err, &fe):
+        respondProblem(w, r, apiError{
+            Status: 400,
+            Code: codeInvalidJSON,
+            Detail: "Invalid request body",
+            Fields: validate.Errors{*fe},
+        })
+    default:
+        respondError(w, r, 400, codeInvalidJSON, "Invalid request body")
+    }
+    return false
+}
+
+// writes the 422 with every failed field of v, true when none failed
+func checkValid(w http.ResponseWriter, r *http.Request, v *validate.Validator) bool {
+    if v.Valid() {
+        return true
+    }
+    slog.InfoContext(r.Context(), "Invalid request", "err", v.Err())
+    respondProblem(w, r, apiError{
+        Status: 422,
+        Code: codeValidation,
+        Detail: "Some fields are invalid",
+        Fields: v.Errors,
+    })
+    return false
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/google/uuid"
+)
+
+// the address the request came from, behind a proxy that's the proxy
+func clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
+
+// append an event with the request's address and user agent
+// a failed append doesn't fail the request, it's logged instead
+func (cfg *apiConfig) recordAudit(r *http.Request, e audit.Event) {
+    e.IP = clientIP(r)
+    e.UserAgent = r.UserAgent()
+    if e.Type == audit.UserLogin {
+        cfg.metrics.logins.WithLabelValues(e.Outcome).Inc()
+    }
+    if _, err := cfg.auditLog.Record(r.Context(), e); err != nil {
+        slog.ErrorContext(r.Context(), "Error recording audit event", "type", e.Type, "outcome", e.Outcome, "err", err)
+    }
+}
+
+type auditEntryRes struct {
+    Seq        int64      `json:"seq"`
+    ID         uuid.UUID  `json:"id"`
+    CreatedAt  string     `json:"created_at"`
+    Type       string     `json:"type"`
+    ActorID    *uuid.UUID `json:"actor_id"`
+    TargetType string     `json:"target_type,omitempty"`
+    TargetID   string     `json:"target_id,omitempty"`
+    IP         string     `json:"ip"`
+    UserAgent  string     `json:"user_agent"`
+    Outcome    string     `json:"outcome"`
+    Detail     string     `json:"detail,omitempty"`
+    PrevHash   string     `json:"prev_hash"`
+    Hash       string     `json:"hash"`
+}
+
+// the audit trail, last event first
+// optional queries "type", "actor_id", "target_id", "limit"
+// and "before", the next_before of the previous page
+func (cfg *apiConfig) get_audit_log(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    limit, ok := queryLimit(r)
+    if !ok {
+        respondStatus(w, r, 400)
+        return
+    }
+    filter := audit.Filter{
+        Type: query.Get("type"),
+        TargetID: query.Get("target_id"),
+        Limit: limit,
+    }
+    if a := query.Get("actor_id"); a != "" {
+        actorID, err := uuid.Parse(a)
+        if err != nil {
+            respondError(w, r, 400, codeBadRequest, "Invalid actor_id")
+            return
+        }
+        filter.ActorID = actorID
+    }
+    if b := query.Get("before"); b != "" {
+        before, err := strconv.ParseInt(b, 10, 64)
+        if err != nil || before < 1 {
+            respondError(w, r, 400, codeBadRequest, "Invalid before, use the next_before of the previous page")
+            return
+        }
+        filter.BeforeSeq = before
+    }
+
+    entries, err := cfg.auditLog.Query(r.Context(), filter)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error querying audit log", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    type auditLogRes struct {
+        Entries []auditEntryRes `json:"entries"`
+        // empty on the last page
+        NextBefore int64 `json:"next_before,omitempty"`
+    }
+    res := auditLogRes{
+        Entries: []auditEntryRes{},
+    }
+    for _, e := range entries {
+        item := auditEntryRes{
+            Seq: e.Seq,
+            ID: e.ID,
+            // the precision the hash is computed over
+            CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+            Type: e.Type,
+            TargetType: e.TargetType,
+            TargetID: e.TargetID,
+            IP: e.IP,
+            UserAgent: e.UserAgent,
+            Outcome: e.Outcome,
+            Detail: e.Detail,
+            PrevHash: e.PrevHash,
+            Hash: e.Hash,
+        }
+        if e.ActorID != uuid.Nil {
+            actorID := e.ActorID
+            item.ActorID = &actorID
+        }
+        res.Entries = append(res.Entries, item)
+    }
+    if len(entries) == int(limit) {
+        res.NextBefore = entries[len(entries)-1].Seq
+    }
+    respondJSON(w, r, 200, res)
+}
+
+// recompute the hash chain, ok is false with the first broken entry
+func (cfg *apiConfig) verify_audit_log(w http.ResponseWriter, r *http.Request) {
+    res, err := cfg.auditLog.Verify(r.Context())
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error verifying audit log", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    respondJSON(w, r, 200, res)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/google/uuid"
+)
+
+// an entry as the api returns it hashes to its hash
+func TestGetAuditLogHash(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    actorID := uuid.New()
+    recorded, err := cfg.auditLog.Record(context.Background(), audit.Event{
+        Type: audit.UserLogin,
+        ActorID: actorID,
+        TargetType: "user",
+        TargetID: actorID.String(),
+        IP: "192.0.2.1",
+        UserAgent: "test",
+        Outcome: audit.Success,
+    })
+    if err != nil {
+        t.Fatalf("Couldn't record: %v", err)
+    }
+    // read back as it was written
+    insert := fake.called("InsertAuditEntry")[0]
+    fake.answer("GetAuditEntries", append(fakeRow{int64(1)}, insert.args...))
+
+    rec := serve(t, "GET /admin/audit", http.HandlerFunc(cfg.get_audit_log), "/admin/audit", "", "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    var res struct {
+        Entries []auditEntryRes `json:"entries"`
+    }
+    json.Unmarshal(rec.Body.Bytes(), &res)
+    if len(res.Entries) != 1 {
+        t.Fatalf("Got %s", rec.Body)
+    }
+    e := res.Entries[0]
+    createdAt, err := time.Parse(time.RFC3339Nano, e.CreatedAt)
+    if err != nil {
+        t.Fatalf("Got created_at %q: %v", e.CreatedAt, err)
+    }
+    entry := audit.Entry{
+        Event: audit.Event{
+            Type: e.Type,
+            ActorID: *e.ActorID,
+            TargetType: e.TargetType,
+            TargetID: e.TargetID,
+            IP: e.IP,
+            UserAgent: e.UserAgent,
+            Outcome: e.Outcome,
+            Detail: e.Detail,
+        },
+        ID: e.ID,
+        CreatedAt: createdAt,
+        PrevHash: e.PrevHash,
+    }
+    if hash := audit.Hash(entry); hash != e.Hash || hash != recorded.Hash {
+        t.Errorf("Got hash %s from %+v, want %s", hash, e, recorded.Hash)
+    }
+}
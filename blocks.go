@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+// blocked or muted user in the lists of the logged user
+type relationRes struct {
+    UserID    uuid.UUID `json:"user_id"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// logged user and the {handleOrID} target of a block or mute
+// writes the error response when it can't be used
+func (cfg *apiConfig) relationUsers(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return uuid.Nil, uuid.Nil, false
+    }
+
+    target, err := cfg.lookupUser(r.Context(), r.PathValue("handleOrID"))
+    if err != nil {
+        slog.InfoContext(r.Context(), "User to block or mute not found", "err", err)
+        respondStatus(w, r, 404)
+        return uuid.Nil, uuid.Nil, false
+    }
+    if target.ID == userID {
+        respondError(w, r, 400, codeBadRequest, "You can't block or mute yourself")
+        return uuid.Nil, uuid.Nil, false
+    }
+    return userID, target.ID, true
+}
+
+// block a user, they can't see the blocker's chirps or
+// rechirp, quote, bookmark or notify them, and the other way around
+func (cfg *apiConfig) block_user(w http.ResponseWriter, r *http.Request) {
+    userID, targetID, ok := cfg.relationUsers(w, r)
+    if !ok {
+        return
+    }
+
+    err := cfg.dbQueries.BlockUser(r.Context(), database.BlockUserParams{
+        BlockerID: userID,
+        BlockedID: targetID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error blocking user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unblock_user(w http.ResponseWriter, r *http.Request) {
+    userID, targetID, ok := cfg.relationUsers(w, r)
+    if !ok {
+        return
+    }
+
+    deleted, err := cfg.dbQueries.UnblockUser(r.Context(), database.UnblockUserParams{
+        BlockerID: userID,
+        BlockedID: targetID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error unblocking user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if deleted == 0 {
+        respondStatus(w, r, 404)
+        return
+    }
+    w.WriteHeader(204)
+}
+
+// mute a user, their chirps are left out of the muter's timelines
+// and they don't notify the muter, nothing changes on their side
+func (cfg *apiConfig) mute_user(w http.ResponseWriter, r *http.Request) {
+    userID, targetID, ok := cfg.relationUsers(w, r)
+    if !ok {
+        return
+    }
+
+    err := cfg.dbQueries.MuteUser(r.Context(), database.MuteUserParams{
+        MuterID: userID,
+        MutedID: targetID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error muting user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unmute_user(w http.ResponseWriter, r *http.Request) {
+    userID, targetID, ok := cfg.relationUsers(w, r)
+    if !ok {
+        return
+    }
+
+    deleted, err := cfg.dbQueries.UnmuteUser(r.Context(), database.UnmuteUserParams{
+        MuterID: userID,
+        MutedID: targetID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error unmuting user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if deleted == 0 {
+        respondStatus(w, r, 404)
+        return
+    }
+    w.WriteHeader(204)
+}
+
+// users blocked by the logged user, last blocked first
+func (cfg *apiConfig) get_blocks(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    blocks, err := cfg.dbQueries.GetBlocks(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting blocks", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    res := []relationRes{}
+    for _, b := range blocks {
+        res = append(res, relationRes{UserID: b.BlockedID, CreatedAt: b.CreatedAt})
+    }
+    respondJSON(w, r, 200, res)
+}
+
+// users muted by the logged user, last muted first
+func (cfg *apiConfig) get_mutes(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    mutes, err := cfg.dbQueries.GetMutes(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting mutes", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    res := []relationRes{}
+    for _, m := range mutes {
+        res = append(res, relationRes{UserID: m.MutedID, CreatedAt: m.CreatedAt})
+    }
+    respondJSON(w, r, 200, res)
+}
+
+// users hidden from viewerID, true for blocks and false for mutes
+func (cfg *apiConfig) hiddenUsers(ctx context.Context, viewerID uuid.UUID) (map[uuid.UUID]bool, error) {
+    hidden := map[uuid.UUID]bool{}
+    if viewerID == uuid.Nil {
+        return hidden, nil
+    }
+    rows, err := cfg.dbQueries.GetHiddenUsers(ctx, viewerID)
+    if err != nil {
+        return hidden, err
+    }
+    for _, row := range rows {
+        hidden[row.UserID] = hidden[row.UserID] || row.Blocked
+    }
+    return hidden, nil
+}
+
+// if a block either way stands between viewerID and the chirp,
+// or the original of a rechirp
+func (cfg *apiConfig) blockedChirp(ctx context.Context, viewerID uuid.UUID, chirp database.Chirp) (bool, error) {
+    if viewerID == uuid.Nil {
+        return false, nil
+    }
+    authors := []uuid.UUID{chirp.UserID}
+    if chirp.RepostOf.Valid {
+        original, err := cfg.dbQueries.GetChirpByID(ctx, chirp.RepostOf.UUID)
+        if err != nil {
+            return false, err
+        }
+        authors = append(authors, original.UserID)
+    }
+    for _, authorID := range authors {
+        blocked, err := cfg.dbQueries.IsBlocked(ctx, database.IsBlockedParams{
+            ViewerID: viewerID,
+            UserID: authorID,
+        })
+        if err != nil || blocked {
+            return blocked, err
+        }
+    }
+    return false, nil
+}
+
+// quoted chirps of blocked users are left out like deleted ones
+// mutes don't apply, the quote itself was from someone else
+func (cfg *apiConfig) hideBlockedQuotes(ctx context.Context, viewerID uuid.UUID, res []chirpRes) error {
+    hidden, err := cfg.hiddenUsers(ctx, viewerID)
+    if err != nil {
+        return err
+    }
+    for i := range res {
+        if res[i].Quoted != nil && hidden[res[i].Quoted.UserID] {
+            res[i].Quoted = nil
+        }
+    }
+    return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestBlockUser(t *testing.T) {
+    tests := []struct {
+        name   string
+        self   bool
+        // an unknown user
+        target string
+        status int
+    }{
+        {name: "user", status: 204},
+        {name: "yourself", self: true, status: 400},
+        {name: "unknown", target: uuid.NewString(), status: 404},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, query := range []string{"BlockUser", "MuteUser"} {
+                cfg, fake := newTestConfig(t)
+                user := testUser(fake, "user")
+                other := testUser(fake, "user")
+                target := tt.target
+                switch {
+                case tt.self:
+                    target = user.ID.String()
+                case target == "":
+                    target = other.ID.String()
+                }
+                relation, handler := "block", cfg.block_user
+                if query == "MuteUser" {
+                    relation, handler = "mute", cfg.mute_user
+                }
+
+                rec := serve(t, "POST /api/users/{handleOrID}/"+relation, http.HandlerFunc(handler), "/api/users/"+target+"/"+relation, testToken(t, user.ID, time.Hour), "")
+                if rec.Code != tt.status {
+                    t.Fatalf("%s got status %d, want %d", query, rec.Code, tt.status)
+                }
+                calls := fake.called(query)
+                if tt.status != 204 {
+                    if len(calls) != 0 {
+                        t.Errorf("Got %v", calls)
+                    }
+                    continue
+                }
+                if len(calls) != 1 || calls[0].args[0] != user.ID || calls[0].args[1] != other.ID {
+                    t.Errorf("Got %v", calls)
+                }
+            }
+        })
+    }
+}
+
+func TestUnblockUser(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    other := testUser(fake, "user")
+    token := testToken(t, user.ID, time.Hour)
+
+    rec := serve(t, "DELETE /api/users/{handleOrID}/block", http.HandlerFunc(cfg.unblock_user), "/api/users/"+other.ID.String()+"/block", token, "")
+    if rec.Code != 204 {
+        t.Errorf("Got status %d", rec.Code)
+    }
+    fake.answer("UnblockUser", int64(0))
+    rec = serve(t, "DELETE /api/users/{handleOrID}/block", http.HandlerFunc(cfg.unblock_user), "/api/users/"+other.ID.String()+"/block", token, "")
+    if rec.Code != 404 {
+        t.Errorf("Unblocking a user not blocked got status %d", rec.Code)
+    }
+}
+
+func TestGetChirpsHidden(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    viewer := testUser(fake, "user")
+    blocked := testUser(fake, "user")
+    muted := testUser(fake, "user")
+    now := time.Now().UTC()
+    quotedBlocked := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "blocked", UserID: blocked.ID}
+    quotedMuted := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "muted", UserID: muted.ID}
+    chirps := []database.Chirp{
+        {ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "one", UserID: uuid.New(), QuoteOf: uuid.NullUUID{UUID: quotedBlocked.ID, Valid: true}},
+        {ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "two", UserID: uuid.New(), QuoteOf: uuid.NullUUID{UUID: quotedMuted.ID, Valid: true}},
+    }
+    // the queries leave out chirps of hidden users themselves
+    fake.answer("GetChirps", chirps)
+    fake.answer("GetChirpsFromUser", chirps)
+    fake.answer("GetChirpsByIDs", []database.Chirp{quotedBlocked, quotedMuted})
+    fake.answer("GetHiddenUsers", []database.HiddenUser{
+        {ViewerID: viewer.ID, UserID: blocked.ID, Blocked: true},
+        {ViewerID: viewer.ID, UserID: muted.ID, Blocked: false},
+    })
+    authorID := uuid.New()
+
+    for _, target := range []string{"/api/chirps", "/api/chirps?author_id=" + authorID.String()} {
+        for _, caller := range []uuid.UUID{viewer.ID, uuid.Nil} {
+            token := ""
+            if caller != uuid.Nil {
+                token = testToken(t, caller, time.Hour)
+            }
+            rec := serve(t, "GET /api/chirps", http.HandlerFunc(cfg.get_chirps), target, token, "")
+            if rec.Code != 200 {
+                t.Fatalf("%s got status %d", target, rec.Code)
+            }
+            res := []chirpRes{}
+            json.Unmarshal(rec.Body.Bytes(), &res)
+            if len(res) != 2 {
+                t.Fatalf("%s got %+v", target, res)
+            }
+            // quotes of blocked users are left out, muted ones are kept
+            if (res[0].Quoted == nil) != (caller != uuid.Nil) || res[0].QuoteOf == nil || res[1].Quoted == nil {
+                t.Errorf("%s as %s got quotes %+v, %+v", target, caller, res[0].Quoted, res[1].Quoted)
+            }
+        }
+    }
+
+    all := fake.called("GetChirps")
+    if len(all) != 2 || all[0].args[0] != viewer.ID || all[1].args[0] != uuid.Nil {
+        t.Errorf("Got %v", all)
+    }
+    fromUser := fake.called("GetChirpsFromUser")
+    if len(fromUser) != 2 || fromUser[0].args[0] != authorID || fromUser[0].args[1] != viewer.ID || fromUser[1].args[1] != uuid.Nil {
+        t.Errorf("Got %v", fromUser)
+    }
+}
+
+func TestGetChirpBlocked(t *testing.T) {
+    tests := []struct {
+        name      string
+        anonymous bool
+        // the original of the rechirp is by the blocked user
+        repost    bool
+        blocked   bool
+        // IsBlocked fails, the db is down
+        dbErr     bool
+        status    int
+    }{
+        {name: "not blocked", status: 200},
+        {name: "blocked", blocked: true, status: 404},
+        {name: "db error", dbErr: true, status: 500},
+        {name: "rechirp of a blocked user", repost: true, blocked: true, status: 404},
+        {name: "anonymous", anonymous: true, blocked: true, status: 200},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            viewer := testUser(fake, "user")
+            blocked := testUser(fake, "user")
+            now := time.Now().UTC()
+            original := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: blocked.ID}
+            chirp := original
+            if tt.repost {
+                chirp = database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: uuid.New(),
+                    RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+            }
+            answerChirps(fake, original, chirp)
+            fake.on("IsBlocked", func(args []any) (any, error) {
+                if tt.dbErr {
+                    return nil, errors.New("connection refused")
+                }
+                return tt.blocked && args[0] == viewer.ID && args[1] == blocked.ID, nil
+            })
+            token := ""
+            if !tt.anonymous {
+                token = testToken(t, viewer.ID, time.Hour)
+            }
+
+            rec := serve(t, "GET /api/chirps/{chirpID}", http.HandlerFunc(cfg.get_chirp_by_id), "/api/chirps/"+chirp.ID.String(), token, "")
+            if rec.Code != tt.status {
+                t.Errorf("Got status %d, want %d", rec.Code, tt.status)
+            }
+        })
+    }
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+type bookmarkRes struct {
+    BookmarkedAt time.Time `json:"bookmarked_at"`
+    Chirp        chirpRes  `json:"chirp"`
+}
+
+// save a chirp, bookmarking it again is a no-op
+// bookmarking a rechirp saves its original
+func (cfg *apiConfig) bookmark_chirp(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to bookmark", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    chirp, err := cfg.originalChirp(r.Context(), userID, chirpID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Chirp to bookmark not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    err = cfg.dbQueries.CreateBookmark(r.Context(), database.CreateBookmarkParams{
+        UserID: userID,
+        ChirpID: chirp.ID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error creating bookmark", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) delete_bookmark(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to remove bookmark", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    deleted, err := cfg.dbQueries.DeleteBookmark(r.Context(), database.DeleteBookmarkParams{
+        UserID: userID,
+        ChirpID: chirpID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error deleting bookmark", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if deleted == 0 {
+        respondStatus(w, r, 404)
+        return
+    }
+    w.WriteHeader(204)
+}
+
+// page cursor of bookmarks, "<bookmarked at>_<chirp id>"
+// the chirp id tells apart bookmarks saved at the same time
+func bookmarkCursor(bookmarkedAt time.Time, chirpID uuid.UUID) string {
+    return bookmarkedAt.Format(time.RFC3339Nano) + "_" + chirpID.String()
+}
+
+func parseBookmarkCursor(cursor string) (sql.NullTime, uuid.NullUUID, error) {
+    at, id, ok := strings.Cut(cursor, "_")
+    if !ok {
+        return sql.NullTime{}, uuid.NullUUID{}, errors.New("missing chirp id")
+    }
+    t, err := time.Parse(time.RFC3339Nano, at)
+    if err != nil {
+        return sql.NullTime{}, uuid.NullUUID{}, err
+    }
+    chirpID, err := uuid.Parse(id)
+    if err != nil {
+        return sql.NullTime{}, uuid.NullUUID{}, err
+    }
+    return sql.NullTime{Time: t, Valid: true}, uuid.NullUUID{UUID: chirpID, Valid: true}, nil
+}
+
+// the user's bookmarks, last saved first
+// optional queries "limit" (max 100) and "before", the next_before of the previous page
+// bookmarks of deleted chirps are skipped, and removed when the chirp is purged
+// the same for chirps of users blocked either way, until they're unblocked
+func (cfg *apiConfig) get_bookmarks(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for bookmarks", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    limit := 20
+    if l := r.URL.Query().Get("limit"); l != "" {
+        limit, err = strconv.Atoi(l)
+        if err != nil || limit < 1 || limit > 100 {
+            respondStatus(w, r, 400)
+            return
+        }
+    }
+
+    params := database.GetBookmarksParams{
+        UserID: userID,
+        RowLimit: int32(limit),
+    }
+    if b := r.URL.Query().Get("before"); b != "" {
+        params.BeforeCreatedAt, params.BeforeChirpID, err = parseBookmarkCursor(b)
+        if err != nil {
+            respondError(w, r, 400, codeBadRequest, "Invalid before, use the next_before of the previous page")
+            return
+        }
+    }
+
+    rows, err := cfg.dbQueries.GetBookmarks(r.Context(), params)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting bookmarks", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    chirps := make([]database.Chirp, 0, len(rows))
+    for _, row := range rows {
+        chirps = append(chirps, database.Chirp{
+            ID: row.ID,
+            CreatedAt: row.CreatedAt,
+            UpdatedAt: row.UpdatedAt,
+            Body: row.Body,
+            UserID: row.UserID,
+            DeletedAt: row.DeletedAt,
+            PublishAt: row.PublishAt,
+            RepostOf: row.RepostOf,
+            QuoteOf: row.QuoteOf,
+            HiddenAt: row.HiddenAt,
+            InReplyTo: row.InReplyTo,
+        })
+    }
+    loaded, err := cfg.loadChirps(r.Context(), chirps)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error loading bookmarked chirps", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if err := cfg.hideBlockedQuotes(r.Context(), userID, loaded); err != nil {
+        slog.ErrorContext(r.Context(), "Error getting hidden users", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    type bookmarksRes struct {
+        Bookmarks []bookmarkRes `json:"bookmarks"`
+        // empty on the last page
+        NextBefore string `json:"next_before,omitempty"`
+    }
+
+    res := bookmarksRes{
+        Bookmarks: []bookmarkRes{},
+    }
+    for i, row := range rows {
+        res.Bookmarks = append(res.Bookmarks, bookmarkRes{
+            BookmarkedAt: row.BookmarkedAt,
+            Chirp: loaded[i],
+        })
+    }
+    if len(rows) == limit {
+        last := rows[len(rows)-1]
+        res.NextBefore = bookmarkCursor(last.BookmarkedAt, last.ID)
+    }
+
+    respondJSON(w, r, 200, res)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestBookmarkChirp(t *testing.T) {
+    tests := []struct {
+        name     string
+        ofRepost bool
+        missing  bool
+        blocked  bool
+        status   int
+    }{
+        {name: "chirp", status: 204},
+        // bookmarking a rechirp saves its original
+        {name: "rechirp", ofRepost: true, status: 204},
+        {name: "not found", missing: true, status: 404},
+        {name: "blocked", blocked: true, status: 404},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, "user")
+            now := time.Now().UTC()
+            original := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: uuid.New()}
+            repost := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: uuid.New(),
+                RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+            if !tt.missing {
+                answerChirps(fake, original, repost)
+            }
+            fake.answer("IsBlocked", tt.blocked)
+            target := original.ID
+            if tt.ofRepost {
+                target = repost.ID
+            }
+
+            rec := serve(t, "POST /api/chirps/{chirpID}/bookmark", http.HandlerFunc(cfg.bookmark_chirp), "/api/chirps/"+target.String()+"/bookmark", testToken(t, user.ID, time.Hour), "")
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            created := fake.called("CreateBookmark")
+            if tt.status != 204 {
+                if len(created) != 0 {
+                    t.Errorf("Bookmarked: %v", created)
+                }
+                return
+            }
+            if len(created) != 1 || created[0].args[0] != user.ID || created[0].args[1] != original.ID {
+                t.Errorf("Got bookmarks %v", created)
+            }
+        })
+    }
+}
+
+func TestDeleteBookmark(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    chirpID := uuid.New()
+    token := testToken(t, user.ID, time.Hour)
+
+    rec := serve(t, "DELETE /api/chirps/{chirpID}/bookmark", http.HandlerFunc(cfg.delete_bookmark), "/api/chirps/"+chirpID.String()+"/bookmark", token, "")
+    if rec.Code != 204 {
+        t.Errorf("Got status %d", rec.Code)
+    }
+    if deleted := fake.called("DeleteBookmark"); len(deleted) != 1 || deleted[0].args[0] != user.ID || deleted[0].args[1] != chirpID {
+        t.Errorf("Got deletes %v", deleted)
+    }
+
+    fake.answer("DeleteBookmark", int64(0))
+    rec = serve(t, "DELETE /api/chirps/{chirpID}/bookmark", http.HandlerFunc(cfg.delete_bookmark), "/api/chirps/"+chirpID.String()+"/bookmark", token, "")
+    if rec.Code != 404 {
+        t.Errorf("Deleting a missing bookmark got status %d", rec.Code)
+    }
+}
+
+func TestGetBookmarks(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    now := time.Now().UTC()
+    // saved at the same time, the chirp id tells them apart
+    rows := []database.GetBookmarksRow{
+        {BookmarkedAt: now, ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "one", UserID: uuid.New()},
+        {BookmarkedAt: now, ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "two", UserID: uuid.New()},
+    }
+    fake.on("GetBookmarks", func(args []any) (any, error) {
+        if args[1].(sql.NullTime).Valid {
+            return rows[1:], nil
+        }
+        return rows, nil
+    })
+    token := testToken(t, user.ID, time.Hour)
+
+    type bookmarksRes struct {
+        Bookmarks  []bookmarkRes `json:"bookmarks"`
+        NextBefore string        `json:"next_before"`
+    }
+
+    rec := serve(t, "GET /api/bookmarks", http.HandlerFunc(cfg.get_bookmarks), "/api/bookmarks?limit=2", token, "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    res := bookmarksRes{}
+    json.Unmarshal(rec.Body.Bytes(), &res)
+    if len(res.Bookmarks) != 2 || res.Bookmarks[0].Chirp.ID != rows[0].ID || res.NextBefore != bookmarkCursor(now, rows[1].ID) {
+        t.Fatalf("Got %+v", res)
+    }
+
+    rec = serve(t, "GET /api/bookmarks", http.HandlerFunc(cfg.get_bookmarks), "/api/bookmarks?limit=2&before="+url.QueryEscape(res.NextBefore), token, "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    res = bookmarksRes{}
+    json.Unmarshal(rec.Body.Bytes(), &res)
+    if len(res.Bookmarks) != 1 || res.NextBefore != "" {
+        t.Errorf("Got last page %+v", res)
+    }
+    pages := fake.called("GetBookmarks")
+    if len(pages) != 2 || pages[1].args[0] != user.ID || !pages[1].args[1].(sql.NullTime).Time.Equal(now) ||
+        pages[1].args[2] != (uuid.NullUUID{UUID: rows[1].ID, Valid: true}) || pages[1].args[3] != int32(2) {
+        t.Errorf("Got queries %v", pages)
+    }
+
+    for _, query := range []string{"limit=0", "limit=101", "before=nope", "before=" + url.QueryEscape(now.Format(time.RFC3339Nano))} {
+        if rec := serve(t, "GET /api/bookmarks", http.HandlerFunc(cfg.get_bookmarks), "/api/bookmarks?"+query, token, ""); rec.Code != 400 {
+            t.Errorf("%s got status %d", query, rec.Code)
+        }
+    }
+}
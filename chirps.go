@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+// deleted chirps can be restored by their author for this long
+const chirpRestoreWindow = 7 * 24 * time.Hour
+
+// deleted chirps are kept this long before being removed for good
+const chirpRetention = 30 * 24 * time.Hour
+
+// chirp as returned by the api
+// keeps the original field names, deleted_at is internal
+type chirpRes struct {
+    ID        uuid.UUID
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    Body      string
+    UserID    uuid.UUID
+    Media     []mediaRes `json:",omitempty"`
+    Card      *cardRes   `json:",omitempty"`
+    // the rechirped chirp, rechirps have no body of their own
+    RepostOf  *uuid.UUID `json:",omitempty"`
+    // the quoted chirp, embedded in Quoted while it's still around
+    QuoteOf   *uuid.UUID `json:",omitempty"`
+    Quoted    *chirpRes  `json:",omitempty"`
+    // the chirp this one answers, kept when that one is deleted
+    InReplyTo *uuid.UUID `json:",omitempty"`
+}
+
+func toChirpRes(chirp database.Chirp) chirpRes {
+    res := chirpRes{
+        ID: chirp.ID,
+        CreatedAt: chirp.CreatedAt,
+        UpdatedAt: chirp.UpdatedAt,
+        Body: chirp.Body,
+        UserID: chirp.UserID,
+    }
+    if chirp.RepostOf.Valid {
+        res.RepostOf = &chirp.RepostOf.UUID
+    }
+    if chirp.QuoteOf.Valid {
+        res.QuoteOf = &chirp.QuoteOf.UUID
+    }
+    if chirp.InReplyTo.Valid {
+        res.InReplyTo = &chirp.InReplyTo.UUID
+    }
+    return res
+}
+
+func toChirpsRes(chirps []database.Chirp) []chirpRes {
+    res := make([]chirpRes, 0, len(chirps))
+    for _, chirp := range chirps {
+        res = append(res, toChirpRes(chirp))
+    }
+    return res
+}
+
+// api representation of chirps with their media, link preview
+// and quoted chirp, in the same order
+func (cfg *apiConfig) loadChirps(ctx context.Context, chirps []database.Chirp) ([]chirpRes, error) {
+    res := toChirpsRes(chirps)
+    if err := cfg.attachMedia(ctx, res); err != nil {
+        return res, err
+    }
+    if err := cfg.attachCards(ctx, res); err != nil {
+        return res, err
+    }
+    if err := cfg.attachQuotes(ctx, res); err != nil {
+        return res, err
+    }
+    return res, nil
+}
+
+func (cfg *apiConfig) loadChirp(ctx context.Context, chirp database.Chirp) (chirpRes, error) {
+    res, err := cfg.loadChirps(ctx, []database.Chirp{chirp})
+    if err != nil {
+        return toChirpRes(chirp), err
+    }
+    return res[0], nil
+}
+
+// store a chirp and attach its media in one transaction
+// a publishAt in the future makes it a scheduled chirp, a valid quoteOf a quote
+// and a valid inReplyTo a reply
+func (cfg *apiConfig) createChirp(ctx context.Context, body string, userID uuid.UUID, publishAt *time.Time, mediaIDs []uuid.UUID, quoteOf, inReplyTo uuid.NullUUID) (database.Chirp, error) {
+    tx, err := cfg.db.BeginTx(ctx, nil)
+    if err != nil {
+        return database.Chirp{}, err
+    }
+    defer tx.Rollback()
+    qtx := cfg.txQueries(tx)
+
+    var chirp database.Chirp
+    if publishAt != nil {
+        chirp, err = qtx.CreateScheduledChirp(ctx, database.CreateScheduledChirpParams{
+            Body: body,
+            UserID: userID,
+            PublishAt: sql.NullTime{Time: publishAt.UTC(), Valid: true},
+            QuoteOf: quoteOf,
+            InReplyTo: inReplyTo,
+        })
+    } else {
+        chirp, err = qtx.CreateChirp(ctx, database.CreateChirpParams{
+            Body: body,
+            UserID: userID,
+            QuoteOf: quoteOf,
+            InReplyTo: inReplyTo,
+        })
+    }
+    if err != nil {
+        return chirp, err
+    }
+
+    for i, mediaID := range mediaIDs {
+        err = qtx.AttachMediaToChirp(ctx, database.AttachMediaToChirpParams{
+            ChirpID: chirp.ID,
+            MediaID: mediaID,
+            Position: int32(i),
+        })
+        if err != nil {
+            return chirp, err
+        }
+    }
+
+    return chirp, tx.Commit()
+}
+
+// side effects of a chirp going public: live events, federation, notifications and its link preview
+// the same for new, published and scheduled chirps
+func (cfg *apiConfig) chirpPublished(ctx context.Context, chirp database.Chirp) {
+    cfg.metrics.chirpsCreated.Inc()
+    res, err := cfg.loadChirp(ctx, chirp)
+    if err != nil {
+        slog.ErrorContext(ctx, "Error loading chirp", "chirp_id", chirp.ID, "err", err)
+    }
+    cfg.publishChirpEvent(events.ChirpCreated, res)
+    // rechirps only exist on this server
+    if !chirp.RepostOf.Valid {
+        cfg.federateChirp(ctx, chirp, false)
+    }
+    cfg.notifyMentions(ctx, chirp)
+    cfg.notifyOriginalAuthor(ctx, chirp)
+    cfg.notifyRepliedAuthor(ctx, chirp)
+    cfg.unfurlChirp(ctx, res)
+}
+
+// restore a deleted chirp
+// only the author, and only within the restore window
+func (cfg *apiConfig) restore_chirp(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to restore chirp", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    chirp, err := cfg.dbQueries.GetDeletedChirpByID(r.Context(), chirpID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Deleted chirp not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    if chirp.UserID != userID {
+        slog.WarnContext(r.Context(), "Trying to restore someone else's chirp")
+        respondStatus(w, r, 403)
+        return
+    }
+
+    if chirp.HiddenAt.Valid {
+        respondError(w, r, 403, codeForbidden, "Chirp was removed by a moderator")
+        return
+    }
+
+    if time.Since(chirp.DeletedAt.Time) > chirpRestoreWindow {
+        respondError(w, r, 410, codeGone, "Restore window has passed")
+        return
+    }
+
+    chirp, err = cfg.dbQueries.RestoreChirp(r.Context(), chirpID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error restoring chirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    res, err := cfg.loadChirp(r.Context(), chirp)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error loading chirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    cfg.publishChirpEvent(events.ChirpCreated, res)
+    if !chirp.RepostOf.Valid {
+        cfg.federateChirp(r.Context(), chirp, false)
+    }
+    // its rechirps are visible again
+    cfg.publishRepostEvents(r.Context(), chirp.ID, events.ChirpCreated)
+
+    respondJSON(w, r, 200, res)
+}
+
+// hard delete chirps deleted longer than the retention period
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) {
+    purged, err := cfg.dbQueries.PurgeDeletedChirps(ctx, sql.NullTime{
+        Time: time.Now().Add(-chirpRetention),
+        Valid: true,
+    })
+    if err != nil {
+        slog.ErrorContext(ctx, "Error purging deleted chirps", "err", err)
+        return
+    }
+    if purged > 0 {
+        slog.InfoContext(ctx, "Purged deleted chirps", "count", purged)
+    }
+}
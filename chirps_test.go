@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+// a chirp of userID, answered by GetChirpByID
+func testChirp(fake *fakeDB, userID uuid.UUID) database.Chirp {
+    now := time.Now().UTC()
+    chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: userID}
+    fake.answer("GetChirpByID", chirp)
+    return chirp
+}
+
+func TestDeleteChirp(t *testing.T) {
+    tests := []struct {
+        name   string
+        author bool
+        repost bool
+        status int
+        // the query deleting it
+        query  string
+    }{
+        {name: "author", author: true, status: 204, query: "DeleteChirp"},
+        {name: "rechirp", author: true, repost: true, status: 204, query: "DeleteRepost"},
+        {name: "someone else's", status: 403},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            other := testUser(fake, "user")
+            chirp := testChirp(fake, author.ID)
+            if tt.repost {
+                chirp.RepostOf = uuid.NullUUID{UUID: uuid.New(), Valid: true}
+                fake.answer("GetChirpByID", chirp)
+            }
+            caller := other
+            if tt.author {
+                caller = author
+            }
+            sub := events.NewSubscriber(4)
+            cfg.events.Subscribe(events.GlobalChannel, sub)
+
+            rec := serve(t, "DELETE /api/chirps/{chirpID}", http.HandlerFunc(cfg.delete_chirp_by_id), "/api/chirps/"+chirp.ID.String(), testToken(t, caller.ID, time.Hour), "")
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+
+            deleted := append(fake.called("DeleteChirp"), fake.called("DeleteRepost")...)
+            if tt.query == "" {
+                if len(deleted) != 0 {
+                    t.Errorf("Deleted: %v", deleted)
+                }
+                if got := fake.audited(audit.ChirpDeleted); len(got) != 1 || got[0] != audit.Denied {
+                    t.Errorf("Got audit %v, want one denied", got)
+                }
+                return
+            }
+            if calls := fake.called(tt.query); len(deleted) != 1 || len(calls) != 1 || calls[0].args[0] != chirp.ID {
+                t.Errorf("Got deletes %v, want %s", deleted, tt.query)
+            }
+            select {
+            case ev := <-sub.C:
+                if ev.Type != events.ChirpDeleted {
+                    t.Errorf("Got event %v", ev.Type)
+                }
+            default:
+                t.Errorf("No event")
+            }
+        })
+    }
+}
+
+func TestRestoreChirp(t *testing.T) {
+    tests := []struct {
+        name       string
+        other      bool
+        missing    bool
+        deletedAgo time.Duration
+        hidden     bool
+        status     int
+        code       string
+    }{
+        {name: "author", deletedAgo: time.Hour, status: 200},
+        {name: "someone else's", other: true, deletedAgo: time.Hour, status: 403, code: codeForbidden},
+        {name: "not deleted", missing: true, status: 404, code: codeNotFound},
+        {name: "removed by a moderator", deletedAgo: time.Hour, hidden: true, status: 403, code: codeForbidden},
+        {name: "after the window", deletedAgo: chirpRestoreWindow + time.Hour, status: 410, code: codeGone},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            other := testUser(fake, "user")
+            now := time.Now().UTC()
+            chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: author.ID,
+                DeletedAt: sql.NullTime{Time: now.Add(-tt.deletedAgo), Valid: true}}
+            if tt.hidden {
+                chirp.HiddenAt = chirp.DeletedAt
+            }
+            if !tt.missing {
+                fake.answer("GetDeletedChirpByID", chirp)
+            }
+            restored := chirp
+            restored.DeletedAt = sql.NullTime{}
+            fake.answer("RestoreChirp", restored)
+            caller := author
+            if tt.other {
+                caller = other
+            }
+
+            rec := serve(t, "POST /api/chirps/{chirpID}/restore", http.HandlerFunc(cfg.restore_chirp), "/api/chirps/"+chirp.ID.String()+"/restore", testToken(t, caller.ID, time.Hour), "")
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            calls := fake.called("RestoreChirp")
+            if tt.status != 200 {
+                if code := errorCode(t, rec); code != tt.code {
+                    t.Errorf("Got code %q, want %q", code, tt.code)
+                }
+                if len(calls) != 0 {
+                    t.Errorf("Restored: %v", calls)
+                }
+                return
+            }
+            if len(calls) != 1 || calls[0].args[0] != chirp.ID {
+                t.Errorf("Got restores %v", calls)
+            }
+        })
+    }
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a database.DBTX that times every query,
+// and makes it a span when it runs for a traced request
+type instrumentedDB struct {
+    db      database.DBTX
+    metrics *appMetrics
+    tracer  trace.Tracer
+}
+
+func (cfg *apiConfig) instrumentDB(db database.DBTX) database.DBTX {
+    return &instrumentedDB{db: db, metrics: cfg.metrics, tracer: cfg.tracer}
+}
+
+// queries of a transaction, measured like the others
+func (cfg *apiConfig) txQueries(tx *sql.Tx) *database.Queries {
+    return database.New(cfg.instrumentDB(tx))
+}
+
+// sqlc queries start with "-- name: GetChirpByID :one"
+func queryName(query string) string {
+    rest, ok := strings.CutPrefix(query, "-- name: ")
+    if !ok {
+        return "unnamed"
+    }
+    name, _, _ := strings.Cut(rest, " ")
+    return name
+}
+
+// background jobs run without a request span,
+// their queries are only timed, not traced as traces of their own
+func (d *instrumentedDB) start(ctx context.Context, query string) (context.Context, func(error)) {
+    name := queryName(query)
+    start := time.Now()
+    var span trace.Span
+    if trace.SpanContextFromContext(ctx).IsValid() {
+        ctx, span = d.tracer.Start(ctx, name,
+            trace.WithSpanKind(trace.SpanKindClient),
+            trace.WithAttributes(
+                attribute.String("db.system", "postgresql"),
+                attribute.String("db.operation.name", name),
+            ),
+        )
+    }
+    return ctx, func(err error) {
+        d.metrics.queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+        if span == nil {
+            return
+        }
+        if err != nil && err != sql.ErrNoRows {
+            span.RecordError(err)
+            span.SetStatus(codes.Error, err.Error())
+        }
+        span.End()
+    }
+}
+
+func (d *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    ctx, done := d.start(ctx, query)
+    res, err := d.db.ExecContext(ctx, query, args...)
+    done(err)
+    return res, err
+}
+
+func (d *instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+    return d.db.PrepareContext(ctx, query)
+}
+
+// the time to the first row, reading the rest is up to the caller
+func (d *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    ctx, done := d.start(ctx, query)
+    rows, err := d.db.QueryContext(ctx, query, args...)
+    done(err)
+    return rows, err
+}
+
+func (d *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    ctx, done := d.start(ctx, query)
+    row := d.db.QueryRowContext(ctx, query, args...)
+    done(row.Err())
+    return row
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+)
+
+// drafts skip the chirp limit until published, but can't grow forever
+const maxDraftLen = 10000
+
+type draftRes struct {
+    Id        string `json:"id"`
+    CreatedAt string `json:"created_at"`
+    UpdatedAt string `json:"updated_at"`
+    Body      string `json:"body"`
+}
+
+func toDraftRes(draft database.Draft) draftRes {
+    return draftRes{
+        Id: draft.ID.String(),
+        CreatedAt: draft.CreatedAt.String(),
+        UpdatedAt: draft.UpdatedAt.String(),
+        Body: draft.Body,
+    }
+}
+
+// body of a draft from the request, writes 400 when it can't be used
+func decodeDraftBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+    type draftParams struct {
+        Body string `json:"body"`
+    }
+
+    params := draftParams{}
+    if !decodeJSON(w, r, &params) {
+        return "", false
+    }
+    v := validate.Validator{}
+    v.Check(len(params.Body) <= maxDraftLen, "body", validate.CodeTooLong, "Draft is too long")
+    if !checkValid(w, r, &v) {
+        return "", false
+    }
+    return params.Body, true
+}
+
+// draft from the {draftID} path value, owned by the logged user
+// writes the error response when it can't be used
+func (cfg *apiConfig) ownDraft(w http.ResponseWriter, r *http.Request) (database.Draft, bool) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for draft", "err", err)
+        respondAuthError(w, r, err)
+        return database.Draft{}, false
+    }
+
+    draftID, err := uuid.Parse(r.PathValue("draftID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing draft uuid", "err", err)
+        respondStatus(w, r, 404)
+        return database.Draft{}, false
+    }
+
+    draft, err := cfg.dbQueries.GetDraftByID(r.Context(), draftID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Draft not found", "err", err)
+        respondStatus(w, r, 404)
+        return database.Draft{}, false
+    }
+
+    // other users' drafts don't exist for this user
+    if draft.UserID != userID {
+        respondStatus(w, r, 404)
+        return database.Draft{}, false
+    }
+    return draft, true
+}
+
+func (cfg *apiConfig) create_draft(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for draft", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    body, ok := decodeDraftBody(w, r)
+    if !ok {
+        return
+    }
+
+    draft, err := cfg.dbQueries.CreateDraft(r.Context(), database.CreateDraftParams{
+        UserID: userID,
+        Body: body,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error creating draft", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    respondJSON(w, r, 201, toDraftRes(draft))
+}
+
+// drafts of the logged user, last edited first
+func (cfg *apiConfig) get_drafts(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for drafts", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    drafts, err := cfg.dbQueries.GetDraftsFromUser(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting drafts", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    res := make([]draftRes, 0, len(drafts))
+    for _, draft := range drafts {
+        res = append(res, toDraftRes(draft))
+    }
+    respondJSON(w, r, 200, res)
+}
+
+func (cfg *apiConfig) get_draft(w http.ResponseWriter, r *http.Request) {
+    draft, ok := cfg.ownDraft(w, r)
+    if !ok {
+        return
+    }
+    respondJSON(w, r, 200, toDraftRes(draft))
+}
+
+func (cfg *apiConfig) update_draft(w http.ResponseWriter, r *http.Request) {
+    draft, ok := cfg.ownDraft(w, r)
+    if !ok {
+        return
+    }
+
+    body, ok := decodeDraftBody(w, r)
+    if !ok {
+        return
+    }
+
+    draft, err := cfg.dbQueries.UpdateDraft(r.Context(), database.UpdateDraftParams{
+        ID: draft.ID,
+        Body: body,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error updating draft", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    respondJSON(w, r, 200, toDraftRes(draft))
+}
+
+func (cfg *apiConfig) delete_draft(w http.ResponseWriter, r *http.Request) {
+    draft, ok := cfg.ownDraft(w, r)
+    if !ok {
+        return
+    }
+
+    if _, err := cfg.dbQueries.DeleteDraft(r.Context(), draft.ID); err != nil {
+        slog.ErrorContext(r.Context(), "Error deleting draft", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// turn a draft into a real chirp, the draft is removed
+func (cfg *apiConfig) publish_draft(w http.ResponseWriter, r *http.Request) {
+    draft, ok := cfg.ownDraft(w, r)
+    if !ok {
+        return
+    }
+
+    // same contract as create_chirp
+    v := validate.Validator{}
+    validChirp := validateChirpBody(&v, draft.Body)
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error starting transaction", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    defer tx.Rollback()
+    qtx := cfg.txQueries(tx)
+
+    // a publish from another device may have won the race
+    deleted, err := qtx.DeleteDraft(r.Context(), draft.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error deleting published draft", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if deleted == 0 {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+        Body: validChirp,
+        UserID: draft.UserID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error creating chirp from draft", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    if err := tx.Commit(); err != nil {
+        slog.ErrorContext(r.Context(), "Error committing draft publish", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    cfg.chirpPublished(r.Context(), chirp)
+
+    res, err := cfg.loadChirp(r.Context(), chirp)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error loading chirp", "err", err)
+    }
+
+    respondJSON(w, r, 201, res)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+func TestPublishDraft(t *testing.T) {
+    tests := []struct {
+        name   string
+        body   string
+        other  bool
+        // a publish from another device won
+        raced  bool
+        status int
+        // body of the chirp created
+        chirp  string
+    }{
+        {name: "draft", body: "what a kerfuffle", status: 201, chirp: "what a ****"},
+        {name: "too long for a chirp", body: strings.Repeat("a", 141), status: 422},
+        {name: "empty", body: "", status: 422},
+        {name: "someone else's", body: "hello", other: true, status: 404},
+        {name: "already published", body: "hello", raced: true, status: 404},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            other := testUser(fake, "user")
+            now := time.Now().UTC()
+            draft := database.Draft{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: author.ID, Body: tt.body}
+            fake.answer("GetDraftByID", draft)
+            if tt.raced {
+                fake.answer("DeleteDraft", int64(0))
+            }
+            echoChirps(fake)
+            caller := author
+            if tt.other {
+                caller = other
+            }
+            sub := events.NewSubscriber(4)
+            cfg.events.Subscribe(events.GlobalChannel, sub)
+
+            rec := serve(t, "POST /api/drafts/{draftID}/publish", http.HandlerFunc(cfg.publish_draft), "/api/drafts/"+draft.ID.String()+"/publish", testToken(t, caller.ID, time.Hour), "")
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+
+            // the same field error as create_chirp
+            if rec.Code == 422 {
+                body := apiError{}
+                json.Unmarshal(rec.Body.Bytes(), &body)
+                if len(body.Fields) != 1 || body.Fields[0].Field != "body" {
+                    t.Errorf("Got field errors %+v", body.Fields)
+                }
+            }
+
+            created := fake.called("CreateChirp")
+            if tt.chirp == "" {
+                if len(created) != 0 || len(sub.C) != 0 {
+                    t.Errorf("Published: %v", created)
+                }
+                if !tt.raced && len(fake.called("DeleteDraft")) != 0 {
+                    t.Errorf("The draft was removed")
+                }
+                return
+            }
+            if len(created) != 1 || created[0].args[0] != tt.chirp || created[0].args[1] != author.ID {
+                t.Fatalf("Got chirps %v", created)
+            }
+            if deleted := fake.called("DeleteDraft"); len(deleted) != 1 || deleted[0].args[0] != draft.ID {
+                t.Errorf("Got draft deletes %v", deleted)
+            }
+            res := chirpRes{}
+            json.Unmarshal(rec.Body.Bytes(), &res)
+            if res.Body != tt.chirp || res.UserID != author.ID {
+                t.Errorf("Got %+v", res)
+            }
+            select {
+            case ev := <-sub.C:
+                if ev.Type != events.ChirpCreated {
+                    t.Errorf("Got event %v", ev.Type)
+                }
+            default:
+                t.Errorf("The chirp wasn't published")
+            }
+        })
+    }
+}
+
+func TestCreateDraft(t *testing.T) {
+    tests := []struct {
+        name   string
+        body   string
+        status int
+    }{
+        // drafts can be longer than a chirp until published
+        {name: "long", body: strings.Repeat("a", 500), status: 201},
+        {name: "too long", body: strings.Repeat("a", maxDraftLen+1), status: 422},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, "user")
+            fake.on("CreateDraft", func(args []any) (any, error) {
+                now := time.Now().UTC()
+                return database.Draft{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: args[0].(uuid.UUID), Body: args[1].(string)}, nil
+            })
+
+            body, _ := json.Marshal(map[string]string{"body": tt.body})
+            rec := serve(t, "POST /api/drafts", http.HandlerFunc(cfg.create_draft), "/api/drafts", testToken(t, user.ID, time.Hour), string(body))
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d", rec.Code, tt.status)
+            }
+            if created := fake.called("CreateDraft"); (tt.status == 201) != (len(created) == 1) {
+                t.Errorf("Got drafts %v", created)
+            }
+        })
+    }
+}
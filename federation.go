@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/activitypub"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+// activities in the outbox, newest first
+const outboxSize = 50
+
+func actorURL(base string, userID uuid.UUID) string {
+    return base + "/ap/users/" + userID.String()
+}
+
+func writeActivityJSON(w http.ResponseWriter, r *http.Request, v any) {
+    w.Header().Set("Content-Type", activitypub.ContentType)
+    respondJSON(w, r, 200, v)
+}
+
+// signing key of a local actor, created on first use
+func (cfg *apiConfig) actorKey(ctx context.Context, base string, userID uuid.UUID) (*activitypub.Key, string, error) {
+    stored, err := cfg.dbQueries.GetActorKey(ctx, userID)
+    if err == sql.ErrNoRows {
+        privatePem, publicPem, err := activitypub.GenerateKeyPair()
+        if err != nil {
+            return nil, "", err
+        }
+        err = cfg.dbQueries.CreateActorKey(ctx, database.CreateActorKeyParams{
+            UserID: userID,
+            PublicKeyPem: publicPem,
+            PrivateKeyPem: privatePem,
+        })
+        if err != nil {
+            return nil, "", err
+        }
+        // someone else may have won the race, read what was stored
+        stored, err = cfg.dbQueries.GetActorKey(ctx, userID)
+    }
+    if err != nil {
+        return nil, "", err
+    }
+
+    key, err := activitypub.ParsePrivateKey(actorURL(base, userID)+"#main-key", stored.PrivateKeyPem)
+    if err != nil {
+        return nil, "", err
+    }
+    return key, stored.PublicKeyPem, nil
+}
+
+func chirpNote(base string, chirp database.Chirp) activitypub.Note {
+    actor := actorURL(base, chirp.UserID)
+    note := activitypub.Note{
+        ID: chirpPermalink(base, chirp.ID),
+        Type: "Note",
+        AttributedTo: actor,
+        Content: "<p>" + html.EscapeString(chirp.Body) + "</p>",
+        URL: chirpPermalink(base, chirp.ID),
+        Published: chirp.CreatedAt.UTC().Format(time.RFC3339),
+        To: []string{activitypub.PublicAddress},
+        Cc: []string{actor + "/followers"},
+    }
+    // replies are only to local chirps
+    if chirp.InReplyTo.Valid {
+        note.InReplyTo = chirpPermalink(base, chirp.InReplyTo.UUID)
+    }
+    return note
+}
+
+func chirpCreateActivity(base string, chirp database.Chirp) activitypub.Activity {
+    note := chirpNote(base, chirp)
+    activity := activitypub.NewActivity(note.ID+"#create", "Create", note.AttributedTo, note)
+    activity.Published = note.Published
+    activity.To = note.To
+    activity.Cc = note.Cc
+    return activity
+}
+
+// deliver a chirp creation or deletion to the remote followers of its author
+// runs in the background, failed deliveries are only logged
+// with the request id of ctx, it isn't cancelled with it
+func (cfg *apiConfig) federateChirp(ctx context.Context, chirp database.Chirp, deleted bool) {
+    // without BASE_URL there are no actor urls to deliver from
+    base := cfg.baseURL()
+    if base == "" {
+        return
+    }
+    ctx = context.WithoutCancel(ctx)
+    go func() {
+        ctx, cancel := context.WithTimeout(ctx, time.Minute)
+        defer cancel()
+
+        followers, err := cfg.dbQueries.GetRemoteFollowers(ctx, chirp.UserID)
+        if err != nil {
+            slog.ErrorContext(ctx, "Error getting remote followers", "user_id", chirp.UserID, "err", err)
+            return
+        }
+        if len(followers) == 0 {
+            return
+        }
+
+        key, _, err := cfg.actorKey(ctx, base, chirp.UserID)
+        if err != nil {
+            slog.ErrorContext(ctx, "Error getting actor key", "user_id", chirp.UserID, "err", err)
+            return
+        }
+
+        activity := chirpCreateActivity(base, chirp)
+        if deleted {
+            tombstone := map[string]string{
+                "id": chirpPermalink(base, chirp.ID),
+                "type": "Tombstone",
+            }
+            activity = activitypub.NewActivity(tombstone["id"]+"#delete", "Delete", actorURL(base, chirp.UserID), tombstone)
+            activity.To = []string{activitypub.PublicAddress}
+        }
+
+        // a follower's server may be shared by many followers
+        delivered := map[string]bool{}
+        for _, f := range followers {
+            if delivered[f.Inbox] {
+                continue
+            }
+            delivered[f.Inbox] = true
+            if err := activitypub.Deliver(ctx, cfg.fedClient, f.Inbox, key, activity); err != nil {
+                slog.ErrorContext(ctx, "Error delivering activity", "type", activity.Type, "inbox", f.Inbox, "err", err)
+            }
+        }
+    }()
+}
+
+// true when both urls are https and on the same host, so a key id
+// can't make us fetch anything the activity's actor doesn't serve
+func sameHTTPSHost(a, b string) bool {
+    ua, err := url.Parse(a)
+    if err != nil || ua.Scheme != "https" || ua.Host == "" {
+        return false
+    }
+    ub, err := url.Parse(b)
+    if err != nil || ub.Scheme != "https" {
+        return false
+    }
+    return strings.EqualFold(ua.Host, ub.Host)
+}
+
+// user from the {userID} path value, writes 404 if not found
+func (cfg *apiConfig) federatedUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return database.User{}, false
+    }
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Actor not found", "err", err)
+        respondStatus(w, r, 404)
+        return database.User{}, false
+    }
+    return user, true
+}
+
+// webfinger lookup, resource=acct:<handle or user-id>@<host>
+func (cfg *apiConfig) webfinger(w http.ResponseWriter, r *http.Request) {
+    resource := r.URL.Query().Get("resource")
+    username, domain, err := activitypub.ParseAcct(resource)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Invalid webfinger resource", "err", err)
+        respondStatus(w, r, 400)
+        return
+    }
+
+    base := cfg.baseURL()
+    baseURL, err := url.Parse(base)
+    if err != nil || !strings.EqualFold(domain, baseURL.Host) {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    user, err := cfg.lookupUser(r.Context(), username)
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    finger := activitypub.NewWebFinger(
+        "acct:"+userUsername(user)+"@"+domain,
+        actorURL(base, user.ID),
+        base+"/api/users/"+userUsername(user),
+    )
+
+    w.Header().Set("Access-Control-Allow-Origin", "*")
+    w.Header().Set("Content-Type", activitypub.JRDContentType)
+    respondJSON(w, r, 200, finger)
+}
+
+// actor document of a local user
+func (cfg *apiConfig) get_actor(w http.ResponseWriter, r *http.Request) {
+    user, ok := cfg.federatedUser(w, r)
+    if !ok {
+        return
+    }
+
+    base := cfg.baseURL()
+    _, publicPem, err := cfg.actorKey(r.Context(), base, user.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting actor key", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    actor := activitypub.NewActor(actorURL(base, user.ID), userUsername(user), publicPem)
+    actor.URL = base + "/api/users/" + userUsername(user)
+    actor.Name = user.DisplayName
+    actor.Summary = html.EscapeString(user.Bio)
+    if user.AvatarUrl != "" {
+        actor.Icon = &activitypub.Image{Type: "Image", URL: user.AvatarUrl}
+    }
+
+    writeActivityJSON(w, r, actor)
+}
+
+// outbox with the latest chirps of the user as Create activities
+func (cfg *apiConfig) get_outbox(w http.ResponseWriter, r *http.Request) {
+    user, ok := cfg.federatedUser(w, r)
+    if !ok {
+        return
+    }
+
+    chirps, err := cfg.dbQueries.GetLatestChirpsFromUser(r.Context(), database.GetLatestChirpsFromUserParams{
+        UserID: user.ID,
+        Limit: outboxSize,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error while getting chirps from user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    total, err := cfg.dbQueries.CountOriginalChirpsFromUser(r.Context(), user.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error counting chirps from user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    // rechirps only exist on this server, the page may come out shorter
+    base := cfg.baseURL()
+    items := []any{}
+    for _, c := range chirps {
+        if !c.RepostOf.Valid {
+            items = append(items, chirpCreateActivity(base, c))
+        }
+    }
+
+    outbox := activitypub.NewOrderedCollection(actorURL(base, user.ID)+"/outbox", int(total), items)
+    writeActivityJSON(w, r, outbox)
+}
+
+// followers collection, only the count is public
+func (cfg *apiConfig) get_followers(w http.ResponseWriter, r *http.Request) {
+    user, ok := cfg.federatedUser(w, r)
+    if !ok {
+        return
+    }
+
+    count, err := cfg.dbQueries.CountRemoteFollowers(r.Context(), user.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error counting remote followers", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    base := cfg.baseURL()
+    followers := activitypub.NewOrderedCollection(actorURL(base, user.ID)+"/followers", int(count), nil)
+    writeActivityJSON(w, r, followers)
+}
+
+// inbox, accepts signed Follow and Undo Follow activities
+func (cfg *apiConfig) post_inbox(w http.ResponseWriter, r *http.Request) {
+    user, ok := cfg.federatedUser(w, r)
+    if !ok {
+        return
+    }
+
+    activity, body, err := activitypub.ReadActivity(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error decoding incoming activity", "err", err)
+        respondStatus(w, r, 400)
+        return
+    }
+
+    // the remote actor must have signed the request with its key
+    keyID, err := activitypub.SignatureKeyID(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Unsigned activity", "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+    keyOwner, _, _ := strings.Cut(keyID, "#")
+    if !sameHTTPSHost(keyOwner, activity.Actor) {
+        slog.WarnContext(r.Context(), "Key id is not on the actor's host", "actor", activity.Actor, "key_id", keyID)
+        respondStatus(w, r, 401)
+        return
+    }
+    remote, err := activitypub.FetchActor(r.Context(), cfg.fedClient, keyOwner)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error fetching remote actor", "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+    if remote.PublicKey.ID != keyID || remote.ID != activity.Actor {
+        slog.WarnContext(r.Context(), "Activity actor doesn't own the key", "actor", activity.Actor, "key_id", keyID)
+        respondStatus(w, r, 401)
+        return
+    }
+    // the Accept goes to the inbox the remote document names
+    if !sameHTTPSHost(remote.Inbox, remote.ID) {
+        slog.WarnContext(r.Context(), "Remote inbox is not on the actor's host", "remote_id", remote.ID, "inbox", remote.Inbox)
+        respondStatus(w, r, 400)
+        return
+    }
+    public, err := activitypub.ParsePublicKey(remote.PublicKey.PublicKeyPem)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Invalid public key", "remote_id", remote.ID, "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+    if err := activitypub.Verify(r, body, public); err != nil {
+        slog.WarnContext(r.Context(), "Invalid signature", "remote_id", remote.ID, "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+
+    base := cfg.baseURL()
+    local := actorURL(base, user.ID)
+
+    switch activity.Type {
+    case "Follow":
+        if activitypub.ObjectID(activity.Object) != local {
+            respondStatus(w, r, 400)
+            return
+        }
+        err = cfg.dbQueries.AddRemoteFollower(r.Context(), database.AddRemoteFollowerParams{
+            UserID: user.ID,
+            ActorID: remote.ID,
+            Inbox: remote.Inbox,
+            FollowActivityID: activity.ID,
+        })
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error storing remote follower", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+
+        // answer the follow in the background
+        follow := activity
+        go func() {
+            ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Minute)
+            defer cancel()
+            key, _, err := cfg.actorKey(ctx, base, user.ID)
+            if err != nil {
+                slog.ErrorContext(ctx, "Error getting actor key", "user_id", user.ID, "err", err)
+                return
+            }
+            accept := activitypub.NewActivity(local+"#accepts/"+uuid.NewString(), "Accept", local, follow)
+            if err := activitypub.Deliver(ctx, cfg.fedClient, remote.Inbox, key, accept); err != nil {
+                slog.ErrorContext(ctx, "Error delivering Accept", "inbox", remote.Inbox, "err", err)
+            }
+        }()
+
+    case "Undo":
+        if activitypub.ObjectField(activity.Object, "type") != "Follow" {
+            // nothing else can be undone yet
+            break
+        }
+        err = cfg.dbQueries.RemoveRemoteFollower(r.Context(), database.RemoveRemoteFollowerParams{
+            UserID: user.ID,
+            ActorID: remote.ID,
+        })
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error removing remote follower", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+
+    default:
+        slog.InfoContext(r.Context(), "Ignoring activity", "type", activity.Type, "remote_id", remote.ID)
+    }
+
+    w.WriteHeader(202)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/activitypub"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestSameHTTPSHost(t *testing.T) {
+    tests := []struct {
+        a, b string
+        want bool
+    }{
+        {"https://social.example/users/alice#main-key", "https://social.example/users/alice", true},
+        {"https://Social.Example/users/alice", "https://social.example/inbox", true},
+        {"https://social.example/users/alice", "https://evil.example/users/alice", false},
+        {"https://social.example:8443/users/alice", "https://social.example/users/alice", false},
+        {"http://social.example/users/alice", "http://social.example/users/alice", false},
+        {"https://social.example/users/alice", "http://social.example/users/alice", false},
+        {"/users/alice", "https://social.example/users/alice", false},
+        {"", "", false},
+    }
+    for _, tt := range tests {
+        if got := sameHTTPSHost(tt.a, tt.b); got != tt.want {
+            t.Errorf("sameHTTPSHost(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+        }
+    }
+}
+
+// a remote server with one actor, alice, the actor document can be changed per test
+type inboxRemote struct {
+    server  *httptest.Server
+    key     *activitypub.Key
+    mu      sync.Mutex
+    fetched int
+    doc     func(actor *activitypub.Actor)
+    accepts chan activitypub.Activity
+}
+
+func newInboxRemote(t *testing.T) *inboxRemote {
+    t.Helper()
+    f := &inboxRemote{accepts: make(chan activitypub.Activity, 1)}
+    privatePem, publicPem, err := activitypub.GenerateKeyPair()
+    if err != nil {
+        t.Fatalf("Couldn't generate key pair: %v", err)
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /users/alice", func(w http.ResponseWriter, r *http.Request) {
+        f.mu.Lock()
+        defer f.mu.Unlock()
+        f.fetched++
+        actor := activitypub.NewActor(f.alice(), "alice", publicPem)
+        if f.doc != nil {
+            f.doc(&actor)
+        }
+        w.Header().Set("Content-Type", activitypub.ContentType)
+        json.NewEncoder(w).Encode(actor)
+    })
+    mux.HandleFunc("POST /users/alice/inbox", func(w http.ResponseWriter, r *http.Request) {
+        activity, _, _ := activitypub.ReadActivity(r)
+        f.accepts <- activity
+        w.WriteHeader(202)
+    })
+    f.server = httptest.NewTLSServer(mux)
+    t.Cleanup(f.server.Close)
+
+    f.key, err = activitypub.ParsePrivateKey(f.alice()+"#main-key", privatePem)
+    if err != nil {
+        t.Fatalf("Couldn't parse private key: %v", err)
+    }
+    return f
+}
+
+func (f *inboxRemote) alice() string {
+    return f.server.URL + "/users/alice"
+}
+
+// an activity from alice posted to the inbox of userID, signed with key unless nil
+func (f *inboxRemote) post(t *testing.T, cfg *apiConfig, userID uuid.UUID, activity activitypub.Activity, key *activitypub.Key) *httptest.ResponseRecorder {
+    t.Helper()
+    body, _ := json.Marshal(activity)
+    req := httptest.NewRequest("POST", "/ap/users/"+userID.String()+"/inbox", bytes.NewReader(body))
+    req.Header.Set("Content-Type", activitypub.ContentType)
+    if key != nil {
+        if err := activitypub.Sign(req, key, body); err != nil {
+            t.Fatalf("Couldn't sign: %v", err)
+        }
+    }
+    mux := http.NewServeMux()
+    mux.HandleFunc("POST /ap/users/{userID}/inbox", cfg.post_inbox)
+    rec := httptest.NewRecorder()
+    mux.ServeHTTP(rec, req)
+    return rec
+}
+
+func TestPostInbox(t *testing.T) {
+    otherPrivatePem, _, err := activitypub.GenerateKeyPair()
+    if err != nil {
+        t.Fatalf("Couldn't generate key pair: %v", err)
+    }
+
+    tests := []struct {
+        name string
+        // the key the request is signed with, alice's by default
+        key      func(f *inboxRemote) *activitypub.Key
+        unsigned bool
+        doc      func(f *inboxRemote) func(actor *activitypub.Actor)
+        object   func(local string) string
+        status   int
+        // if alice's document had to be fetched
+        fetched  bool
+    }{
+        {name: "follow", status: 202, fetched: true},
+        {name: "unsigned", unsigned: true, status: 401},
+        {name: "key on another host", status: 401,
+            key: func(f *inboxRemote) *activitypub.Key {
+                key, _ := activitypub.ParsePrivateKey(strings.Replace(f.alice(), "127.0.0.1", "localhost", 1)+"#main-key", otherPrivatePem)
+                return key
+            }},
+        {name: "signed with another key", status: 401, fetched: true,
+            key: func(f *inboxRemote) *activitypub.Key {
+                key, _ := activitypub.ParsePrivateKey(f.alice()+"#main-key", otherPrivatePem)
+                return key
+            }},
+        {name: "document of another actor", status: 401, fetched: true,
+            doc: func(f *inboxRemote) func(actor *activitypub.Actor) {
+                return func(actor *activitypub.Actor) { actor.ID = f.server.URL + "/users/mallory" }
+            }},
+        {name: "inbox on another host", status: 400, fetched: true,
+            doc: func(f *inboxRemote) func(actor *activitypub.Actor) {
+                return func(actor *activitypub.Actor) { actor.Inbox = "https://internal.example/inbox" }
+            }},
+        {name: "follow of another actor", status: 400, fetched: true,
+            object: func(string) string { return "https://chirpy.test/ap/users/" + uuid.NewString() }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            cfg.base_url = "https://chirpy.test"
+            user := testUser(fake, "user")
+            remote := newInboxRemote(t)
+            cfg.fedClient = remote.server.Client()
+            if tt.doc != nil {
+                remote.doc = tt.doc(remote)
+            }
+            privatePem, publicPem, _ := activitypub.GenerateKeyPair()
+            fake.answer("GetActorKey", database.ActorKey{UserID: user.ID, PublicKeyPem: publicPem, PrivateKeyPem: privatePem})
+
+            local := actorURL(cfg.baseURL(), user.ID)
+            object := local
+            if tt.object != nil {
+                object = tt.object(local)
+            }
+            follow := activitypub.NewActivity(remote.alice()+"#follows/1", "Follow", remote.alice(), object)
+            key := remote.key
+            if tt.key != nil {
+                key = tt.key(remote)
+            }
+            if tt.unsigned {
+                key = nil
+            }
+
+            rec := remote.post(t, cfg, user.ID, follow, key)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            if fetched := remote.fetched > 0; fetched != tt.fetched {
+                t.Errorf("Fetched alice: %v, want %v", fetched, tt.fetched)
+            }
+
+            added := fake.called("AddRemoteFollower")
+            if tt.status != 202 {
+                if len(added) != 0 {
+                    t.Errorf("Added a follower: %v", added)
+                }
+                return
+            }
+            if len(added) != 1 || added[0].args[0] != user.ID || added[0].args[1] != remote.alice() || added[0].args[2] != remote.alice()+"/inbox" {
+                t.Fatalf("Got followers %v", added)
+            }
+            select {
+            case accept := <-remote.accepts:
+                if accept.Type != "Accept" || accept.Actor != local {
+                    t.Errorf("Got %+v, want an Accept from %s", accept, local)
+                }
+            case <-time.After(5 * time.Second):
+                t.Errorf("The follow wasn't accepted")
+            }
+        })
+    }
+}
+
+func TestGetOutbox(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    cfg.base_url = "https://chirpy.example"
+    user := testUser(fake, "user")
+    now := time.Now().UTC()
+    note := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: user.ID}
+    rechirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID,
+        RepostOf: uuid.NullUUID{UUID: uuid.New(), Valid: true}}
+    fake.answer("GetLatestChirpsFromUser", []database.Chirp{rechirp, note})
+    fake.answer("CountOriginalChirpsFromUser", int64(120))
+
+    rec := serve(t, "GET /api/users/{userID}/outbox", http.HandlerFunc(cfg.get_outbox), "/api/users/"+user.ID.String()+"/outbox", "", "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    outbox := activitypub.OrderedCollection{}
+    json.Unmarshal(rec.Body.Bytes(), &outbox)
+    // rechirps aren't federated, the total counts every note
+    if outbox.TotalItems != 120 || len(outbox.OrderedItems) != 1 {
+        t.Errorf("Got outbox %+v", outbox)
+    }
+    // only one page is read from the db
+    if calls := fake.called("GetLatestChirpsFromUser"); len(calls) != 1 || calls[0].args[1] != int32(outboxSize) {
+        t.Errorf("Got queries %v", calls)
+    }
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/feed"
+	"github.com/google/uuid"
+)
+
+// entries per feed, newest first
+const feedSize = 50
+
+// public url of the server from BASE_URL, "" when it isn't set
+// never taken from the request, the Host header is up to the client
+func (cfg *apiConfig) baseURL() string {
+    return strings.TrimSuffix(cfg.base_url, "/")
+}
+
+func chirpPermalink(base string, chirpID uuid.UUID) string {
+    return base + "/api/chirps/" + chirpID.String()
+}
+
+// chirps come newest first
+func buildFeed(base string, chirps []database.Chirp) feed.Feed {
+    f := feed.Feed{}
+    for _, c := range chirps {
+        // rechirps have no body, they point to the original
+        body := c.Body
+        if c.RepostOf.Valid {
+            body = "Rechirped " + chirpPermalink(base, c.RepostOf.UUID)
+        }
+        f.Entries = append(f.Entries, feed.Entry{
+            Link: chirpPermalink(base, c.ID),
+            Title: feed.Title(body),
+            Content: body,
+            Author: c.UserID.String(),
+            Published: c.CreatedAt,
+            Updated: c.UpdatedAt,
+        })
+        if c.UpdatedAt.After(f.Updated) {
+            f.Updated = c.UpdatedAt
+        }
+    }
+    return f
+}
+
+// render the feed and answer conditional requests
+// with ETag / Last-Modified so readers don't refetch unchanged feeds
+func writeFeed(w http.ResponseWriter, r *http.Request, f feed.Feed, format string) {
+    var body []byte
+    var err error
+    contentType := feed.AtomContentType
+    if format == "rss" {
+        contentType = feed.RSSContentType
+        body, err = f.RSS()
+    } else {
+        body, err = f.Atom()
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error rendering feed", "format", format, "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    etag := feed.ETag(body)
+    lastModified := f.Updated.UTC().Truncate(time.Second)
+
+    w.Header().Set("ETag", etag)
+    if !lastModified.IsZero() {
+        w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+    }
+    w.Header().Set("Cache-Control", "public, max-age=60")
+
+    if inm := r.Header.Get("If-None-Match"); inm != "" {
+        for _, tag := range strings.Split(inm, ",") {
+            tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+            if tag == etag || tag == "*" {
+                w.WriteHeader(http.StatusNotModified)
+                return
+            }
+        }
+    } else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+        since, err := http.ParseTime(ims)
+        if err == nil && !lastModified.After(since) {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+    }
+
+    w.Header().Set("Content-Type", contentType)
+    w.WriteHeader(200)
+    w.Write(body)
+}
+
+// format from the last path segment, feed.atom or feed.rss
+func feedFormat(r *http.Request) string {
+    if strings.HasSuffix(r.URL.Path, ".rss") {
+        return "rss"
+    }
+    return "atom"
+}
+
+// global timeline feed
+func (cfg *apiConfig) get_global_feed(w http.ResponseWriter, r *http.Request) {
+    chirps, err := cfg.dbQueries.GetLatestChirps(r.Context(), feedSize)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error while getting chirps", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    format := feedFormat(r)
+    base := cfg.baseURL()
+    f := buildFeed(base, chirps)
+    f.Title = "Chirpy"
+    f.Description = "Latest chirps on Chirpy"
+    f.Link = base + "/api/chirps"
+    f.SelfLink = base + "/api/feed." + format
+
+    writeFeed(w, r, f, format)
+}
+
+// feed of a single author
+func (cfg *apiConfig) get_user_feed(w http.ResponseWriter, r *http.Request) {
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Invalid user id for feed", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        slog.InfoContext(r.Context(), "User not found for feed", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    chirps, err := cfg.dbQueries.GetLatestChirpsFromUser(r.Context(), database.GetLatestChirpsFromUserParams{
+        UserID: user.ID,
+        Limit: feedSize,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error while getting chirps from user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    format := feedFormat(r)
+    base := cfg.baseURL()
+    f := buildFeed(base, chirps)
+    name := userDisplayName(user)
+    for i := range f.Entries {
+        f.Entries[i].Author = name
+    }
+    f.Title = "Chirps by " + name
+    f.Description = user.Bio
+    if f.Description == "" {
+        f.Description = "Latest chirps by " + name
+    }
+    f.Link = base + "/api/chirps?author_id=" + user.ID.String()
+    f.SelfLink = base + "/api/users/" + user.ID.String() + "/feed." + format
+    // an empty feed still changes when the user does
+    if f.Updated.IsZero() {
+        f.Updated = user.UpdatedAt
+    }
+
+    writeFeed(w, r, f, format)
+}
@@ -0,0 +1,262 @@
+// Package activitypub has the pieces of the ActivityPub protocol
+// needed to let fediverse servers follow Chirpy users:
+// actor documents, activities, webfinger and HTTP Signatures
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+    ContentType   = "application/activity+json"
+    LDContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+    JRDContentType = "application/jrd+json"
+    PublicAddress = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// max size of a remote document or incoming activity
+const maxBodySize = 1 << 20
+
+var defaultContext = []string{
+    "https://www.w3.org/ns/activitystreams",
+    "https://w3id.org/security/v1",
+}
+
+type PublicKey struct {
+    ID           string `json:"id"`
+    Owner        string `json:"owner"`
+    PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Image struct {
+    Type string `json:"type"`
+    URL  string `json:"url"`
+}
+
+type Actor struct {
+    Context           any       `json:"@context,omitempty"`
+    ID                string    `json:"id"`
+    Type              string    `json:"type"`
+    PreferredUsername string    `json:"preferredUsername"`
+    Name              string    `json:"name,omitempty"`
+    Summary           string    `json:"summary,omitempty"`
+    URL               string    `json:"url,omitempty"`
+    Inbox             string    `json:"inbox"`
+    Outbox            string    `json:"outbox,omitempty"`
+    Followers         string    `json:"followers,omitempty"`
+    Icon              *Image    `json:"icon,omitempty"`
+    PublicKey         PublicKey `json:"publicKey"`
+}
+
+func NewActor(id, username string, publicKeyPem string) Actor {
+    return Actor{
+        Context: defaultContext,
+        ID: id,
+        Type: "Person",
+        PreferredUsername: username,
+        Inbox: id + "/inbox",
+        Outbox: id + "/outbox",
+        Followers: id + "/followers",
+        PublicKey: PublicKey{
+            ID: id + "#main-key",
+            Owner: id,
+            PublicKeyPem: publicKeyPem,
+        },
+    }
+}
+
+type Note struct {
+    ID           string   `json:"id"`
+    Type         string   `json:"type"`
+    AttributedTo string   `json:"attributedTo,omitempty"`
+    Content      string   `json:"content,omitempty"`
+    URL          string   `json:"url,omitempty"`
+    Published    string   `json:"published,omitempty"`
+    InReplyTo    string   `json:"inReplyTo,omitempty"`
+    To           []string `json:"to,omitempty"`
+    Cc           []string `json:"cc,omitempty"`
+}
+
+// Activity is used both for outgoing and incoming activities,
+// incoming objects may be a plain id or an embedded object
+type Activity struct {
+    Context   any      `json:"@context,omitempty"`
+    ID        string   `json:"id"`
+    Type      string   `json:"type"`
+    Actor     string   `json:"actor"`
+    Object    any      `json:"object"`
+    Published string   `json:"published,omitempty"`
+    To        []string `json:"to,omitempty"`
+    Cc        []string `json:"cc,omitempty"`
+}
+
+func NewActivity(id, activityType, actor string, object any) Activity {
+    return Activity{
+        Context: "https://www.w3.org/ns/activitystreams",
+        ID: id,
+        Type: activityType,
+        Actor: actor,
+        Object: object,
+    }
+}
+
+// ObjectID returns the id of an object that may be embedded or referenced
+func ObjectID(object any) string {
+    switch o := object.(type) {
+    case string:
+        return o
+    case map[string]any:
+        id, _ := o["id"].(string)
+        return id
+    }
+    return ""
+}
+
+// ObjectField returns a string field of an embedded object
+func ObjectField(object any, field string) string {
+    if o, ok := object.(map[string]any); ok {
+        v, _ := o[field].(string)
+        return v
+    }
+    return ""
+}
+
+type OrderedCollection struct {
+    Context      any    `json:"@context,omitempty"`
+    ID           string `json:"id"`
+    Type         string `json:"type"`
+    TotalItems   int    `json:"totalItems"`
+    OrderedItems []any  `json:"orderedItems,omitempty"`
+}
+
+func NewOrderedCollection(id string, total int, items []any) OrderedCollection {
+    return OrderedCollection{
+        Context: "https://www.w3.org/ns/activitystreams",
+        ID: id,
+        Type: "OrderedCollection",
+        TotalItems: total,
+        OrderedItems: items,
+    }
+}
+
+// webfinger, RFC 7033
+type WebFingerLink struct {
+    Rel  string `json:"rel"`
+    Type string `json:"type,omitempty"`
+    Href string `json:"href"`
+}
+
+type WebFinger struct {
+    Subject string          `json:"subject"`
+    Aliases []string        `json:"aliases,omitempty"`
+    Links   []WebFingerLink `json:"links"`
+}
+
+func NewWebFinger(subject, actorID, profileURL string) WebFinger {
+    return WebFinger{
+        Subject: subject,
+        Aliases: []string{actorID},
+        Links: []WebFingerLink{
+            {Rel: "self", Type: ContentType, Href: actorID},
+            {Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: profileURL},
+        },
+    }
+}
+
+// ParseAcct splits "acct:user@domain" (acct: is optional)
+func ParseAcct(resource string) (string, string, error) {
+    resource = strings.TrimPrefix(resource, "acct:")
+    user, domain, found := strings.Cut(resource, "@")
+    if !found || user == "" || domain == "" {
+        return "", "", fmt.Errorf("invalid acct resource: %s", resource)
+    }
+    return user, domain, nil
+}
+
+// IsActivityRequest tells if the client asked for an ActivityPub document
+func IsActivityRequest(r *http.Request) bool {
+    accept := r.Header.Get("Accept")
+    return strings.Contains(accept, "application/activity+json") ||
+        strings.Contains(accept, "application/ld+json")
+}
+
+// FetchActor gets a remote actor document
+func FetchActor(ctx context.Context, client *http.Client, actorID string) (Actor, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, actorID, nil)
+    if err != nil {
+        return Actor{}, err
+    }
+    req.Header.Set("Accept", ContentType)
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return Actor{}, fmt.Errorf("fetching actor %s: %v", actorID, err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return Actor{}, fmt.Errorf("fetching actor %s: status %d", actorID, resp.StatusCode)
+    }
+
+    actor := Actor{}
+    if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&actor); err != nil {
+        return Actor{}, fmt.Errorf("decoding actor %s: %v", actorID, err)
+    }
+    if actor.ID == "" || actor.Inbox == "" {
+        return Actor{}, fmt.Errorf("actor %s has no id or inbox", actorID)
+    }
+    return actor, nil
+}
+
+// Deliver posts a signed activity to a remote inbox
+func Deliver(ctx context.Context, client *http.Client, inbox string, key *Key, activity any) error {
+    body, err := json.Marshal(activity)
+    if err != nil {
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", ContentType)
+    req.Header.Set("Accept", ContentType)
+    req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+    if err := Sign(req, key, body); err != nil {
+        return err
+    }
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return fmt.Errorf("delivering to %s: %v", inbox, err)
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodySize))
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("delivering to %s: status %d", inbox, resp.StatusCode)
+    }
+    return nil
+}
+
+// ReadActivity decodes an incoming activity, returning the raw body
+// too since it is needed to check the digest of the signature.
+// Unknown fields are ignored, every server adds its own extensions
+func ReadActivity(r *http.Request) (Activity, []byte, error) {
+    body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+    if err != nil {
+        return Activity{}, nil, err
+    }
+    activity := Activity{}
+    if err := json.Unmarshal(body, &activity); err != nil {
+        return Activity{}, nil, err
+    }
+    return activity, body, nil
+}
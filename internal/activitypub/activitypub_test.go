@@ -0,0 +1,165 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fake remote fediverse server, serves an actor
+// and an inbox that only accepts activities signed by the local actor
+type fakeRemote struct {
+    server   *httptest.Server
+    trusted  *Key
+    mu       sync.Mutex
+    received []Activity
+}
+
+func newFakeRemote(t *testing.T, trusted *Key) *fakeRemote {
+    f := &fakeRemote{trusted: trusted}
+    mux := http.NewServeMux()
+
+    mux.HandleFunc("GET /users/alice", func(w http.ResponseWriter, r *http.Request) {
+        actor := NewActor(f.server.URL+"/users/alice", "alice", "")
+        w.Header().Set("Content-Type", ContentType)
+        json.NewEncoder(w).Encode(actor)
+    })
+
+    mux.HandleFunc("POST /users/alice/inbox", func(w http.ResponseWriter, r *http.Request) {
+        activity, body, err := ReadActivity(r)
+        if err != nil {
+            w.WriteHeader(400)
+            return
+        }
+        if err := Verify(r, body, &f.trusted.Private.PublicKey); err != nil {
+            t.Logf("fake remote rejected delivery: %v", err)
+            w.WriteHeader(401)
+            return
+        }
+        f.mu.Lock()
+        f.received = append(f.received, activity)
+        f.mu.Unlock()
+        w.WriteHeader(202)
+    })
+
+    f.server = httptest.NewServer(mux)
+    return f
+}
+
+func testKey(t *testing.T) *Key {
+    privatePem, publicPem, err := GenerateKeyPair()
+    if err != nil {
+        t.Fatalf("Couldn't generate key pair: %v", err)
+    }
+    key, err := ParsePrivateKey("http://chirpy.test/ap/users/1#main-key", privatePem)
+    if err != nil {
+        t.Fatalf("Couldn't parse private key: %v", err)
+    }
+    public, err := ParsePublicKey(publicPem)
+    if err != nil {
+        t.Fatalf("Couldn't parse public key: %v", err)
+    }
+    if !public.Equal(&key.Private.PublicKey) {
+        t.Fatalf("Public key doesn't match the private key")
+    }
+    return key
+}
+
+func TestSignVerify(t *testing.T) {
+    key := testKey(t)
+    other := testKey(t)
+    body := []byte(`{"type":"Follow"}`)
+
+    newReq := func() *http.Request {
+        req := httptest.NewRequest(http.MethodPost, "http://chirpy.test/ap/users/1/inbox", bytes.NewReader(body))
+        if err := Sign(req, key, body); err != nil {
+            t.Fatalf("Couldn't sign request: %v", err)
+        }
+        return req
+    }
+
+    if err := Verify(newReq(), body, &key.Private.PublicKey); err != nil {
+        t.Errorf("Valid signature was rejected: %v", err)
+    }
+
+    if err := Verify(newReq(), []byte(`{"type":"Undo"}`), &key.Private.PublicKey); err == nil {
+        t.Errorf("Tampered body was accepted")
+    }
+
+    if err := Verify(newReq(), body, &other.Private.PublicKey); err == nil {
+        t.Errorf("Signature from another key was accepted")
+    }
+
+    req := newReq()
+    req.URL.Path = "/ap/users/2/inbox"
+    if err := Verify(req, body, &key.Private.PublicKey); err == nil {
+        t.Errorf("Signature for another target was accepted")
+    }
+
+    req = newReq()
+    req.Host = "elsewhere.test"
+    if err := Verify(req, body, &key.Private.PublicKey); err == nil {
+        t.Errorf("Signature for another host was accepted")
+    }
+
+    // a signature that leaves the host out could be replayed to any server
+    defer func(headers []string) { signedHeaders = headers }(signedHeaders)
+    signedHeaders = []string{"(request-target)", "date", "digest"}
+    if err := Verify(newReq(), body, &key.Private.PublicKey); err == nil {
+        t.Errorf("Signature without the host was accepted")
+    }
+
+    keyID, err := SignatureKeyID(newReq())
+    if err != nil || keyID != key.ID {
+        t.Errorf("Wrong key id: %s, %v", keyID, err)
+    }
+}
+
+func TestDeliverToFakeRemote(t *testing.T) {
+    key := testKey(t)
+    remote := newFakeRemote(t, key)
+    defer remote.server.Close()
+    ctx := context.Background()
+
+    actor, err := FetchActor(ctx, remote.server.Client(), remote.server.URL+"/users/alice")
+    if err != nil {
+        t.Fatalf("Couldn't fetch remote actor: %v", err)
+    }
+    if actor.Inbox != remote.server.URL+"/users/alice/inbox" {
+        t.Fatalf("Wrong inbox: %s", actor.Inbox)
+    }
+
+    follow := NewActivity(actor.ID+"/follows/1", "Follow", actor.ID, "http://chirpy.test/ap/users/1")
+    accept := NewActivity("http://chirpy.test/ap/users/1#accepts/1", "Accept", "http://chirpy.test/ap/users/1", follow)
+    if err := Deliver(ctx, remote.server.Client(), actor.Inbox, key, accept); err != nil {
+        t.Fatalf("Signed delivery was rejected: %v", err)
+    }
+
+    remote.mu.Lock()
+    defer remote.mu.Unlock()
+    if len(remote.received) != 1 || remote.received[0].Type != "Accept" {
+        t.Fatalf("Remote didn't get the Accept: %+v", remote.received)
+    }
+    if ObjectID(remote.received[0].Object) != follow.ID {
+        t.Errorf("Accept should embed the Follow, got %v", remote.received[0].Object)
+    }
+
+    // deliveries signed with an unknown key must fail
+    if err := Deliver(ctx, remote.server.Client(), actor.Inbox, testKey(t), accept); err == nil {
+        t.Errorf("Delivery signed with another key was accepted")
+    }
+}
+
+func TestParseAcct(t *testing.T) {
+    user, domain, err := ParseAcct("acct:alice@chirpy.test")
+    if err != nil || user != "alice" || domain != "chirpy.test" {
+        t.Errorf("Wrong acct parse: %s %s %v", user, domain, err)
+    }
+    if _, _, err := ParseAcct("acct:alice"); err == nil {
+        t.Errorf("acct without domain was accepted")
+    }
+}
@@ -0,0 +1,244 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP Signatures (draft-cavage-http-signatures-12) with rsa-sha256,
+// as used by Mastodon and most of the fediverse
+
+// headers signed on every delivery
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// how far the Date header of a signed request may drift
+const maxClockSkew = time.Hour
+
+// Key is the private key of a local actor
+type Key struct {
+    // public key id, "<actor>#main-key"
+    ID      string
+    Private *rsa.PrivateKey
+}
+
+// GenerateKeyPair returns a new rsa key pair, pem encoded
+func GenerateKeyPair() (string, string, error) {
+    private, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        return "", "", err
+    }
+
+    privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+    if err != nil {
+        return "", "", err
+    }
+    publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+    if err != nil {
+        return "", "", err
+    }
+
+    privatePem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+    publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+    return string(privatePem), string(publicPem), nil
+}
+
+func ParsePrivateKey(id, privatePem string) (*Key, error) {
+    block, _ := pem.Decode([]byte(privatePem))
+    if block == nil {
+        return nil, fmt.Errorf("invalid private key pem")
+    }
+    parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+        return nil, err
+    }
+    private, ok := parsed.(*rsa.PrivateKey)
+    if !ok {
+        return nil, fmt.Errorf("private key is not rsa")
+    }
+    return &Key{ID: id, Private: private}, nil
+}
+
+func ParsePublicKey(publicPem string) (*rsa.PublicKey, error) {
+    block, _ := pem.Decode([]byte(publicPem))
+    if block == nil {
+        return nil, fmt.Errorf("invalid public key pem")
+    }
+
+    var parsed any
+    var err error
+    switch block.Type {
+    case "RSA PUBLIC KEY":
+        parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+    default:
+        parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+    }
+    if err != nil {
+        return nil, err
+    }
+    public, ok := parsed.(*rsa.PublicKey)
+    if !ok {
+        return nil, fmt.Errorf("public key is not rsa")
+    }
+    return public, nil
+}
+
+func digest(body []byte) string {
+    sum := sha256.Sum256(body)
+    return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func signingString(r *http.Request, headers []string) (string, error) {
+    lines := make([]string, 0, len(headers))
+    for _, h := range headers {
+        switch h {
+        case "(request-target)":
+            lines = append(lines, "(request-target): "+strings.ToLower(r.Method)+" "+r.URL.RequestURI())
+        case "host":
+            host := r.Host
+            if host == "" {
+                host = r.URL.Host
+            }
+            lines = append(lines, "host: "+host)
+        default:
+            v := r.Header.Get(h)
+            if v == "" {
+                return "", fmt.Errorf("signed header %s is missing", h)
+            }
+            lines = append(lines, h+": "+v)
+        }
+    }
+    return strings.Join(lines, "\n"), nil
+}
+
+// Sign adds the Digest and Signature headers to an outgoing request
+func Sign(r *http.Request, key *Key, body []byte) error {
+    if r.Header.Get("Date") == "" {
+        r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+    }
+    r.Header.Set("Digest", digest(body))
+
+    toSign, err := signingString(r, signedHeaders)
+    if err != nil {
+        return err
+    }
+    hashed := sha256.Sum256([]byte(toSign))
+    sig, err := rsa.SignPKCS1v15(rand.Reader, key.Private, crypto.SHA256, hashed[:])
+    if err != nil {
+        return err
+    }
+
+    r.Header.Set("Signature", fmt.Sprintf(
+        `keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+        key.ID,
+        strings.Join(signedHeaders, " "),
+        base64.StdEncoding.EncodeToString(sig),
+    ))
+    return nil
+}
+
+type signature struct {
+    keyID     string
+    headers   []string
+    signature []byte
+}
+
+func parseSignature(r *http.Request) (signature, error) {
+    header := r.Header.Get("Signature")
+    if header == "" {
+        return signature{}, fmt.Errorf("missing Signature header")
+    }
+
+    sig := signature{headers: []string{"date"}}
+    for _, part := range strings.Split(header, ",") {
+        k, v, found := strings.Cut(strings.TrimSpace(part), "=")
+        if !found {
+            continue
+        }
+        v = strings.Trim(v, `"`)
+        switch k {
+        case "keyId":
+            sig.keyID = v
+        case "headers":
+            sig.headers = strings.Fields(strings.ToLower(v))
+        case "signature":
+            decoded, err := base64.StdEncoding.DecodeString(v)
+            if err != nil {
+                return signature{}, fmt.Errorf("invalid signature encoding")
+            }
+            sig.signature = decoded
+        }
+    }
+    if sig.keyID == "" || len(sig.signature) == 0 {
+        return signature{}, fmt.Errorf("incomplete Signature header")
+    }
+    return sig, nil
+}
+
+// SignatureKeyID returns the key id an incoming request was signed with
+func SignatureKeyID(r *http.Request) (string, error) {
+    sig, err := parseSignature(r)
+    if err != nil {
+        return "", err
+    }
+    return sig.keyID, nil
+}
+
+// Verify checks the signature of an incoming request and
+// that the digest matches the body
+func Verify(r *http.Request, body []byte, public *rsa.PublicKey) error {
+    sig, err := parseSignature(r)
+    if err != nil {
+        return err
+    }
+
+    required := map[string]bool{"(request-target)": false, "host": false, "date": false}
+    for _, h := range sig.headers {
+        if _, ok := required[h]; ok {
+            required[h] = true
+        }
+    }
+    if r.Method == http.MethodPost {
+        required["digest"] = false
+        for _, h := range sig.headers {
+            if h == "digest" {
+                required["digest"] = true
+            }
+        }
+    }
+    for h, signed := range required {
+        if !signed {
+            return fmt.Errorf("header %s is not signed", h)
+        }
+    }
+
+    date, err := http.ParseTime(r.Header.Get("Date"))
+    if err != nil {
+        return fmt.Errorf("invalid Date header")
+    }
+    if time.Since(date).Abs() > maxClockSkew {
+        return fmt.Errorf("Date header is out of range")
+    }
+
+    if r.Method == http.MethodPost && r.Header.Get("Digest") != digest(body) {
+        return fmt.Errorf("digest does not match the body")
+    }
+
+    toVerify, err := signingString(r, sig.headers)
+    if err != nil {
+        return err
+    }
+    hashed := sha256.Sum256([]byte(toVerify))
+    if err := rsa.VerifyPKCS1v15(public, crypto.SHA256, hashed[:], sig.signature); err != nil {
+        return fmt.Errorf("invalid signature")
+    }
+    return nil
+}
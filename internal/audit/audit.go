@@ -0,0 +1,214 @@
+// Package audit records security relevant events in an append-only table,
+// every entry is chained to the one before it by a hash
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+// event types
+const (
+    UserLogin             = "user.login"
+    PasswordChanged       = "user.password_changed"
+    PasswordResetRequired = "user.password_reset_required"
+    PasswordReset         = "user.password_reset"
+    RoleChanged           = "user.role_changed"
+    UserSuspended         = "user.suspended"
+    UserUnsuspended       = "user.unsuspended"
+    TokenRevoked          = "token.revoked"
+    SubscriptionChanged   = "subscription.changed"
+    ChirpDeleted          = "chirp.deleted"
+    // a user without the role trying an admin endpoint
+    AdminAccess = "admin.access"
+)
+
+// outcomes
+const (
+    Success = "success"
+    Failure = "failure"
+    // the request was valid but not allowed
+    Denied = "denied"
+)
+
+// Event is what happened, who did it and to what
+type Event struct {
+    Type string
+    // uuid.Nil for anonymous requests
+    ActorID    uuid.UUID
+    TargetType string
+    TargetID   string
+    IP         string
+    UserAgent  string
+    Outcome    string
+    Detail     string
+}
+
+// Entry is a recorded event
+type Entry struct {
+    Event
+    Seq       int64
+    ID        uuid.UUID
+    CreatedAt time.Time
+    PrevHash  string
+    Hash      string
+}
+
+// Log appends to and reads the audit_log table
+type Log struct {
+    db   *sql.DB
+    q    *database.Queries
+    wrap func(database.DBTX) database.DBTX
+}
+
+// wrap, when not nil, is put around every connection and transaction
+// the log queries through, e.g. to time them
+func New(db *sql.DB, wrap func(database.DBTX) database.DBTX) *Log {
+    if wrap == nil {
+        wrap = func(d database.DBTX) database.DBTX { return d }
+    }
+    return &Log{db: db, q: database.New(wrap(db)), wrap: wrap}
+}
+
+// Record appends an event to the chain
+// appends are serialized by a transaction lock, so the chain never forks
+func (l *Log) Record(ctx context.Context, e Event) (Entry, error) {
+    tx, err := l.db.BeginTx(ctx, nil)
+    if err != nil {
+        return Entry{}, err
+    }
+    defer tx.Rollback()
+    qtx := database.New(l.wrap(tx))
+
+    if err := qtx.LockAuditLog(ctx); err != nil {
+        return Entry{}, err
+    }
+    prev, err := qtx.GetLastAuditHash(ctx)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        return Entry{}, err
+    }
+
+    entry := Entry{
+        Event: e,
+        ID: uuid.New(),
+        // postgres keeps microseconds, the hash has to match what's read back
+        CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+        PrevHash: prev,
+    }
+    entry.Hash = Hash(entry)
+
+    row, err := qtx.InsertAuditEntry(ctx, database.InsertAuditEntryParams{
+        ID: entry.ID,
+        CreatedAt: entry.CreatedAt,
+        EventType: e.Type,
+        ActorID: uuid.NullUUID{UUID: e.ActorID, Valid: e.ActorID != uuid.Nil},
+        TargetType: e.TargetType,
+        TargetID: e.TargetID,
+        Ip: e.IP,
+        UserAgent: e.UserAgent,
+        Outcome: e.Outcome,
+        Detail: e.Detail,
+        PrevHash: entry.PrevHash,
+        Hash: entry.Hash,
+    })
+    if err != nil {
+        return Entry{}, err
+    }
+    if err := tx.Commit(); err != nil {
+        return Entry{}, err
+    }
+    return toEntry(row), nil
+}
+
+// Filter for Query, zero values match everything
+type Filter struct {
+    Type     string
+    ActorID  uuid.UUID
+    TargetID string
+    // only entries before this sequence number, for paging
+    BeforeSeq int64
+    Limit     int32
+}
+
+// Query returns matching entries, last recorded first
+func (l *Log) Query(ctx context.Context, f Filter) ([]Entry, error) {
+    params := database.GetAuditEntriesParams{
+        EventType: f.Type,
+        TargetID: f.TargetID,
+        BeforeSeq: f.BeforeSeq,
+        RowLimit: f.Limit,
+    }
+    if f.ActorID != uuid.Nil {
+        params.ActorID = f.ActorID.String()
+    }
+    if params.BeforeSeq <= 0 {
+        params.BeforeSeq = 1<<63 - 1
+    }
+    if params.RowLimit <= 0 {
+        params.RowLimit = 50
+    }
+
+    rows, err := l.q.GetAuditEntries(ctx, params)
+    if err != nil {
+        return nil, err
+    }
+    entries := make([]Entry, 0, len(rows))
+    for _, row := range rows {
+        entries = append(entries, toEntry(row))
+    }
+    return entries, nil
+}
+
+// how many entries Verify reads at once
+const verifyBatch = 1000
+
+// Verify walks the whole chain from the first entry
+// removing entries from the end can't be detected this way,
+// compare LastHash with a copy kept somewhere else for that
+func (l *Log) Verify(ctx context.Context) (Result, error) {
+    res := Result{OK: true}
+    var after int64
+    for {
+        rows, err := l.q.GetAuditChain(ctx, database.GetAuditChainParams{
+            Seq: after,
+            Limit: verifyBatch,
+        })
+        if err != nil {
+            return res, err
+        }
+        entries := make([]Entry, 0, len(rows))
+        for _, row := range rows {
+            entries = append(entries, toEntry(row))
+        }
+
+        if !res.verify(entries) || len(rows) < verifyBatch {
+            return res, nil
+        }
+        after = rows[len(rows)-1].Seq
+    }
+}
+
+func toEntry(row database.AuditLog) Entry {
+    return Entry{
+        Event: Event{
+            Type: row.EventType,
+            ActorID: row.ActorID.UUID,
+            TargetType: row.TargetType,
+            TargetID: row.TargetID,
+            IP: row.Ip,
+            UserAgent: row.UserAgent,
+            Outcome: row.Outcome,
+            Detail: row.Detail,
+        },
+        Seq: row.Seq,
+        ID: row.ID,
+        CreatedAt: row.CreatedAt,
+        PrevHash: row.PrevHash,
+        Hash: row.Hash,
+    }
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// the hashed fields of an entry, in a fixed order
+type hashedEntry struct {
+    PrevHash   string `json:"prev_hash"`
+    ID         string `json:"id"`
+    CreatedAt  string `json:"created_at"`
+    Type       string `json:"type"`
+    ActorID    string `json:"actor_id"`
+    TargetType string `json:"target_type"`
+    TargetID   string `json:"target_id"`
+    IP         string `json:"ip"`
+    UserAgent  string `json:"user_agent"`
+    Outcome    string `json:"outcome"`
+    Detail     string `json:"detail"`
+}
+
+// Hash of an entry and the hash of the one before it, hex encoded
+// Seq is left out, postgres sequences can skip numbers
+func Hash(e Entry) string {
+    data, _ := json.Marshal(hashedEntry{
+        PrevHash: e.PrevHash,
+        ID: e.ID.String(),
+        CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+        Type: e.Type,
+        ActorID: e.ActorID.String(),
+        TargetType: e.TargetType,
+        TargetID: e.TargetID,
+        IP: e.IP,
+        UserAgent: e.UserAgent,
+        Outcome: e.Outcome,
+        Detail: e.Detail,
+    })
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+// Result of a chain verification
+type Result struct {
+    OK      bool   `json:"ok"`
+    Checked int64  `json:"checked"`
+    // hash of the last valid entry
+    LastHash string `json:"last_hash"`
+    // first entry that doesn't match, 0 if OK
+    BrokenSeq int64 `json:"broken_seq,omitempty"`
+}
+
+// continue the verification with the next entries, in order
+// false once the chain is broken
+func (r *Result) verify(entries []Entry) bool {
+    for _, e := range entries {
+        if e.PrevHash != r.LastHash || Hash(e) != e.Hash {
+            r.OK = false
+            r.BrokenSeq = e.Seq
+            return false
+        }
+        r.Checked++
+        r.LastHash = e.Hash
+    }
+    return true
+}
+
+// VerifyChain checks entries starting from the first one ever recorded
+func VerifyChain(entries []Entry) Result {
+    res := Result{OK: true}
+    res.verify(entries)
+    return res
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// a chain built the way Record does it
+func testChain(n int) []Entry {
+    entries := []Entry{}
+    prev := ""
+    for i := 0; i < n; i++ {
+        e := Entry{
+            Event: Event{
+                Type: UserLogin,
+                ActorID: uuid.New(),
+                TargetType: "user",
+                IP: "203.0.113.7",
+                Outcome: Success,
+            },
+            Seq: int64(i + 1),
+            ID: uuid.New(),
+            CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+            PrevHash: prev,
+        }
+        e.Hash = Hash(e)
+        prev = e.Hash
+        entries = append(entries, e)
+    }
+    return entries
+}
+
+func TestVerifyChain(t *testing.T) {
+    entries := testChain(5)
+    res := VerifyChain(entries)
+    if !res.OK || res.Checked != 5 || res.LastHash != entries[4].Hash {
+        t.Fatalf("Expected a valid chain, got %+v", res)
+    }
+    if res := VerifyChain(nil); !res.OK || res.Checked != 0 {
+        t.Errorf("Expected an empty chain to be valid, got %+v", res)
+    }
+}
+
+func TestVerifyChainTampering(t *testing.T) {
+    edited := testChain(5)
+    edited[2].Outcome = Failure
+    if res := VerifyChain(edited); res.OK || res.BrokenSeq != 3 || res.Checked != 2 {
+        t.Errorf("Expected an edited entry to break the chain at 3, got %+v", res)
+    }
+
+    // rehashing the edited entry still breaks the link to the next one
+    rehashed := testChain(5)
+    rehashed[2].Detail = "covered up"
+    rehashed[2].Hash = Hash(rehashed[2])
+    if res := VerifyChain(rehashed); res.OK || res.BrokenSeq != 4 {
+        t.Errorf("Expected a rehashed entry to break the chain at 4, got %+v", res)
+    }
+
+    removed := testChain(5)
+    removed = append(removed[:1], removed[2:]...)
+    if res := VerifyChain(removed); res.OK || res.BrokenSeq != 3 {
+        t.Errorf("Expected a removed entry to break the chain at 3, got %+v", res)
+    }
+}
+
+func TestHashIgnoresTimezone(t *testing.T) {
+    e := testChain(1)[0]
+    // lib/pq may read the timestamp back in another location
+    e.CreatedAt = e.CreatedAt.In(time.FixedZone("", 0))
+    if Hash(e) != e.Hash {
+        t.Error("Expected the same instant to hash the same")
+    }
+}
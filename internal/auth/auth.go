@@ -4,7 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -14,7 +14,7 @@ import (
 func HahsPassword(passw string) (string, error) {
     hashedP, err := bcrypt.GenerateFromPassword(([]byte)(passw), 5)
     if err != nil {
-        log.Printf("Error hashing the password: %v", err)
+        slog.Error("Error hashing the password", "err", err)
     }
 
     return (string)(hashedP), nil
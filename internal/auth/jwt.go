@@ -2,26 +2,43 @@ package auth
 
 import (
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// claims of the access tokens
+// the role is there for clients to read, the admin endpoints check
+// the one in the db so a revoked role stops working right away
+type Claims struct {
+    jwt.RegisteredClaims
+    Role string `json:"role,omitempty"`
+}
+
+// a token with the plain user role
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+    return MakeJWTWithRole(userID, RoleUser, tokenSecret, expiresIn)
+}
+
+func MakeJWTWithRole(userID uuid.UUID, role, tokenSecret string, expiresIn time.Duration) (string, error) {
     token := jwt.NewWithClaims(
         jwt.SigningMethodHS256,
-        jwt.RegisteredClaims{
-            Issuer: "chirpy",
-            IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-            ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-            Subject: userID.String(),
+        Claims{
+            RegisteredClaims: jwt.RegisteredClaims{
+                Issuer: "chirpy",
+                IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+                ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+                Subject: userID.String(),
+            },
+            Role: role,
         },
     )
 
     tokenString, err := token.SignedString(([]byte)(tokenSecret))
     if err != nil {
-        fmt.Printf("\nError at MakeJWT: %v\n", err)
+        slog.Error("Error at MakeJWT", "err", err)
         return "", fmt.Errorf("error while creating jwt")
     }
 
@@ -29,9 +46,22 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+    id, _, err := ValidateJWTWithExpiry(tokenString, tokenSecret)
+    return id, err
+}
+
+// same as ValidateJWT, but also returns when the token expires
+// used by long lived connections that must close on expiration
+func ValidateJWTWithExpiry(tokenString, tokenSecret string) (uuid.UUID, time.Time, error) {
+    id, exp, _, err := parseJWT(tokenString, tokenSecret)
+    return id, exp, err
+}
+
+func parseJWT(tokenString, tokenSecret string) (uuid.UUID, time.Time, *Claims, error) {
+    claims := &Claims{}
     token, err := jwt.ParseWithClaims(
         tokenString,
-        &jwt.RegisteredClaims{},
+        claims,
         func(token *jwt.Token) (interface{}, error) {
 	        return []byte(tokenSecret), nil
         },
@@ -39,15 +69,20 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 
     if err != nil {
         if err.Error() == "token has invalid claims: token is expired" {
-            return uuid.UUID{}, fmt.Errorf("Expired Token")
+            return uuid.UUID{}, time.Time{}, nil, fmt.Errorf("Expired Token")
         }
-        return uuid.UUID{}, fmt.Errorf("Invalid Token")
+        return uuid.UUID{}, time.Time{}, nil, fmt.Errorf("Invalid Token")
     }
 
     id, err := token.Claims.GetSubject()
     if err != nil {
-        return uuid.UUID{}, fmt.Errorf("Error on Token's Claims")
+        return uuid.UUID{}, time.Time{}, nil, fmt.Errorf("Error on Token's Claims")
+    }
+
+    exp, err := token.Claims.GetExpirationTime()
+    if err != nil || exp == nil {
+        return uuid.UUID{}, time.Time{}, nil, fmt.Errorf("Error on Token's Claims")
     }
 
-    return uuid.MustParse(id), nil
+    return uuid.MustParse(id), exp.Time, claims, nil
 }
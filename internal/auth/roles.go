@@ -0,0 +1,24 @@
+package auth
+
+// roles of the users, each one can do everything the ones before it can
+const (
+    RoleUser      = "user"
+    RoleModerator = "moderator"
+    RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+    RoleUser: 1,
+    RoleModerator: 2,
+    RoleAdmin: 3,
+}
+
+func ValidRole(role string) bool {
+    return roleRank[role] != 0
+}
+
+// HasRole reports if a user with role can do what needs the wanted role
+// unknown roles can't do anything
+func HasRole(role, wanted string) bool {
+    return ValidRole(role) && roleRank[role] >= roleRank[wanted]
+}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestHasRole(t *testing.T) {
+    cases := []struct {
+        role, wanted string
+        allowed      bool
+    }{
+        {RoleAdmin, RoleModerator, true},
+        {RoleAdmin, RoleAdmin, true},
+        {RoleModerator, RoleModerator, true},
+        {RoleModerator, RoleAdmin, false},
+        {RoleUser, RoleModerator, false},
+        {"root", RoleUser, false},
+        {"", RoleUser, false},
+    }
+    for _, c := range cases {
+        if got := HasRole(c.role, c.wanted); got != c.allowed {
+            t.Errorf("HasRole(%q, %q) = %v, want %v", c.role, c.wanted, got, c.allowed)
+        }
+    }
+}
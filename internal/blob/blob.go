@@ -0,0 +1,115 @@
+// Package blob stores uploaded files behind a small interface
+// so the local disk can be swapped for an object store later
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// ErrNotFound is returned when a key has no blob
+var ErrNotFound = errors.New("blob not found")
+
+// keys are flat names, never paths
+var keyRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,127}$`)
+
+// BlobStore keeps blobs by key
+type BlobStore interface {
+    // Put stores everything read from r under key, replacing any previous blob
+    Put(ctx context.Context, key string, r io.Reader) (int64, error)
+    // Open returns the blob stored under key, ErrNotFound if there is none
+    Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+    // Delete removes the blob, deleting a missing key is not an error
+    Delete(ctx context.Context, key string) error
+}
+
+// ValidKey reports if key can be used with a BlobStore
+func ValidKey(key string) bool {
+    return keyRegex.MatchString(key) && key != "." && key != ".."
+}
+
+// LocalStore keeps blobs as files inside a single directory
+type LocalStore struct {
+    dir string
+}
+
+// NewLocalStore creates the directory if needed
+func NewLocalStore(dir string) (*LocalStore, error) {
+    if err := os.MkdirAll(dir, 0o750); err != nil {
+        return nil, err
+    }
+    return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+    if !ValidKey(key) {
+        return "", fmt.Errorf("invalid blob key %q", key)
+    }
+    return filepath.Join(s.dir, key), nil
+}
+
+// Put writes to a temp file first, readers never see a half written blob
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return 0, err
+    }
+
+    tmp, err := os.CreateTemp(s.dir, ".upload-*")
+    if err != nil {
+        return 0, err
+    }
+    defer os.Remove(tmp.Name())
+
+    n, err := io.Copy(tmp, contextReader{ctx, r})
+    if err != nil {
+        tmp.Close()
+        return n, err
+    }
+    if err := tmp.Close(); err != nil {
+        return n, err
+    }
+    return n, os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+    path, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    err = os.Remove(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    return err
+}
+
+// stops long copies once the request is gone
+type contextReader struct {
+    ctx context.Context
+    r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+    if err := c.ctx.Err(); err != nil {
+        return 0, err
+    }
+    return c.r.Read(p)
+}
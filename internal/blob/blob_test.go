@@ -0,0 +1,69 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+    ctx := context.Background()
+    store, err := NewLocalStore(filepath.Join(t.TempDir(), "media"))
+    if err != nil {
+        t.Fatalf("Couldn't create store: %v", err)
+    }
+
+    n, err := store.Put(ctx, "some-key", strings.NewReader("chirp chirp"))
+    if err != nil {
+        t.Fatalf("Couldn't put blob: %v", err)
+    }
+    if n != 11 {
+        t.Errorf("Expected 11 bytes written, got %d", n)
+    }
+
+    f, err := store.Open(ctx, "some-key")
+    if err != nil {
+        t.Fatalf("Couldn't open blob: %v", err)
+    }
+    data, _ := io.ReadAll(f)
+    f.Close()
+    if string(data) != "chirp chirp" {
+        t.Errorf("Expected the stored content, got %q", data)
+    }
+
+    if err := store.Delete(ctx, "some-key"); err != nil {
+        t.Fatalf("Couldn't delete blob: %v", err)
+    }
+    if _, err := store.Open(ctx, "some-key"); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Expected ErrNotFound after delete, got %v", err)
+    }
+    if err := store.Delete(ctx, "some-key"); err != nil {
+        t.Errorf("Deleting a missing blob should not fail: %v", err)
+    }
+}
+
+func TestLocalStoreRejectsPaths(t *testing.T) {
+    ctx := context.Background()
+    dir := t.TempDir()
+    store, err := NewLocalStore(filepath.Join(dir, "media"))
+    if err != nil {
+        t.Fatalf("Couldn't create store: %v", err)
+    }
+
+    for _, key := range []string{"../escape", "a/b", "", ".hidden", "..", "/etc/passwd"} {
+        if _, err := store.Put(ctx, key, strings.NewReader("x")); err == nil {
+            t.Errorf("Expected key %q to be rejected", key)
+        }
+        if _, err := store.Open(ctx, key); err == nil {
+            t.Errorf("Expected open of %q to be rejected", key)
+        }
+    }
+
+    if _, err := os.Stat(filepath.Join(dir, "escape")); err == nil {
+        t.Error("Blob was written outside the store")
+    }
+}
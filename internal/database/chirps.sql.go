@@ -7,29 +7,113 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelScheduledChirp = `-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND publish_at IS NOT NULL
+`
+
+func (q *Queries) CancelScheduledChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelScheduledChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countChirpsFromUser = `-- name: CountChirpsFromUser :one
+SELECT COUNT(*) FROM chirps WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL
+`
+
+func (q *Queries) CountChirpsFromUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsFromUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countOriginalChirpsFromUser = `-- name: CountOriginalChirpsFromUser :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL AND repost_of IS NULL
+`
+
+func (q *Queries) CountOriginalChirpsFromUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countOriginalChirpsFromUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of, in_reply_to)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	QuoteOf   uuid.NullUUID
+	InReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.QuoteOf,
+		arg.InReplyTo,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const createRepost = `-- name: CreateRepost :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, repost_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to
+`
+
+type CreateRepostParams struct {
+	UserID   uuid.UUID
+	RepostOf uuid.NullUUID
+}
+
+func (q *Queries) CreateRepost(ctx context.Context, arg CreateRepostParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRepost, arg.UserID, arg.RepostOf)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,12 +121,68 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const createScheduledChirp = `-- name: CreateScheduledChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, quote_of, in_reply_to)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to
+`
+
+type CreateScheduledChirpParams struct {
+	Body      string
+	UserID    uuid.UUID
+	PublishAt sql.NullTime
+	QuoteOf   uuid.NullUUID
+	InReplyTo uuid.NullUUID
+}
+
+func (q *Queries) CreateScheduledChirp(ctx context.Context, arg CreateScheduledChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createScheduledChirp,
+		arg.Body,
+		arg.UserID,
+		arg.PublishAt,
+		arg.QuoteOf,
+		arg.InReplyTo,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
 	)
 	return i, err
 }
 
 const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
@@ -50,8 +190,65 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteRepost = `-- name: DeleteRepost :exec
+DELETE FROM chirps WHERE id = $1 AND repost_of IS NOT NULL
+`
+
+func (q *Queries) DeleteRepost(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRepost, id)
+	return err
+}
+
+const getAllChirpsFromUser = `-- name: GetAllChirpsFromUser :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY created_at
+`
+
+func (q *Queries) GetAllChirpsFromUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE id = $1 AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+    ))
 `
 
 func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -63,16 +260,32 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = $1)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+            AND originals.user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = $1)
+    ))
+ORDER BY created_at
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +299,53 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -101,11 +361,150 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsFromUser = `-- name: GetChirpsFromUser :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = $2)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+            AND originals.user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = $2)
+    ))
+ORDER BY created_at
+`
+
+type GetChirpsFromUserParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpsFromUser(ctx context.Context, arg GetChirpsFromUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsFromUser, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedChirpByID = `-- name: GetDeletedChirpByID :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) GetDeletedChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getDeletedChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const getLatestChirps = `-- name: GetLatestChirps :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+    ))
+ORDER BY created_at DESC
+LIMIT $1
+`
+
+func (q *Queries) GetLatestChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getLatestChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestChirpsFromUser = `-- name: GetLatestChirpsFromUser :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+    ))
+ORDER BY created_at DESC
+LIMIT $2
 `
 
-func (q *Queries) GetChirpsFromUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsFromUser, userID)
+type GetLatestChirpsFromUserParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+func (q *Queries) GetLatestChirpsFromUser(ctx context.Context, arg GetLatestChirpsFromUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getLatestChirpsFromUser, arg.UserID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +518,12 @@ func (q *Queries) GetChirpsFromUser(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -132,3 +537,277 @@ func (q *Queries) GetChirpsFromUser(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const getRepost = `-- name: GetRepost :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE user_id = $1 AND repost_of = $2 AND deleted_at IS NULL
+`
+
+type GetRepostParams struct {
+	UserID   uuid.UUID
+	RepostOf uuid.NullUUID
+}
+
+func (q *Queries) GetRepost(ctx context.Context, arg GetRepostParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRepost, arg.UserID, arg.RepostOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const getRepostsOf = `-- name: GetRepostsOf :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE repost_of = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetRepostsOf(ctx context.Context, repostOf uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getRepostsOf, repostOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScheduledChirpByID = `-- name: GetScheduledChirpByID :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE id = $1 AND publish_at IS NOT NULL AND deleted_at IS NULL
+`
+
+func (q *Queries) GetScheduledChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getScheduledChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const getScheduledChirpsFromUser = `-- name: GetScheduledChirpsFromUser :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to FROM chirps
+WHERE user_id = $1 AND publish_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY publish_at
+`
+
+func (q *Queries) GetScheduledChirpsFromUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getScheduledChirpsFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideChirp = `-- name: HideChirp :one
+UPDATE chirps
+SET deleted_at = COALESCE(deleted_at, NOW()), hidden_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, hideChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET publish_at = NULL, created_at = publish_at, updated_at = NOW()
+WHERE publish_at IS NOT NULL AND publish_at <= NOW() AND deleted_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL)
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to
+`
+
+func (q *Queries) PublishDueChirps(ctx context.Context) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.PublishAt,
+			&i.RepostOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at IS NOT NULL AND deleted_at < $1 AND hidden_at IS NULL
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rescheduleChirp = `-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $2, updated_at = NOW()
+WHERE id = $1 AND publish_at IS NOT NULL AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to
+`
+
+type RescheduleChirpParams struct {
+	ID        uuid.UUID
+	PublishAt sql.NullTime
+}
+
+func (q *Queries) RescheduleChirp(ctx context.Context, arg RescheduleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, rescheduleChirp, arg.ID, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL AND hidden_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, publish_at, repost_of, quote_of, hidden_at, in_reply_to
+`
+
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.PublishAt,
+		&i.RepostOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+		&i.InReplyTo,
+	)
+	return i, err
+}
@@ -11,12 +11,148 @@ import (
 	"github.com/google/uuid"
 )
 
+type ActorKey struct {
+	UserID        uuid.UUID
+	CreatedAt     time.Time
+	PublicKeyPem  string
+	PrivateKeyPem string
+}
+
+type AuditLog struct {
+	Seq        int64
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	EventType  string
+	ActorID    uuid.NullUUID
+	TargetType string
+	TargetID   string
+	Ip         string
+	UserAgent  string
+	Outcome    string
+	Detail     string
+	PrevHash   string
+	Hash       string
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type Bookmark struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	DeletedAt sql.NullTime
+	PublishAt sql.NullTime
+	RepostOf  uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+	HiddenAt  sql.NullTime
+	InReplyTo uuid.NullUUID
+}
+
+type ChirpAttachment struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int32
+}
+
+type Draft struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Body      string
+}
+
+type HiddenUser struct {
+	ViewerID uuid.UUID
+	UserID   uuid.UUID
+	Blocked  bool
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type LinkPreview struct {
+	Url         string
+	FetchedAt   time.Time
+	Ok          bool
+	Title       string
+	Description string
+	ImageUrl    string
+	SiteName    string
+}
+
+type MediaFile struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UserID          uuid.UUID
+	ContentType     string
+	SizeBytes       int64
+	BlobKey         string
+	Status          string
+	StatusUpdatedAt time.Time
+	Width           int32
+	Height          int32
+	Blurhash        string
+	ProcessingError string
+}
+
+type MediaThumbnail struct {
+	MediaID     uuid.UUID
+	Size        string
+	Width       int32
+	Height      int32
+	ContentType string
+	SizeBytes   int64
+	BlobKey     string
+}
+
+type ModerationAction struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	ModeratorID uuid.UUID
+	Action      string
+	ReportID    uuid.NullUUID
+	ChirpID     uuid.NullUUID
+	UserID      uuid.NullUUID
+	Note        string
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ActorID   uuid.NullUUID
+	Type      string
+	ChirpID   uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	UserID    uuid.UUID
+	Type      string
+	Enabled   bool
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -28,11 +164,50 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type RemoteFollower struct {
+	UserID           uuid.UUID
+	ActorID          string
+	CreatedAt        time.Time
+	Inbox            string
+	FollowActivityID string
+}
+
+type Report struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ReporterID uuid.NullUUID
+	ChirpID    uuid.UUID
+	Reason     string
+	Comment    string
+	Status     string
+	ClaimedBy  uuid.NullUUID
+	ClaimedAt  sql.NullTime
+	ResolvedAt sql.NullTime
+	Resolution string
+}
+
+type SubscriptionEvent struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Event     string
+}
+
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                     uuid.UUID
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	Email                  string
+	HashedPassword         string
+	IsChirpyRed            bool
+	Handle                 sql.NullString
+	DisplayName            string
+	Bio                    string
+	AvatarUrl              string
+	DeletedAt              sql.NullTime
+	SuspendedAt            sql.NullTime
+	SuspensionReason       string
+	Role                   string
+	PasswordResetHash      string
+	PasswordResetExpiresAt sql.NullTime
 }
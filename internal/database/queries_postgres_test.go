@@ -0,0 +1,291 @@
+//go:build postgres
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// these run the sqlc queries against a real postgres,
+// the handler tests use a fake driver that never runs the sql
+//
+//	TEST_DB_URL="postgres://..." go test -tags postgres ./internal/database
+//
+// every test gets its own schema with the migrations applied, dropped afterwards
+
+func testQueries(t *testing.T) (*Queries, *sql.DB) {
+    t.Helper()
+    dbURL := os.Getenv("TEST_DB_URL")
+    if dbURL == "" {
+        t.Skip("TEST_DB_URL is not set")
+    }
+    admin, err := sql.Open("postgres", dbURL)
+    if err != nil {
+        t.Fatalf("Couldn't open db: %v", err)
+    }
+    defer admin.Close()
+
+    schema := "chirpy_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+    if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+        t.Fatalf("Couldn't create schema: %v", err)
+    }
+    t.Cleanup(func() {
+        if db, err := sql.Open("postgres", dbURL); err == nil {
+            db.Exec("DROP SCHEMA " + schema + " CASCADE")
+            db.Close()
+        }
+    })
+
+    // every connection of the pool works in the test's schema
+    u, err := url.Parse(dbURL)
+    if err != nil {
+        t.Fatalf("TEST_DB_URL must be a postgres:// url: %v", err)
+    }
+    query := u.Query()
+    query.Set("search_path", schema)
+    u.RawQuery = query.Encode()
+    db, err := sql.Open("postgres", u.String())
+    if err != nil {
+        t.Fatalf("Couldn't open db: %v", err)
+    }
+    t.Cleanup(func() { db.Close() })
+
+    migrations, err := filepath.Glob("../../sql/schema/*.sql")
+    if err != nil || len(migrations) == 0 {
+        t.Fatalf("No migrations found: %v", err)
+    }
+    sort.Strings(migrations)
+    for _, path := range migrations {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            t.Fatalf("Couldn't read %s: %v", path, err)
+        }
+        // the goose markers are comments, the whole up section runs at once
+        up, _, _ := strings.Cut(string(data), "-- +goose Down")
+        if _, err := db.Exec(up); err != nil {
+            t.Fatalf("Couldn't apply %s: %v", filepath.Base(path), err)
+        }
+    }
+    return New(db), db
+}
+
+func testCreateUser(t *testing.T, q *Queries, name string) User {
+    t.Helper()
+    user, err := q.CreateUser(context.Background(), CreateUserParams{
+        Email: name + "@example.com",
+        HashedPassword: "unused",
+    })
+    if err != nil {
+        t.Fatalf("Couldn't create user %s: %v", name, err)
+    }
+    return user
+}
+
+func testCreateChirp(t *testing.T, q *Queries, user User, body string) Chirp {
+    t.Helper()
+    chirp, err := q.CreateChirp(context.Background(), CreateChirpParams{Body: body, UserID: user.ID})
+    if err != nil {
+        t.Fatalf("Couldn't create chirp %q: %v", body, err)
+    }
+    return chirp
+}
+
+func testCreateRepost(t *testing.T, q *Queries, user User, of Chirp) Chirp {
+    t.Helper()
+    repost, err := q.CreateRepost(context.Background(), CreateRepostParams{
+        UserID: user.ID,
+        RepostOf: uuid.NullUUID{UUID: of.ID, Valid: true},
+    })
+    if err != nil {
+        t.Fatalf("Couldn't rechirp %q: %v", of.Body, err)
+    }
+    return repost
+}
+
+func mustExec(t *testing.T, err error) {
+    t.Helper()
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+// alice is the viewer, the chirps are named after who wrote them
+type visibilityFixture struct {
+    alice, bob, carol, dave, erin, frank User
+    chirps map[string]Chirp
+}
+
+func newVisibilityFixture(t *testing.T, q *Queries) visibilityFixture {
+    t.Helper()
+    ctx := context.Background()
+    f := visibilityFixture{
+        alice: testCreateUser(t, q, "alice"),
+        bob: testCreateUser(t, q, "bob"),
+        // deleted account, in its grace period
+        carol: testCreateUser(t, q, "carol"),
+        // blocked by alice
+        dave: testCreateUser(t, q, "dave"),
+        // muted by alice
+        erin: testCreateUser(t, q, "erin"),
+        // blocked alice
+        frank: testCreateUser(t, q, "frank"),
+        chirps: map[string]Chirp{},
+    }
+
+    f.chirps["bob"] = testCreateChirp(t, q, f.bob, "bob")
+    f.chirps["bob deleted"] = testCreateChirp(t, q, f.bob, "bob deleted")
+    mustExec(t, q.DeleteChirp(ctx, f.chirps["bob deleted"].ID))
+    scheduled, err := q.CreateScheduledChirp(ctx, CreateScheduledChirpParams{
+        Body: "bob scheduled",
+        UserID: f.bob.ID,
+        PublishAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+    })
+    mustExec(t, err)
+    f.chirps["bob scheduled"] = scheduled
+    f.chirps["carol"] = testCreateChirp(t, q, f.carol, "carol")
+    f.chirps["dave"] = testCreateChirp(t, q, f.dave, "dave")
+    f.chirps["erin"] = testCreateChirp(t, q, f.erin, "erin")
+    f.chirps["frank"] = testCreateChirp(t, q, f.frank, "frank")
+    // rechirps follow their original
+    f.chirps["erin rechirps bob"] = testCreateRepost(t, q, f.erin, f.chirps["bob"])
+    f.chirps["bob rechirps bob deleted"] = testCreateRepost(t, q, f.bob, f.chirps["bob deleted"])
+    f.chirps["bob rechirps carol"] = testCreateRepost(t, q, f.bob, f.chirps["carol"])
+    f.chirps["bob rechirps dave"] = testCreateRepost(t, q, f.bob, f.chirps["dave"])
+
+    mustExec(t, q.SoftDeleteUser(ctx, f.carol.ID))
+    mustExec(t, q.BlockUser(ctx, BlockUserParams{BlockerID: f.alice.ID, BlockedID: f.dave.ID}))
+    mustExec(t, q.MuteUser(ctx, MuteUserParams{MuterID: f.alice.ID, MutedID: f.erin.ID}))
+    mustExec(t, q.BlockUser(ctx, BlockUserParams{BlockerID: f.frank.ID, BlockedID: f.alice.ID}))
+    return f
+}
+
+func TestChirpVisibilityQueries(t *testing.T) {
+    q, _ := testQueries(t)
+    ctx := context.Background()
+    f := newVisibilityFixture(t, q)
+
+    tests := []struct {
+        viewer User
+        want   []string
+    }{
+        {f.alice, []string{"bob"}},
+        // nobody is hidden from bob
+        {f.bob, []string{"bob", "dave", "erin", "frank", "erin rechirps bob", "bob rechirps dave"}},
+    }
+    for _, tt := range tests {
+        chirps, err := q.GetChirps(ctx, tt.viewer.ID)
+        if err != nil {
+            t.Fatalf("GetChirps: %v", err)
+        }
+        got := map[uuid.UUID]bool{}
+        for _, c := range chirps {
+            got[c.ID] = true
+        }
+        want := map[string]bool{}
+        for _, name := range tt.want {
+            want[name] = true
+        }
+        for name, c := range f.chirps {
+            if got[c.ID] != want[name] {
+                t.Errorf("%s sees %q: %v, want %v", tt.viewer.Email, name, got[c.ID], want[name])
+            }
+        }
+    }
+
+    // by id, blocks are checked by the handlers, deletion and scheduling here
+    for _, name := range []string{"bob deleted", "bob scheduled", "carol", "bob rechirps bob deleted", "bob rechirps carol"} {
+        if _, err := q.GetChirpByID(ctx, f.chirps[name].ID); !errors.Is(err, sql.ErrNoRows) {
+            t.Errorf("GetChirpByID found %q: %v", name, err)
+        }
+    }
+    if _, err := q.GetChirpByID(ctx, f.chirps["bob"].ID); err != nil {
+        t.Errorf("GetChirpByID: %v", err)
+    }
+}
+
+func TestBookmarkVisibilityAndCursor(t *testing.T) {
+    q, db := testQueries(t)
+    ctx := context.Background()
+    f := newVisibilityFixture(t, q)
+
+    // bookmarked at the same instant, so the cursor has to break ties by chirp id
+    for i := 0; i < 4; i++ {
+        name := fmt.Sprintf("bob %d", i)
+        f.chirps[name] = testCreateChirp(t, q, f.bob, name)
+    }
+    at := time.Now().UTC().Truncate(time.Microsecond)
+    for _, c := range f.chirps {
+        _, err := db.ExecContext(ctx, "INSERT INTO bookmarks (user_id, chirp_id, created_at) VALUES ($1, $2, $3)", f.alice.ID, c.ID, at)
+        mustExec(t, err)
+    }
+
+    // one bookmark per page walks every tie exactly once
+    seen := map[uuid.UUID]int{}
+    params := GetBookmarksParams{UserID: f.alice.ID, RowLimit: 1}
+    for page := 0; page <= len(f.chirps); page++ {
+        rows, err := q.GetBookmarks(ctx, params)
+        if err != nil {
+            t.Fatalf("GetBookmarks: %v", err)
+        }
+        if len(rows) == 0 {
+            break
+        }
+        last := rows[len(rows)-1]
+        seen[last.ID]++
+        params.BeforeCreatedAt = sql.NullTime{Time: last.BookmarkedAt, Valid: true}
+        params.BeforeChirpID = uuid.NullUUID{UUID: last.ID, Valid: true}
+    }
+
+    // muted users stay bookmarked, blocked either way and deleted ones don't
+    want := map[string]int{"bob": 1, "bob 0": 1, "bob 1": 1, "bob 2": 1, "bob 3": 1, "erin": 1, "erin rechirps bob": 1}
+    for _, name := range []string{"bob deleted", "bob scheduled", "carol", "dave", "frank"} {
+        want[name] = 0
+    }
+    for name, n := range want {
+        if got := seen[f.chirps[name].ID]; got != n {
+            t.Errorf("Bookmark of %q listed %d times, want %d", name, got, n)
+        }
+    }
+}
+
+func TestPublishDueChirpsSkipsDeletedAndSuspended(t *testing.T) {
+    q, _ := testQueries(t)
+    ctx := context.Background()
+    active := testCreateUser(t, q, "active")
+    deleted := testCreateUser(t, q, "deleted")
+    suspended := testCreateUser(t, q, "suspended")
+
+    due := map[uuid.UUID]Chirp{}
+    for _, user := range []User{active, deleted, suspended} {
+        chirp, err := q.CreateScheduledChirp(ctx, CreateScheduledChirpParams{
+            Body: "due",
+            UserID: user.ID,
+            PublishAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+        })
+        mustExec(t, err)
+        due[user.ID] = chirp
+    }
+    mustExec(t, q.SoftDeleteUser(ctx, deleted.ID))
+    mustExec(t, q.SuspendUser(ctx, SuspendUserParams{ID: suspended.ID, SuspensionReason: "spam"}))
+
+    published, err := q.PublishDueChirps(ctx)
+    if err != nil {
+        t.Fatalf("PublishDueChirps: %v", err)
+    }
+    if len(published) != 1 || published[0].ID != due[active.ID].ID {
+        t.Errorf("Published %+v, want only the active user's chirp", published)
+    }
+}
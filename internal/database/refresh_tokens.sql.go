@@ -12,6 +12,40 @@ import (
 	"github.com/google/uuid"
 )
 
+const getRTokensFromUser = `-- name: GetRTokensFromUser :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) GetRTokensFromUser(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, getRTokensFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserFromRToken = `-- name: GetUserFromRToken :one
 SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token = $1
 `
@@ -90,3 +124,30 @@ func (q *Queries) RevokeRToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, revokeRToken, token)
 	return err
 }
+
+const revokeUserRTokens = `-- name: RevokeUserRTokens :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserRTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRTokens, userID)
+	return err
+}
+
+const revokeUserRTokensExcept = `-- name: RevokeUserRTokensExcept :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND token <> $2 AND revoked_at IS NULL
+`
+
+type RevokeUserRTokensExceptParams struct {
+	UserID uuid.UUID
+	Token  string
+}
+
+func (q *Queries) RevokeUserRTokensExcept(ctx context.Context, arg RevokeUserRTokensExceptParams) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRTokensExcept, arg.UserID, arg.Token)
+	return err
+}
@@ -0,0 +1,121 @@
+// Package events fans out server side events (new chirps, deletions,
+// notifications) to live subscribers such as websocket connections
+package events
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// event types
+const (
+    ChirpCreated        = "chirp.created"
+    ChirpDeleted        = "chirp.deleted"
+    ChirpUpdated        = "chirp.updated"
+    NotificationCreated = "notification.created"
+)
+
+// channel every public chirp event is published on
+const GlobalChannel = "global"
+
+// AuthorChannel is the channel with the events of a single author
+func AuthorChannel(userID uuid.UUID) string {
+    return "author:" + userID.String()
+}
+
+// NotificationsChannel is the private channel of a user
+func NotificationsChannel(userID uuid.UUID) string {
+    return "notifications:" + userID.String()
+}
+
+type Event struct {
+    Type    string `json:"type"`
+    Channel string `json:"channel"`
+    Data    any    `json:"data"`
+}
+
+// Subscriber receives events through a bounded buffer,
+// a subscriber that can't keep up is flagged as overflowed
+// instead of blocking the publisher
+type Subscriber struct {
+    C        chan Event
+    overflow chan struct{}
+    once     sync.Once
+}
+
+func NewSubscriber(buffer int) *Subscriber {
+    return &Subscriber{
+        C: make(chan Event, buffer),
+        overflow: make(chan struct{}),
+    }
+}
+
+// Overflow is closed when an event had to be dropped for this subscriber
+func (s *Subscriber) Overflow() <-chan struct{} {
+    return s.overflow
+}
+
+func (s *Subscriber) send(ev Event) {
+    select {
+    case s.C <- ev:
+    default:
+        s.once.Do(func() { close(s.overflow) })
+    }
+}
+
+type Hub struct {
+    mu   sync.RWMutex
+    subs map[string]map[*Subscriber]struct{}
+}
+
+func NewHub() *Hub {
+    return &Hub{
+        subs: map[string]map[*Subscriber]struct{}{},
+    }
+}
+
+func (h *Hub) Subscribe(channel string, s *Subscriber) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if h.subs[channel] == nil {
+        h.subs[channel] = map[*Subscriber]struct{}{}
+    }
+    h.subs[channel][s] = struct{}{}
+}
+
+func (h *Hub) Unsubscribe(channel string, s *Subscriber) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    delete(h.subs[channel], s)
+    if len(h.subs[channel]) == 0 {
+        delete(h.subs, channel)
+    }
+}
+
+// UnsubscribeAll removes the subscriber from every channel
+func (h *Hub) UnsubscribeAll(s *Subscriber) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    for channel, subs := range h.subs {
+        delete(subs, s)
+        if len(subs) == 0 {
+            delete(h.subs, channel)
+        }
+    }
+}
+
+// Publish never blocks, slow subscribers get flagged as overflowed
+func (h *Hub) Publish(channel, eventType string, data any) {
+    ev := Event{
+        Type: eventType,
+        Channel: channel,
+        Data: data,
+    }
+
+    h.mu.RLock()
+    defer h.mu.RUnlock()
+    for s := range h.subs[channel] {
+        s.send(ev)
+    }
+}
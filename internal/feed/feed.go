@@ -0,0 +1,189 @@
+// Package feed renders chirps as Atom 1.0 and RSS 2.0 documents
+package feed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"time"
+)
+
+const (
+    AtomContentType = "application/atom+xml; charset=utf-8"
+    RSSContentType  = "application/rss+xml; charset=utf-8"
+)
+
+type Entry struct {
+    // permalink of the chirp, also used as the entry id
+    Link      string
+    Title     string
+    Content   string
+    Author    string
+    Published time.Time
+    Updated   time.Time
+}
+
+type Feed struct {
+    Title       string
+    Description string
+    // html page the feed is about and url of the feed itself
+    Link     string
+    SelfLink string
+    Updated  time.Time
+    Entries  []Entry
+}
+
+// atom 1.0, RFC 4287
+type atomLink struct {
+    Rel  string `xml:"rel,attr,omitempty"`
+    Type string `xml:"type,attr,omitempty"`
+    Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+    Type string `xml:"type,attr"`
+    Body string `xml:",chardata"`
+}
+
+type atomPerson struct {
+    Name string `xml:"name"`
+}
+
+type atomEntry struct {
+    ID        string      `xml:"id"`
+    Title     string      `xml:"title"`
+    Links     []atomLink  `xml:"link"`
+    Published string      `xml:"published"`
+    Updated   string      `xml:"updated"`
+    Author    *atomPerson `xml:"author,omitempty"`
+    Content   atomText    `xml:"content"`
+}
+
+type atomFeed struct {
+    XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+    ID       string      `xml:"id"`
+    Title    string      `xml:"title"`
+    Subtitle string      `xml:"subtitle,omitempty"`
+    Updated  string      `xml:"updated"`
+    Links    []atomLink  `xml:"link"`
+    Entries  []atomEntry `xml:"entry"`
+}
+
+// rss 2.0
+type rssGUID struct {
+    IsPermaLink bool   `xml:"isPermaLink,attr"`
+    Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+    Title       string  `xml:"title"`
+    Link        string  `xml:"link"`
+    Description string  `xml:"description"`
+    Author      string  `xml:"dc:creator,omitempty"`
+    GUID        rssGUID `xml:"guid"`
+    PubDate     string  `xml:"pubDate"`
+}
+
+type rssAtomLink struct {
+    Href string `xml:"href,attr"`
+    Rel  string `xml:"rel,attr"`
+    Type string `xml:"type,attr"`
+}
+
+type rssChannel struct {
+    Title         string      `xml:"title"`
+    Link          string      `xml:"link"`
+    Description   string      `xml:"description"`
+    LastBuildDate string      `xml:"lastBuildDate"`
+    SelfLink      rssAtomLink `xml:"atom:link"`
+    Items         []rssItem   `xml:"item"`
+}
+
+type rssFeed struct {
+    XMLName xml.Name   `xml:"rss"`
+    Version string     `xml:"version,attr"`
+    AtomNS  string     `xml:"xmlns:atom,attr"`
+    DCNS    string     `xml:"xmlns:dc,attr"`
+    Channel rssChannel `xml:"channel"`
+}
+
+func encode(v any) ([]byte, error) {
+    body, err := xml.MarshalIndent(v, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    return append([]byte(xml.Header), body...), nil
+}
+
+func (f Feed) Atom() ([]byte, error) {
+    doc := atomFeed{
+        ID: f.SelfLink,
+        Title: f.Title,
+        Subtitle: f.Description,
+        Updated: f.Updated.UTC().Format(time.RFC3339),
+        Links: []atomLink{
+            {Rel: "self", Type: "application/atom+xml", Href: f.SelfLink},
+            {Rel: "alternate", Href: f.Link},
+        },
+    }
+
+    for _, e := range f.Entries {
+        entry := atomEntry{
+            ID: e.Link,
+            Title: e.Title,
+            Links: []atomLink{{Rel: "alternate", Href: e.Link}},
+            Published: e.Published.UTC().Format(time.RFC3339),
+            Updated: e.Updated.UTC().Format(time.RFC3339),
+            Content: atomText{Type: "text", Body: e.Content},
+        }
+        if e.Author != "" {
+            entry.Author = &atomPerson{Name: e.Author}
+        }
+        doc.Entries = append(doc.Entries, entry)
+    }
+
+    return encode(doc)
+}
+
+func (f Feed) RSS() ([]byte, error) {
+    doc := rssFeed{
+        Version: "2.0",
+        AtomNS: "http://www.w3.org/2005/Atom",
+        DCNS: "http://purl.org/dc/elements/1.1/",
+        Channel: rssChannel{
+            Title: f.Title,
+            Link: f.Link,
+            Description: f.Description,
+            LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+            SelfLink: rssAtomLink{Href: f.SelfLink, Rel: "self", Type: "application/rss+xml"},
+        },
+    }
+
+    for _, e := range f.Entries {
+        doc.Channel.Items = append(doc.Channel.Items, rssItem{
+            Title: e.Title,
+            Link: e.Link,
+            Description: e.Content,
+            Author: e.Author,
+            GUID: rssGUID{IsPermaLink: true, Value: e.Link},
+            PubDate: e.Published.UTC().Format(time.RFC1123Z),
+        })
+    }
+
+    return encode(doc)
+}
+
+// ETag is a strong validator for a rendered feed
+func ETag(body []byte) string {
+    sum := sha256.Sum256(body)
+    return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Title shortens a chirp body to be used as entry title
+func Title(body string) string {
+    runes := []rune(body)
+    if len(runes) <= 50 {
+        return body
+    }
+    return string(runes[:49]) + "…"
+}
@@ -0,0 +1,83 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() Feed {
+    published := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+    return Feed{
+        Title: "Chirpy",
+        Description: "All the chirps",
+        Link: "http://localhost:8080/api/chirps",
+        SelfLink: "http://localhost:8080/api/feed.atom",
+        Updated: published,
+        Entries: []Entry{
+            {
+                Link: "http://localhost:8080/api/chirps/1",
+                Title: Title("I <3 Go & xml"),
+                Content: "I <3 Go & xml",
+                Author: "chirper",
+                Published: published,
+                Updated: published,
+            },
+        },
+    }
+}
+
+func TestAtom(t *testing.T) {
+    body, err := testFeed().Atom()
+    if err != nil {
+        t.Fatalf("Couldn't render atom feed: %v", err)
+    }
+
+    parsed := atomFeed{}
+    if err := xml.Unmarshal(body, &parsed); err != nil {
+        t.Fatalf("Atom feed is not valid xml: %v\n%s", err, body)
+    }
+    if len(parsed.Entries) != 1 || parsed.Entries[0].Content.Body != "I <3 Go & xml" {
+        t.Errorf("Wrong entries: %+v", parsed.Entries)
+    }
+    if parsed.Entries[0].ID != "http://localhost:8080/api/chirps/1" {
+        t.Errorf("Entry id should be its permalink, got: %s", parsed.Entries[0].ID)
+    }
+    if parsed.Updated != "2025-01-02T03:04:05Z" {
+        t.Errorf("Wrong updated timestamp: %s", parsed.Updated)
+    }
+}
+
+func TestRSS(t *testing.T) {
+    body, err := testFeed().RSS()
+    if err != nil {
+        t.Fatalf("Couldn't render rss feed: %v", err)
+    }
+    if !strings.Contains(string(body), `<guid isPermaLink="true">http://localhost:8080/api/chirps/1</guid>`) {
+        t.Errorf("Missing permalink guid:\n%s", body)
+    }
+    if !strings.Contains(string(body), "<pubDate>Thu, 02 Jan 2025 03:04:05 +0000</pubDate>") {
+        t.Errorf("Wrong pubDate:\n%s", body)
+    }
+}
+
+func TestETag(t *testing.T) {
+    a := ETag([]byte("feed"))
+    if a != ETag([]byte("feed")) {
+        t.Errorf("ETag is not stable")
+    }
+    if a == ETag([]byte("feed2")) {
+        t.Errorf("ETag didn't change with the body")
+    }
+}
+
+func TestTitle(t *testing.T) {
+    long := strings.Repeat("a", 140)
+    if got := []rune(Title(long)); len(got) != 50 {
+        t.Errorf("Title should be cut to 50 runes, got %d", len(got))
+    }
+    if Title("short") != "short" {
+        t.Errorf("Short titles should not change")
+    }
+}
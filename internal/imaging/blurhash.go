@@ -0,0 +1,120 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// blurhashes are computed on a small copy, the result is a blur anyway
+const blurhashSample = 64
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes a placeholder for the image (https://blurha.sh),
+// xComponents and yComponents go from 1 to 9
+func Blurhash(img image.Image, xComponents, yComponents int) string {
+    xComponents = min(max(xComponents, 1), 9)
+    yComponents = min(max(yComponents, 1), 9)
+
+    rgba := toRGBA(Fit(img, blurhashSample))
+    w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+
+    factors := make([][3]float64, 0, xComponents*yComponents)
+    for j := 0; j < yComponents; j++ {
+        for i := 0; i < xComponents; i++ {
+            factors = append(factors, basisFactor(rgba, w, h, i, j))
+        }
+    }
+
+    var hash strings.Builder
+    hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+    dc, ac := factors[0], factors[1:]
+    maximum := 1.0
+    if len(ac) > 0 {
+        actualMax := 0.0
+        for _, f := range ac {
+            actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+        }
+        quantised := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+        maximum = float64(quantised+1) / 166
+        hash.WriteString(encode83(quantised, 1))
+    } else {
+        hash.WriteString(encode83(0, 1))
+    }
+
+    hash.WriteString(encode83(encodeDC(dc), 4))
+    for _, f := range ac {
+        hash.WriteString(encode83(encodeAC(f, maximum), 2))
+    }
+    return hash.String()
+}
+
+func basisFactor(img *image.RGBA, w, h, i, j int) [3]float64 {
+    normalisation := 2.0
+    if i == 0 && j == 0 {
+        normalisation = 1
+    }
+
+    var r, g, b float64
+    for y := 0; y < h; y++ {
+        cy := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+        for x := 0; x < w; x++ {
+            basis := cy * math.Cos(math.Pi*float64(i)*float64(x)/float64(w))
+            p := img.PixOffset(x, y)
+            r += basis * srgbToLinear(unpremultiply(img.Pix[p], img.Pix[p+3]))
+            g += basis * srgbToLinear(unpremultiply(img.Pix[p+1], img.Pix[p+3]))
+            b += basis * srgbToLinear(unpremultiply(img.Pix[p+2], img.Pix[p+3]))
+        }
+    }
+    scale := normalisation / float64(w*h)
+    return [3]float64{r * scale, g * scale, b * scale}
+}
+
+func unpremultiply(c, a uint8) uint8 {
+    if a == 0 || a == 255 {
+        return c
+    }
+    return uint8(min(255, uint32(c)*255/uint32(a)))
+}
+
+func encodeDC(c [3]float64) int {
+    return linearToSRGB(c[0])<<16 + linearToSRGB(c[1])<<8 + linearToSRGB(c[2])
+}
+
+func encodeAC(c [3]float64, maximum float64) int {
+    quant := func(v float64) int {
+        return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+    }
+    return quant(c[0])*19*19 + quant(c[1])*19 + quant(c[2])
+}
+
+func signPow(v, exp float64) float64 {
+    return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+func srgbToLinear(c uint8) float64 {
+    v := float64(c) / 255
+    if v <= 0.04045 {
+        return v / 12.92
+    }
+    return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+    v = math.Max(0, math.Min(1, v))
+    if v <= 0.0031308 {
+        return int(v*12.92*255 + 0.5)
+    }
+    return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func encode83(value, length int) string {
+    out := make([]byte, length)
+    for i := length - 1; i >= 0; i-- {
+        out[i] = base83[value%83]
+        value /= 83
+    }
+    return string(out)
+}
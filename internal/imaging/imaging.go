@@ -0,0 +1,197 @@
+// Package imaging decodes, cleans and resizes uploaded images
+// using only the standard library decoders (jpeg, png and gif)
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+var (
+    // ErrTooLarge is returned for images whose decoded size is over the limit,
+    // a small file can claim huge dimensions (decompression bomb)
+    ErrTooLarge = errors.New("image dimensions are too large")
+    // ErrUnsupported is returned for formats that can't be decoded
+    ErrUnsupported = errors.New("unsupported image format")
+)
+
+// JPEGQuality used when re-encoding
+const JPEGQuality = 85
+
+// Image is a decoded upload, ready to be re-encoded without its metadata
+type Image struct {
+    Format string
+    // first frame, already rotated as the exif orientation says
+    Image image.Image
+    // every frame of an animated gif, nil for other formats
+    GIF *gif.GIF
+}
+
+// Bounds of the displayed image
+func (img Image) Bounds() image.Rectangle {
+    return img.Image.Bounds()
+}
+
+// Decode checks the declared dimensions before decoding anything,
+// so maxPixels bounds the memory used by a single upload
+// gifs are checked for the pixels of all their frames together
+func Decode(data []byte, maxPixels int) (Image, error) {
+    cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        return Image{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+    }
+    if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+        return Image{}, ErrTooLarge
+    }
+
+    switch format {
+    case "jpeg":
+        img, err := jpeg.Decode(bytes.NewReader(data))
+        if err != nil {
+            return Image{}, err
+        }
+        return Image{Format: format, Image: Orient(img, Orientation(data))}, nil
+    case "png":
+        img, err := png.Decode(bytes.NewReader(data))
+        if err != nil {
+            return Image{}, err
+        }
+        return Image{Format: format, Image: img}, nil
+    case "gif":
+        g, err := decodeGIF(data, maxPixels)
+        if err != nil {
+            return Image{}, err
+        }
+        return Image{Format: format, Image: firstFrame(g), GIF: g}, nil
+    }
+    return Image{}, ErrUnsupported
+}
+
+// the frame count only shows up in the file structure, so walk the blocks
+// and add up the frame sizes before letting the decoder allocate them
+func decodeGIF(data []byte, maxPixels int) (*gif.GIF, error) {
+    total, err := gifPixels(data)
+    if err != nil {
+        return nil, err
+    }
+    if total > maxPixels {
+        return nil, ErrTooLarge
+    }
+    return gif.DecodeAll(bytes.NewReader(data))
+}
+
+// total pixels of all the frames of a gif
+func gifPixels(data []byte) (int, error) {
+    bad := fmt.Errorf("%w: malformed gif", ErrUnsupported)
+    if len(data) < 13 {
+        return 0, bad
+    }
+    pos := 13
+    // global color table
+    if data[10]&0x80 != 0 {
+        pos += 3 << (data[10]&0x07 + 1)
+    }
+
+    // data sub-blocks end with an empty one
+    skipSubBlocks := func() bool {
+        for pos < len(data) {
+            size := int(data[pos])
+            pos += 1 + size
+            if size == 0 {
+                return true
+            }
+        }
+        return false
+    }
+
+    total := 0
+    for pos < len(data) {
+        switch data[pos] {
+        case 0x21:
+            // extension: introducer, label, sub-blocks
+            pos += 2
+            if !skipSubBlocks() {
+                return 0, bad
+            }
+        case 0x2C:
+            // image descriptor: position, size, flags
+            if pos+10 > len(data) {
+                return 0, bad
+            }
+            w := int(data[pos+5]) | int(data[pos+6])<<8
+            h := int(data[pos+7]) | int(data[pos+8])<<8
+            flags := data[pos+9]
+            total += w * h
+            pos += 10
+            if flags&0x80 != 0 {
+                pos += 3 << (flags&0x07 + 1)
+            }
+            // lzw minimum code size, then the image data
+            pos++
+            if !skipSubBlocks() {
+                return 0, bad
+            }
+        case 0x3B:
+            return total, nil
+        default:
+            return 0, bad
+        }
+    }
+    // truncated files are decoded as far as they go
+    return total, nil
+}
+
+// the first frame composed on the gif canvas
+func firstFrame(g *gif.GIF) image.Image {
+    canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+    if len(g.Image) > 0 {
+        draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+    }
+    return canvas
+}
+
+// Encode writes the image without any of the metadata of the original file,
+// animated gifs keep their frames
+func Encode(w io.Writer, img Image) error {
+    switch img.Format {
+    case "jpeg":
+        return jpeg.Encode(w, img.Image, &jpeg.Options{Quality: JPEGQuality})
+    case "png":
+        return png.Encode(w, img.Image)
+    case "gif":
+        if img.GIF != nil {
+            // only frames, timing and loop count are kept
+            return gif.EncodeAll(w, &gif.GIF{
+                Image: img.GIF.Image,
+                Delay: img.GIF.Delay,
+                Disposal: img.GIF.Disposal,
+                LoopCount: img.GIF.LoopCount,
+                Config: img.GIF.Config,
+                BackgroundIndex: img.GIF.BackgroundIndex,
+            })
+        }
+        return gif.Encode(w, img.Image, nil)
+    }
+    return ErrUnsupported
+}
+
+// EncodeThumbnail writes a still image, jpeg for photos and png otherwise
+// so transparency survives; returns the content type used
+func EncodeThumbnail(w io.Writer, img image.Image, sourceFormat string) (string, error) {
+    if sourceFormat == "jpeg" {
+        return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+    }
+    return "image/png", png.Encode(w, img)
+}
+
+// ContentType of an encoded format
+func ContentType(format string) string {
+    return "image/" + format
+}
@@ -0,0 +1,197 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func solid(w, h int, c color.Color) *image.RGBA {
+    img := image.NewRGBA(image.Rect(0, 0, w, h))
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            img.Set(x, y, c)
+        }
+    }
+    return img
+}
+
+// a png that only has a header, claiming the given size
+func pngHeader(w, h uint32) []byte {
+    var buf bytes.Buffer
+    buf.WriteString("\x89PNG\r\n\x1a\n")
+    ihdr := make([]byte, 13)
+    binary.BigEndian.PutUint32(ihdr[0:], w)
+    binary.BigEndian.PutUint32(ihdr[4:], h)
+    ihdr[8] = 8 // bit depth
+    ihdr[9] = 6 // rgba
+    chunk := append([]byte("IHDR"), ihdr...)
+    binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+    buf.Write(chunk)
+    binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+    return buf.Bytes()
+}
+
+// jpeg with an exif segment holding only the orientation tag
+func jpegWithOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+    var encoded bytes.Buffer
+    if err := jpeg.Encode(&encoded, img, nil); err != nil {
+        t.Fatalf("Couldn't encode jpeg: %v", err)
+    }
+
+    tiff := []byte("II*\x00\x08\x00\x00\x00")
+    tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+    tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+    tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+    tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+    tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+    tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+    segment := append([]byte("Exif\x00\x00"), tiff...)
+
+    out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+    out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+    out = append(out, segment...)
+    return append(out, encoded.Bytes()[2:]...)
+}
+
+func TestDecodeRejectsBombs(t *testing.T) {
+    _, err := Decode(pngHeader(100000, 100000), 40_000_000)
+    if !errors.Is(err, ErrTooLarge) {
+        t.Errorf("Expected ErrTooLarge for a huge png, got %v", err)
+    }
+}
+
+func TestDecodeRejectsManyGifFrames(t *testing.T) {
+    palette := color.Palette{color.Black, color.White}
+    g := &gif.GIF{}
+    for i := 0; i < 20; i++ {
+        g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 100, 100), palette))
+        g.Delay = append(g.Delay, 10)
+    }
+    var buf bytes.Buffer
+    if err := gif.EncodeAll(&buf, g); err != nil {
+        t.Fatalf("Couldn't encode gif: %v", err)
+    }
+
+    // each frame fits, all of them together don't
+    if _, err := Decode(buf.Bytes(), 100_000); !errors.Is(err, ErrTooLarge) {
+        t.Errorf("Expected ErrTooLarge for 20 frames, got %v", err)
+    }
+    decoded, err := Decode(buf.Bytes(), 1_000_000)
+    if err != nil {
+        t.Fatalf("Couldn't decode gif: %v", err)
+    }
+    if len(decoded.GIF.Image) != 20 {
+        t.Errorf("Expected 20 frames, got %d", len(decoded.GIF.Image))
+    }
+}
+
+func TestDecodeAppliesOrientationAndStripsExif(t *testing.T) {
+    // 4x2 landscape, stored to be rotated 90 degrees clockwise
+    data := jpegWithOrientation(t, solid(4, 2, color.White), 6)
+    if o := Orientation(data); o != 6 {
+        t.Fatalf("Expected orientation 6, got %d", o)
+    }
+
+    img, err := Decode(data, 1000)
+    if err != nil {
+        t.Fatalf("Couldn't decode jpeg: %v", err)
+    }
+    if b := img.Bounds(); b.Dx() != 2 || b.Dy() != 4 {
+        t.Errorf("Expected a 2x4 portrait image, got %dx%d", b.Dx(), b.Dy())
+    }
+
+    var out bytes.Buffer
+    if err := Encode(&out, img); err != nil {
+        t.Fatalf("Couldn't encode jpeg: %v", err)
+    }
+    if bytes.Contains(out.Bytes(), []byte("Exif")) {
+        t.Error("Re-encoded jpeg still has exif data")
+    }
+    if o := Orientation(out.Bytes()); o != 1 {
+        t.Errorf("Expected no orientation after encoding, got %d", o)
+    }
+}
+
+func TestOrient(t *testing.T) {
+    src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+    red := color.RGBA{255, 0, 0, 255}
+    blue := color.RGBA{0, 0, 255, 255}
+    src.Set(0, 0, red)
+    src.Set(1, 0, blue)
+
+    cases := map[int][]color.RGBA{
+        // expected pixels top to bottom, left to right
+        2: {blue, red},
+        3: {blue, red},
+        6: {red, blue},
+        8: {blue, red},
+    }
+    for orientation, want := range cases {
+        out := toRGBA(Orient(src, orientation))
+        var got []color.RGBA
+        b := out.Bounds()
+        for y := 0; y < b.Dy(); y++ {
+            for x := 0; x < b.Dx(); x++ {
+                got = append(got, out.RGBAAt(x, y))
+            }
+        }
+        if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+            t.Errorf("Orientation %d: expected %v, got %v", orientation, want, got)
+        }
+        if orientation >= 5 && b.Dx() != 1 {
+            t.Errorf("Orientation %d should swap width and height", orientation)
+        }
+    }
+}
+
+func TestFit(t *testing.T) {
+    img := solid(1000, 500, color.RGBA{10, 20, 30, 255})
+    thumb := Fit(img, 160)
+    if b := thumb.Bounds(); b.Dx() != 160 || b.Dy() != 80 {
+        t.Errorf("Expected 160x80, got %dx%d", b.Dx(), b.Dy())
+    }
+    if c := toRGBA(thumb).RGBAAt(40, 40); c != (color.RGBA{10, 20, 30, 255}) {
+        t.Errorf("Expected the color to be kept, got %v", c)
+    }
+    if small := Fit(img, 2000); small != image.Image(img) {
+        t.Error("Small images should not be resized")
+    }
+}
+
+func TestBlurhash(t *testing.T) {
+    hash := Blurhash(solid(32, 32, color.RGBA{255, 0, 0, 255}), 4, 3)
+    if len(hash) != 4+2*4*3 {
+        t.Fatalf("Unexpected blurhash length %d: %s", len(hash), hash)
+    }
+    // 4x3 components, then the average color
+    if hash[:1] != "L" {
+        t.Errorf("Expected the size flag L for 4x3 components, got %s", hash[:1])
+    }
+    if dc := hash[2:6]; dc != encode83(255<<16, 4) {
+        t.Errorf("Expected the average color to be pure red, got %s", dc)
+    }
+}
+
+func TestEncodeKeepsPNGAlpha(t *testing.T) {
+    img := solid(4, 4, color.NRGBA{0, 0, 0, 0})
+    var out bytes.Buffer
+    contentType, err := EncodeThumbnail(&out, img, "png")
+    if err != nil || contentType != "image/png" {
+        t.Fatalf("Expected a png thumbnail, got %s, %v", contentType, err)
+    }
+    decoded, err := png.Decode(&out)
+    if err != nil {
+        t.Fatalf("Couldn't decode thumbnail: %v", err)
+    }
+    if _, _, _, a := decoded.At(0, 0).RGBA(); a != 0 {
+        t.Error("Transparency was lost")
+    }
+}
@@ -0,0 +1,116 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// Orientation reads the exif orientation tag of a jpeg, 1 (as stored)
+// when there is none. Cameras save photos unrotated and rely on this tag,
+// so it has to be applied before the metadata is dropped
+func Orientation(data []byte) int {
+    if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+        return 1
+    }
+    pos := 2
+    for pos+4 <= len(data) {
+        if data[pos] != 0xFF {
+            return 1
+        }
+        marker := data[pos+1]
+        // start of scan, no more metadata after this
+        if marker == 0xDA {
+            return 1
+        }
+        size := int(binary.BigEndian.Uint16(data[pos+2:]))
+        end := pos + 2 + size
+        if size < 2 || end > len(data) {
+            return 1
+        }
+        segment := data[pos+4 : end]
+        if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+            return exifOrientation(segment[6:])
+        }
+        pos = end
+    }
+    return 1
+}
+
+// orientation from the first ifd of a tiff header
+func exifOrientation(tiff []byte) int {
+    if len(tiff) < 8 {
+        return 1
+    }
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 1
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd < 8 || ifd+2 > len(tiff) {
+        return 1
+    }
+    entries := int(order.Uint16(tiff[ifd:]))
+    for i := 0; i < entries; i++ {
+        entry := ifd + 2 + i*12
+        if entry+12 > len(tiff) {
+            return 1
+        }
+        if order.Uint16(tiff[entry:]) == 0x0112 {
+            o := int(order.Uint16(tiff[entry+8:]))
+            if o < 1 || o > 8 {
+                return 1
+            }
+            return o
+        }
+    }
+    return 1
+}
+
+// Orient returns the image as it should be displayed for an exif orientation
+func Orient(img image.Image, orientation int) image.Image {
+    if orientation <= 1 || orientation > 8 {
+        return img
+    }
+
+    src := toRGBA(img)
+    w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+    // orientations 5 to 8 swap width and height
+    dw, dh := w, h
+    if orientation >= 5 {
+        dw, dh = h, w
+    }
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < dh; y++ {
+        for x := 0; x < dw; x++ {
+            var sx, sy int
+            switch orientation {
+            case 2:
+                sx, sy = w-1-x, y
+            case 3:
+                sx, sy = w-1-x, h-1-y
+            case 4:
+                sx, sy = x, h-1-y
+            case 5:
+                sx, sy = y, x
+            case 6:
+                sx, sy = y, h-1-x
+            case 7:
+                sx, sy = w-1-y, h-1-x
+            case 8:
+                sx, sy = w-1-y, x
+            }
+            si := src.PixOffset(sx, sy)
+            di := dst.PixOffset(x, y)
+            copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+        }
+    }
+    return dst
+}
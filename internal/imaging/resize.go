@@ -0,0 +1,75 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fit scales the image down so its longest side is at most maxSide,
+// averaging every source pixel covered by a destination pixel.
+// Images already small enough are returned as they are
+func Fit(img image.Image, maxSide int) image.Image {
+    b := img.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if w <= maxSide && h <= maxSide {
+        return img
+    }
+
+    dw, dh := maxSide, h*maxSide/w
+    if h > w {
+        dw, dh = w*maxSide/h, maxSide
+    }
+    if dw < 1 {
+        dw = 1
+    }
+    if dh < 1 {
+        dh = 1
+    }
+    return resize(img, dw, dh)
+}
+
+// copy of the image as premultiplied rgba starting at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+    b := img.Bounds()
+    if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+        return rgba
+    }
+    rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+    draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+    return rgba
+}
+
+// box filter on premultiplied colors, so transparent pixels don't darken edges
+func resize(img image.Image, dw, dh int) *image.RGBA {
+    src := toRGBA(img)
+    sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < dh; y++ {
+        sy0 := y * sh / dh
+        sy1 := max((y+1)*sh/dh, sy0+1)
+        for x := 0; x < dw; x++ {
+            sx0 := x * sw / dw
+            sx1 := max((x+1)*sw/dw, sx0+1)
+
+            var r, g, bl, a, n uint32
+            for sy := sy0; sy < sy1; sy++ {
+                i := src.PixOffset(sx0, sy)
+                for sx := sx0; sx < sx1; sx++ {
+                    r += uint32(src.Pix[i])
+                    g += uint32(src.Pix[i+1])
+                    bl += uint32(src.Pix[i+2])
+                    a += uint32(src.Pix[i+3])
+                    n++
+                    i += 4
+                }
+            }
+            di := dst.PixOffset(x, y)
+            dst.Pix[di] = uint8(r / n)
+            dst.Pix[di+1] = uint8(g / n)
+            dst.Pix[di+2] = uint8(bl / n)
+            dst.Pix[di+3] = uint8(a / n)
+        }
+    }
+    return dst
+}
@@ -0,0 +1,136 @@
+// Package logging builds the JSON slog logger of the server:
+// every line carries the request id and trace of its context,
+// and passwords, tokens and emails never reach the output
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is read from callers and set on every response
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID is the id of the request ctx belongs to, "" outside of one
+func RequestID(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
+
+// ids from callers are kept when they are short and plain
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func ValidRequestID(id string) bool {
+    return validRequestID.MatchString(id)
+}
+
+// New logs JSON lines to w at level and above
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+    json := slog.NewJSONHandler(w, &slog.HandlerOptions{
+        Level: level,
+        ReplaceAttr: redactAttr,
+    })
+    return slog.New(&contextHandler{Handler: json})
+}
+
+// ParseLevel reads "debug", "info", "warn" or "error", info otherwise
+func ParseLevel(s string) slog.Level {
+    var level slog.Level
+    if err := level.UnmarshalText([]byte(s)); err != nil {
+        return slog.LevelInfo
+    }
+    return level
+}
+
+// adds the request and trace ids of the context to the record
+type contextHandler struct {
+    slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+    if id := RequestID(ctx); id != "" {
+        r.AddAttrs(slog.String("request_id", id))
+    }
+    if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+        r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+    }
+    return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+    return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Redacted replaces the value of a sensitive attribute
+const Redacted = "[REDACTED]"
+
+// attributes never logged, whatever their value
+var sensitiveKeys = map[string]bool{
+    "password": true,
+    "current_password": true,
+    "hashed_password": true,
+    "token": true,
+    "access_token": true,
+    "refresh_token": true,
+    "reset_token": true,
+    "authorization": true,
+    "api_key": true,
+    "secret": true,
+}
+
+var (
+    emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@([A-Za-z0-9-]+\.)+[A-Za-z]{2,}`)
+    bearerPattern = regexp.MustCompile(`(?i)(bearer|apikey)\s+\S+`)
+    jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// MaskEmail keeps the domain, "someone@example.com" is "***@example.com"
+func MaskEmail(email string) string {
+    if _, domain, ok := strings.Cut(email, "@"); ok {
+        return "***@" + domain
+    }
+    return Redacted
+}
+
+// Redact masks the emails and credentials found in free text,
+// such as messages and errors from the database
+func Redact(s string) string {
+    s = emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+    s = bearerPattern.ReplaceAllString(s, "$1 "+Redacted)
+    return jwtPattern.ReplaceAllString(s, Redacted)
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+    key := strings.ToLower(a.Key)
+    switch {
+    case sensitiveKeys[key]:
+        return slog.String(a.Key, Redacted)
+    case key == "email":
+        return slog.String(a.Key, MaskEmail(a.Value.String()))
+    }
+
+    switch a.Value.Kind() {
+    case slog.KindString:
+        return slog.String(a.Key, Redact(a.Value.String()))
+    case slog.KindAny:
+        if err, ok := a.Value.Any().(error); ok {
+            return slog.String(a.Key, Redact(err.Error()))
+        }
+    }
+    return a
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func logLine(t *testing.T, log func(*slog.Logger)) map[string]any {
+    t.Helper()
+    var buf bytes.Buffer
+    log(New(&buf, slog.LevelDebug))
+    line := map[string]any{}
+    if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+        t.Fatalf("Log line isn't JSON: %q", buf.String())
+    }
+    return line
+}
+
+func TestRedaction(t *testing.T) {
+    line := logLine(t, func(l *slog.Logger) {
+        l.Warn("Login of john@example.com failed",
+            "email", "john@example.com",
+            "password", "hunter2",
+            "Refresh_Token", "abc",
+            "err", errors.New("no user jane@example.com"),
+            "header", "Bearer eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig",
+            "user_id", 42,
+        )
+    })
+
+    want := map[string]any{
+        "msg": "Login of ***@example.com failed",
+        "email": "***@example.com",
+        "password": Redacted,
+        "Refresh_Token": Redacted,
+        "err": "no user ***@example.com",
+        "header": "Bearer " + Redacted,
+        "user_id": float64(42),
+    }
+    for k, v := range want {
+        if line[k] != v {
+            t.Errorf("%s = %v, want %v", k, line[k], v)
+        }
+    }
+}
+
+func TestContextIDs(t *testing.T) {
+    ctx := WithRequestID(context.Background(), "req-1")
+    line := logLine(t, func(l *slog.Logger) {
+        l.InfoContext(ctx, "Request")
+    })
+    if line["request_id"] != "req-1" {
+        t.Errorf("request_id = %v, want req-1", line["request_id"])
+    }
+    if _, ok := line["trace_id"]; ok {
+        t.Errorf("trace_id logged without a span")
+    }
+
+    line = logLine(t, func(l *slog.Logger) {
+        l.Info("Started")
+    })
+    if _, ok := line["request_id"]; ok {
+        t.Errorf("request_id logged outside of a request")
+    }
+}
+
+func TestValidRequestID(t *testing.T) {
+    cases := map[string]bool{
+        "abc-123": true,
+        "4bf92f35-77b3-4da6-a3ce-929d0e0e4736": true,
+        "": false,
+        "has space": false,
+        "line\nbreak": false,
+        strings.Repeat("a", 129): false,
+    }
+    for id, valid := range cases {
+        if ValidRequestID(id) != valid {
+            t.Errorf("ValidRequestID(%q) = %v, want %v", id, !valid, valid)
+        }
+    }
+}
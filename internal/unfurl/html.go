@@ -0,0 +1,70 @@
+package unfurl
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+    tagRegex   = regexp.MustCompile(`(?is)<(meta|link|title)\b([^>]*)>`)
+    attrRegex  = regexp.MustCompile(`(?s)([a-zA-Z_:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+    titleRegex = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+    headEnd    = regexp.MustCompile(`(?i)</head>|<body\b`)
+)
+
+// what a preview needs from the head of a page
+type headMeta struct {
+    // <meta property=... content=...>, og: and twitter: tags
+    props map[string]string
+    // <meta name=... content=...>
+    names  map[string]string
+    title  string
+    oembed string
+}
+
+// only the head is looked at, a full html parser is not needed for meta tags
+func parseHead(page []byte) headMeta {
+    doc := string(page)
+    if loc := headEnd.FindStringIndex(doc); loc != nil {
+        doc = doc[:loc[0]]
+    }
+
+    meta := headMeta{props: map[string]string{}, names: map[string]string{}}
+    if m := titleRegex.FindStringSubmatch(doc); m != nil {
+        meta.title = html.UnescapeString(m[1])
+    }
+
+    for _, tag := range tagRegex.FindAllStringSubmatch(doc, -1) {
+        attrs := map[string]string{}
+        for _, a := range attrRegex.FindAllStringSubmatch(tag[2], -1) {
+            attrs[strings.ToLower(a[1])] = html.UnescapeString(a[2] + a[3] + a[4])
+        }
+
+        switch strings.ToLower(tag[1]) {
+        case "meta":
+            content := attrs["content"]
+            // some sites use name for og tags, the first value wins
+            if p := strings.ToLower(attrs["property"]); p != "" {
+                setOnce(meta.props, p, content)
+            }
+            if n := strings.ToLower(attrs["name"]); n != "" {
+                setOnce(meta.names, n, content)
+                if strings.HasPrefix(n, "og:") || strings.HasPrefix(n, "twitter:") {
+                    setOnce(meta.props, n, content)
+                }
+            }
+        case "link":
+            if strings.EqualFold(attrs["type"], "application/json+oembed") && meta.oembed == "" {
+                meta.oembed = attrs["href"]
+            }
+        }
+    }
+    return meta
+}
+
+func setOnce(m map[string]string, key, value string) {
+    if _, ok := m[key]; !ok {
+        m[key] = value
+    }
+}
@@ -0,0 +1,305 @@
+// Package unfurl fetches link previews (OpenGraph and oEmbed) for urls
+// posted by users, without letting them reach the server's own network
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+    // ErrBlocked is returned for urls resolving to private or reserved addresses
+    ErrBlocked = errors.New("destination address is not allowed")
+    // ErrNoPreview is returned for pages without anything to show
+    ErrNoPreview = errors.New("no preview metadata found")
+)
+
+// defaults for a Fetcher
+const (
+    DefaultTimeout   = 5 * time.Second
+    DefaultMaxBytes  = 512 << 10
+    DefaultUserAgent = "Chirpy-LinkPreview/1.0"
+    maxRedirects     = 3
+    maxFieldLen      = 300
+)
+
+// Card is the preview shown under a chirp
+type Card struct {
+    URL         string
+    Title       string
+    Description string
+    ImageURL    string
+    SiteName    string
+}
+
+// Options for NewFetcher, zero values use the defaults
+type Options struct {
+    Timeout   time.Duration
+    MaxBytes  int64
+    UserAgent string
+    // AllowPrivate lets the fetcher reach private addresses,
+    // only meant for tests against httptest servers
+    AllowPrivate bool
+}
+
+// Fetcher downloads pages and extracts their preview
+type Fetcher struct {
+    client    *http.Client
+    maxBytes  int64
+    userAgent string
+}
+
+func NewFetcher(opts Options) *Fetcher {
+    if opts.MaxBytes == 0 {
+        opts.MaxBytes = DefaultMaxBytes
+    }
+    if opts.UserAgent == "" {
+        opts.UserAgent = DefaultUserAgent
+    }
+    return &Fetcher{
+        client: NewClient(opts),
+        maxBytes: opts.MaxBytes,
+        userAgent: opts.UserAgent,
+    }
+}
+
+// NewClient is an http client that only connects to public addresses
+// and follows a few http(s) redirects, for urls chosen by users
+// or remote servers. Only opts.Timeout and opts.AllowPrivate are used
+func NewClient(opts Options) *http.Client {
+    if opts.Timeout == 0 {
+        opts.Timeout = DefaultTimeout
+    }
+
+    dialer := &net.Dialer{Timeout: opts.Timeout}
+    if !opts.AllowPrivate {
+        // checked on the resolved address right before connecting,
+        // so a dns answer can't point somewhere else after validation
+        dialer.Control = func(network, address string, _ syscall.RawConn) error {
+            host, _, err := net.SplitHostPort(address)
+            if err != nil {
+                return err
+            }
+            if !AllowedIP(net.ParseIP(host)) {
+                return ErrBlocked
+            }
+            return nil
+        }
+    }
+
+    transport := &http.Transport{
+        // never through an environment proxy, it would skip the address check
+        Proxy: nil,
+        DialContext: dialer.DialContext,
+        TLSHandshakeTimeout: opts.Timeout,
+        ResponseHeaderTimeout: opts.Timeout,
+        MaxIdleConns: 10,
+        IdleConnTimeout: 30 * time.Second,
+    }
+
+    return &http.Client{
+        Transport: transport,
+        Timeout: opts.Timeout,
+        CheckRedirect: func(req *http.Request, via []*http.Request) error {
+            if len(via) >= maxRedirects {
+                return fmt.Errorf("stopped after %d redirects", maxRedirects)
+            }
+            if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+                return fmt.Errorf("redirect to unsupported scheme %s", req.URL.Scheme)
+            }
+            return nil
+        },
+    }
+}
+
+// reserved ranges not covered by the net.IP helpers
+var blockedNets = mustParseCIDRs(
+    "0.0.0.0/8",
+    "100.64.0.0/10",
+    "192.0.0.0/24",
+    "192.0.2.0/24",
+    "198.18.0.0/15",
+    "198.51.100.0/24",
+    "203.0.113.0/24",
+    "240.0.0.0/4",
+    "64:ff9b::/96",
+    "2001:db8::/32",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+    nets := make([]*net.IPNet, 0, len(cidrs))
+    for _, cidr := range cidrs {
+        _, n, err := net.ParseCIDR(cidr)
+        if err != nil {
+            panic(err)
+        }
+        nets = append(nets, n)
+    }
+    return nets
+}
+
+// AllowedIP reports if ip is a public unicast address
+func AllowedIP(ip net.IP) bool {
+    if ip == nil {
+        return false
+    }
+    if ip4 := ip.To4(); ip4 != nil {
+        ip = ip4
+    }
+    if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+        ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+        return false
+    }
+    for _, n := range blockedNets {
+        if n.Contains(ip) {
+            return false
+        }
+    }
+    return true
+}
+
+// Fetch the page at rawURL and build its card
+// oEmbed is used for whatever the page's OpenGraph tags leave out
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Card, error) {
+    page, err := url.Parse(rawURL)
+    if err != nil || (page.Scheme != "http" && page.Scheme != "https") || page.Host == "" {
+        return Card{}, fmt.Errorf("invalid url %q", rawURL)
+    }
+
+    body, final, err := f.get(ctx, page.String(), "text/html")
+    if err != nil {
+        return Card{}, err
+    }
+
+    meta := parseHead(body)
+    card := Card{
+        URL: final.String(),
+        Title: first(meta.props["og:title"], meta.props["twitter:title"], meta.title),
+        Description: first(meta.props["og:description"], meta.props["twitter:description"], meta.names["description"]),
+        ImageURL: first(meta.props["og:image"], meta.props["og:image:url"], meta.props["twitter:image"]),
+        SiteName: meta.props["og:site_name"],
+    }
+
+    if meta.oembed != "" && (card.Title == "" || card.ImageURL == "") {
+        if oembedURL, err := final.Parse(meta.oembed); err == nil {
+            if o, err := f.fetchOEmbed(ctx, oembedURL.String()); err == nil {
+                card.Title = first(card.Title, o.Title)
+                card.ImageURL = first(card.ImageURL, o.ThumbnailURL)
+                card.SiteName = first(card.SiteName, o.ProviderName)
+            }
+        }
+    }
+
+    // relative images are common, and only web urls are kept
+    if card.ImageURL != "" {
+        img, err := final.Parse(card.ImageURL)
+        if err != nil || (img.Scheme != "http" && img.Scheme != "https") {
+            card.ImageURL = ""
+        } else {
+            card.ImageURL = img.String()
+        }
+    }
+
+    card.Title = clip(card.Title)
+    card.Description = clip(card.Description)
+    card.SiteName = clip(card.SiteName)
+    if card.Title == "" && card.Description == "" && card.ImageURL == "" {
+        return card, ErrNoPreview
+    }
+    return card, nil
+}
+
+type oembed struct {
+    Title        string `json:"title"`
+    ProviderName string `json:"provider_name"`
+    ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (f *Fetcher) fetchOEmbed(ctx context.Context, rawURL string) (oembed, error) {
+    body, _, err := f.get(ctx, rawURL, "application/json")
+    if err != nil {
+        return oembed{}, err
+    }
+    o := oembed{}
+    return o, json.Unmarshal(body, &o)
+}
+
+// GET with the size cap, only accepting the wanted media type
+func (f *Fetcher) get(ctx context.Context, rawURL, accept string) ([]byte, *url.URL, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+    if err != nil {
+        return nil, nil, err
+    }
+    req.Header.Set("User-Agent", f.userAgent)
+    req.Header.Set("Accept", accept)
+
+    res, err := f.client.Do(req)
+    if err != nil {
+        if errors.Is(err, ErrBlocked) {
+            return nil, nil, ErrBlocked
+        }
+        return nil, nil, err
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusOK {
+        return nil, nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+    }
+    mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+    if mediaType != accept && !(accept == "text/html" && mediaType == "application/xhtml+xml") {
+        return nil, nil, fmt.Errorf("unexpected content type %q", mediaType)
+    }
+
+    // a cut page still has its head, the cap is not an error
+    body, err := io.ReadAll(io.LimitReader(res.Body, f.maxBytes))
+    if err != nil {
+        return nil, nil, err
+    }
+    return body, res.Request.URL, nil
+}
+
+var urlRegex = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// FirstURL is the first web url in a text, without trailing punctuation
+func FirstURL(text string) string {
+    match := urlRegex.FindString(text)
+    match = strings.TrimRight(match, ".,;:!?)]}")
+    if _, err := url.Parse(match); err != nil {
+        return ""
+    }
+    return match
+}
+
+func first(values ...string) string {
+    for _, v := range values {
+        if v = strings.TrimSpace(v); v != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+// collapse whitespace and cut long values on a rune boundary
+func clip(s string) string {
+    s = strings.Join(strings.Fields(s), " ")
+    if len(s) <= maxFieldLen {
+        return s
+    }
+    s = s[:maxFieldLen]
+    for !utf8.ValidString(s) {
+        s = s[:len(s)-1]
+    }
+    return s + "…"
+}
@@ -0,0 +1,157 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ogPage = `<!doctype html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="Chirpy &amp; friends">
+<meta property="og:description" content="A place to chirp">
+<meta property="og:image" content="/cover.png">
+<meta property="og:site_name" content="Chirpy">
+</head><body><meta property="og:title" content="not in the head"></body></html>`
+
+const oembedPage = `<html><head>
+<title>A video</title>
+<link rel="alternate" type="application/json+oembed" href="/oembed.json">
+</head></html>`
+
+func testServer() *httptest.Server {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        fmt.Fprint(w, ogPage)
+    })
+    mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html")
+        fmt.Fprint(w, oembedPage)
+    })
+    mux.HandleFunc("/oembed.json", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        fmt.Fprint(w, `{"title": "Cat video", "provider_name": "Tube", "thumbnail_url": "https://img.example.com/cat.jpg"}`)
+    })
+    mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html")
+        fmt.Fprint(w, "<html><head>"+strings.Repeat("<!-- padding -->", 10000)+`<meta property="og:title" content="too late"></head></html>`)
+    })
+    mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+        time.Sleep(500 * time.Millisecond)
+        w.Header().Set("Content-Type", "text/html")
+        fmt.Fprint(w, ogPage)
+    })
+    mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        fmt.Fprint(w, `{}`)
+    })
+    return httptest.NewServer(mux)
+}
+
+func TestFetchOpenGraph(t *testing.T) {
+    srv := testServer()
+    defer srv.Close()
+
+    card, err := NewFetcher(Options{AllowPrivate: true}).Fetch(context.Background(), srv.URL+"/og")
+    if err != nil {
+        t.Fatalf("Couldn't fetch card: %v", err)
+    }
+    if card.Title != "Chirpy & friends" {
+        t.Errorf("Unexpected title %q", card.Title)
+    }
+    if card.Description != "A place to chirp" || card.SiteName != "Chirpy" {
+        t.Errorf("Unexpected description or site name: %+v", card)
+    }
+    if card.ImageURL != srv.URL+"/cover.png" {
+        t.Errorf("Expected the image url to be resolved, got %q", card.ImageURL)
+    }
+}
+
+func TestFetchOEmbed(t *testing.T) {
+    srv := testServer()
+    defer srv.Close()
+
+    card, err := NewFetcher(Options{AllowPrivate: true}).Fetch(context.Background(), srv.URL+"/oembed")
+    if err != nil {
+        t.Fatalf("Couldn't fetch card: %v", err)
+    }
+    // the page title wins, the missing image comes from oembed
+    if card.Title != "A video" || card.ImageURL != "https://img.example.com/cat.jpg" || card.SiteName != "Tube" {
+        t.Errorf("Unexpected card %+v", card)
+    }
+}
+
+func TestFetchLimits(t *testing.T) {
+    srv := testServer()
+    defer srv.Close()
+    ctx := context.Background()
+
+    f := NewFetcher(Options{AllowPrivate: true, MaxBytes: 1024, Timeout: 200 * time.Millisecond})
+    if _, err := f.Fetch(ctx, srv.URL+"/huge"); !errors.Is(err, ErrNoPreview) {
+        t.Errorf("Expected the size cap to hide the late tag, got %v", err)
+    }
+    if _, err := f.Fetch(ctx, srv.URL+"/slow"); err == nil {
+        t.Error("Expected a timeout for a slow server")
+    }
+    if _, err := f.Fetch(ctx, srv.URL+"/json"); err == nil {
+        t.Error("Expected non html pages to be rejected")
+    }
+    if _, err := f.Fetch(ctx, "file:///etc/passwd"); err == nil {
+        t.Error("Expected non web urls to be rejected")
+    }
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+    srv := testServer()
+    defer srv.Close()
+    ctx := context.Background()
+
+    f := NewFetcher(Options{})
+    if _, err := f.Fetch(ctx, srv.URL+"/og"); !errors.Is(err, ErrBlocked) {
+        t.Errorf("Expected loopback to be blocked, got %v", err)
+    }
+
+    // a public looking redirect can't lead inside either
+    redirect := httptest.NewServer(http.RedirectHandler(srv.URL+"/og", http.StatusFound))
+    defer redirect.Close()
+    if _, err := f.Fetch(ctx, redirect.URL); !errors.Is(err, ErrBlocked) {
+        t.Errorf("Expected redirect to loopback to be blocked, got %v", err)
+    }
+}
+
+func TestAllowedIP(t *testing.T) {
+    blocked := []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+        "100.64.0.1", "0.0.0.0", "::1", "fc00::1", "fe80::1", "::ffff:127.0.0.1", "224.0.0.1"}
+    for _, ip := range blocked {
+        if AllowedIP(net.ParseIP(ip)) {
+            t.Errorf("Expected %s to be blocked", ip)
+        }
+    }
+    for _, ip := range []string{"93.184.216.34", "2606:4700::1111"} {
+        if !AllowedIP(net.ParseIP(ip)) {
+            t.Errorf("Expected %s to be allowed", ip)
+        }
+    }
+}
+
+func TestFirstURL(t *testing.T) {
+    cases := map[string]string{
+        "look at https://example.com/a?b=c, nice": "https://example.com/a?b=c",
+        "(see http://example.com/x).":             "http://example.com/x",
+        "no links here":                           "",
+        "ftp://example.com is not the web":         "",
+    }
+    for text, want := range cases {
+        if got := FirstURL(text); got != want {
+            t.Errorf("FirstURL(%q) = %q, want %q", text, got, want)
+        }
+    }
+}
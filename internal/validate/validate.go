@@ -0,0 +1,276 @@
+// Package validate decodes json request bodies, strictly unless
+// they come from other services, and checks their fields, keeping one error per field
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// codes of field errors, clients switch on these
+const (
+    CodeRequired     = "required"
+    CodeInvalidType  = "invalid_type"
+    CodeUnknownField = "unknown_field"
+    CodeInvalidEmail = "invalid_email"
+    CodeWeakPassword = "weak_password"
+    CodeInvalidUUID  = "invalid_uuid"
+    CodeTooLong      = "too_long"
+    CodeInvalid      = "invalid"
+)
+
+const (
+    MinPasswordLen = 8
+    // bcrypt ignores anything longer
+    MaxPasswordBytes = 72
+    maxEmailLen = 254
+)
+
+var (
+    ErrEmpty    = errors.New("request body is empty")
+    ErrTooLarge = errors.New("request body is too large")
+    ErrSyntax   = errors.New("request body is not valid json")
+)
+
+// FieldError is what's wrong with one field of a request
+type FieldError struct {
+    Field   string `json:"field"`
+    Code    string `json:"code"`
+    Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Errors are the failed checks of a request, in the order they ran
+type Errors []FieldError
+
+func (e Errors) Error() string {
+    msgs := make([]string, len(e))
+    for i, fe := range e {
+        msgs[i] = fe.Error()
+    }
+    return strings.Join(msgs, ", ")
+}
+
+// Decode reads the json body of r into dst, failing on unknown fields,
+// on more than one value and on bodies over maxBytes.
+// The errors are ErrEmpty, ErrTooLarge, ErrSyntax or a *FieldError
+// for a field that is unknown or of the wrong type
+func Decode(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) error {
+    return decodeBody(w, r, dst, maxBytes, true)
+}
+
+// DecodeLenient is Decode without the unknown field check, for bodies
+// sent by other services, which may add fields whenever they like
+func DecodeLenient(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) error {
+    return decodeBody(w, r, dst, maxBytes, false)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64, strict bool) error {
+    r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+    dec := json.NewDecoder(r.Body)
+    if strict {
+        dec.DisallowUnknownFields()
+    }
+
+    if err := dec.Decode(dst); err != nil {
+        return decodeError(err)
+    }
+    var extra json.RawMessage
+    err := dec.Decode(&extra)
+    if err == io.EOF {
+        return nil
+    }
+    var maxErr *http.MaxBytesError
+    if errors.As(err, &maxErr) {
+        return ErrTooLarge
+    }
+    return fmt.Errorf("%w: more than one value", ErrSyntax)
+}
+
+func decodeError(err error) error {
+    var maxErr *http.MaxBytesError
+    var typeErr *json.UnmarshalTypeError
+    switch {
+    case errors.Is(err, io.EOF):
+        return ErrEmpty
+    case errors.As(err, &maxErr):
+        return ErrTooLarge
+    case errors.As(err, &typeErr):
+        field := typeErr.Field
+        if field == "" {
+            return fmt.Errorf("%w: must be %s", ErrSyntax, kindName(typeErr.Type))
+        }
+        return &FieldError{
+            Field: field,
+            Code: CodeInvalidType,
+            Message: fmt.Sprintf("Must be %s", kindName(typeErr.Type)),
+        }
+    }
+    // encoding/json has no type for these
+    if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+        return &FieldError{
+            Field: strings.Trim(name, `"`),
+            Code: CodeUnknownField,
+            Message: "Unknown field",
+        }
+    }
+    return fmt.Errorf("%w: %v", ErrSyntax, err)
+}
+
+// how a go type looks in json
+func kindName(t reflect.Type) string {
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    switch t.Kind() {
+    case reflect.String:
+        return "a string"
+    case reflect.Bool:
+        return "true or false"
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+        reflect.Float32, reflect.Float64:
+        return "a number"
+    case reflect.Slice, reflect.Array:
+        return "a list"
+    }
+    return "an object"
+}
+
+// Validator collects the errors of the checks run on a request,
+// only the first failed check of a field is kept
+type Validator struct {
+    Errors Errors
+}
+
+// Valid is true when no check failed
+func (v *Validator) Valid() bool {
+    return len(v.Errors) == 0
+}
+
+// Err is nil when no check failed, the Errors otherwise
+func (v *Validator) Err() error {
+    if v.Valid() {
+        return nil
+    }
+    return v.Errors
+}
+
+func (v *Validator) failed(field string) bool {
+    for _, fe := range v.Errors {
+        if fe.Field == field {
+            return true
+        }
+    }
+    return false
+}
+
+// Add records an error for field unless it already has one
+func (v *Validator) Add(field, code, message string) {
+    if v.failed(field) {
+        return
+    }
+    v.Errors = append(v.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Check adds the error when ok is false and reports ok
+func (v *Validator) Check(ok bool, field, code, message string) bool {
+    if !ok {
+        v.Add(field, code, message)
+    }
+    return ok
+}
+
+// Required fails for empty and blank values
+func (v *Validator) Required(field, value string) bool {
+    return v.Check(strings.TrimSpace(value) != "", field, CodeRequired, "Is required")
+}
+
+// MaxLen fails for values over n characters
+func (v *Validator) MaxLen(field, value string, n int) bool {
+    return v.Check(utf8.RuneCountInString(value) <= n, field, CodeTooLong,
+        fmt.Sprintf("Can be up to %d characters", n))
+}
+
+// Email is required and a plain address, no display name
+func (v *Validator) Email(field, value string) bool {
+    if !v.Required(field, value) {
+        return false
+    }
+    return v.Check(ValidEmail(value), field, CodeInvalidEmail, "Email is not valid")
+}
+
+// Password is required and strong enough to be a new password
+func (v *Validator) Password(field, value string) bool {
+    if !v.Required(field, value) {
+        return false
+    }
+    if err := PasswordStrength(value); err != nil {
+        v.Add(field, CodeWeakPassword, err.Error())
+        return false
+    }
+    return true
+}
+
+// UUID is required and parsed, uuid.Nil when it isn't one
+func (v *Validator) UUID(field, value string) uuid.UUID {
+    if !v.Required(field, value) {
+        return uuid.Nil
+    }
+    id, err := uuid.Parse(value)
+    if !v.Check(err == nil, field, CodeInvalidUUID, "Must be a UUID") {
+        return uuid.Nil
+    }
+    return id
+}
+
+// ValidEmail is true for addresses like user@example.com
+func ValidEmail(email string) bool {
+    if len(email) > maxEmailLen {
+        return false
+    }
+    addr, err := mail.ParseAddress(email)
+    if err != nil || addr.Name != "" || addr.Address != email {
+        return false
+    }
+    domain := email[strings.LastIndex(email, "@")+1:]
+    return strings.Contains(domain, ".") &&
+        !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// PasswordStrength explains why password is too weak, nil when it's fine:
+// at least MinPasswordLen characters, at most MaxPasswordBytes bytes,
+// with letters and also numbers or symbols
+func PasswordStrength(password string) error {
+    if utf8.RuneCountInString(password) < MinPasswordLen {
+        return fmt.Errorf("Password must have at least %d characters", MinPasswordLen)
+    }
+    if len(password) > MaxPasswordBytes {
+        return fmt.Errorf("Password can be up to %d bytes", MaxPasswordBytes)
+    }
+    letter, other := false, false
+    for _, c := range password {
+        if unicode.IsLetter(c) {
+            letter = true
+        } else if !unicode.IsSpace(c) {
+            other = true
+        }
+    }
+    if !letter || !other {
+        return errors.New("Password must mix letters with numbers or symbols")
+    }
+    return nil
+}
@@ -0,0 +1,158 @@
+package validate
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type userParams struct {
+    Email    string `json:"email"`
+    Password string `json:"password"`
+    Age      int    `json:"age"`
+}
+
+func decode(body string, maxBytes int64) (userParams, error) {
+    r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+    w := httptest.NewRecorder()
+    params := userParams{}
+    err := Decode(w, r, &params, maxBytes)
+    return params, err
+}
+
+func TestDecode(t *testing.T) {
+    params, err := decode(`{"email": "a@example.com", "password": "hunter22"}`, 1024)
+    if err != nil {
+        t.Fatalf("Couldn't decode body: %v", err)
+    }
+    if params.Email != "a@example.com" || params.Password != "hunter22" {
+        t.Errorf("Decoded %+v", params)
+    }
+}
+
+func TestDecodeLenient(t *testing.T) {
+    body := `{"email": "a@example.com", "plan": "red"}`
+    if _, err := decode(body, 1024); err == nil {
+        t.Errorf("Expected an unknown field error")
+    }
+
+    r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+    params := userParams{}
+    if err := DecodeLenient(httptest.NewRecorder(), r, &params, 1024); err != nil {
+        t.Fatalf("Couldn't decode body: %v", err)
+    }
+    if params.Email != "a@example.com" {
+        t.Errorf("Decoded %+v", params)
+    }
+}
+
+func TestDecodeErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        body string
+        err  error
+    }{
+        {"empty", "", ErrEmpty},
+        {"syntax", `{"email": `, ErrSyntax},
+        {"two values", `{} {}`, ErrSyntax},
+        {"not an object", `[]`, ErrSyntax},
+        {"too large", `{"email": "` + strings.Repeat("a", 100) + `"}`, ErrTooLarge},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := decode(tt.body, 64)
+            if !errors.Is(err, tt.err) {
+                t.Errorf("Got %v, want %v", err, tt.err)
+            }
+        })
+    }
+}
+
+func TestDecodeFieldErrors(t *testing.T) {
+    tests := []struct {
+        body  string
+        field string
+        code  string
+    }{
+        {`{"email": "a@example.com", "admin": true}`, "admin", CodeUnknownField},
+        {`{"age": "old"}`, "age", CodeInvalidType},
+        {`{"email": 1}`, "email", CodeInvalidType},
+    }
+    for _, tt := range tests {
+        _, err := decode(tt.body, 1024)
+        var fe *FieldError
+        if !errors.As(err, &fe) {
+            t.Errorf("%s: got %v, want a field error", tt.body, err)
+            continue
+        }
+        if fe.Field != tt.field || fe.Code != tt.code {
+            t.Errorf("%s: got %s %s, want %s %s", tt.body, fe.Field, fe.Code, tt.field, tt.code)
+        }
+    }
+}
+
+func TestValidEmail(t *testing.T) {
+    valid := []string{"a@example.com", "first.last+tag@mail.example.org"}
+    invalid := []string{"", "a", "a@", "@example.com", "a@localhost", "a@example.", "Al <a@example.com>", " a@example.com"}
+    for _, email := range valid {
+        if !ValidEmail(email) {
+            t.Errorf("%q should be valid", email)
+        }
+    }
+    for _, email := range invalid {
+        if ValidEmail(email) {
+            t.Errorf("%q shouldn't be valid", email)
+        }
+    }
+}
+
+func TestPasswordStrength(t *testing.T) {
+    strong := []string{"hunter22", "correct horse battery!", "contraseña1"}
+    weak := []string{"", "short1", "onlyletters", "12345678", strings.Repeat("a1", 40)}
+    for _, p := range strong {
+        if err := PasswordStrength(p); err != nil {
+            t.Errorf("%q should be strong: %v", p, err)
+        }
+    }
+    for _, p := range weak {
+        if PasswordStrength(p) == nil {
+            t.Errorf("%q shouldn't be strong", p)
+        }
+    }
+}
+
+func TestValidator(t *testing.T) {
+    v := Validator{}
+    v.Email("email", "")
+    v.Email("email", "nope")
+    v.Password("password", "weak")
+    id := v.UUID("user_id", "not-a-uuid")
+
+    if v.Valid() || v.Err() == nil {
+        t.Fatal("Validator should have failed")
+    }
+    want := []FieldError{
+        {Field: "email", Code: CodeRequired},
+        {Field: "password", Code: CodeWeakPassword},
+        {Field: "user_id", Code: CodeInvalidUUID},
+    }
+    if len(v.Errors) != len(want) {
+        t.Fatalf("Got %d errors, want %d: %v", len(v.Errors), len(want), v.Errors)
+    }
+    for i, fe := range v.Errors {
+        if fe.Field != want[i].Field || fe.Code != want[i].Code {
+            t.Errorf("Error %d is %s %s, want %s %s", i, fe.Field, fe.Code, want[i].Field, want[i].Code)
+        }
+    }
+    if id.String() != "00000000-0000-0000-0000-000000000000" {
+        t.Errorf("Invalid uuid parsed to %s", id)
+    }
+
+    v = Validator{}
+    v.Email("email", "a@example.com")
+    v.UUID("user_id", "3311741c-680c-4546-99f3-fc9efac2036c")
+    if !v.Valid() || v.Err() != nil {
+        t.Errorf("Validator failed: %v", v.Errors)
+    }
+}
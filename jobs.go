@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// run fn now and then every interval, in the background
+func runEvery(interval time.Duration, fn func(ctx context.Context)) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            ctx, cancel := context.WithTimeout(context.Background(), interval)
+            fn(ctx)
+            cancel()
+            <-ticker.C
+        }
+    }()
+}
+
+// background jobs started with the server
+func (cfg *apiConfig) startJobs() {
+    // purge accounts after their deletion grace period
+    runEvery(time.Hour, cfg.purgeDeletedUsers)
+    // hard delete chirps past their retention period
+    runEvery(time.Hour, cfg.purgeDeletedChirps)
+    // publish scheduled chirps when they are due
+    runEvery(schedulerInterval, cfg.publishScheduledChirps)
+    // remove uploads nobody attached and media of purged chirps
+    runEvery(time.Hour, cfg.purgeOrphanMedia)
+    // process uploaded images, retrying the ones left pending
+    cfg.startMediaWorkers()
+    runEvery(time.Minute, cfg.requeuePendingMedia)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+// like a chirp, liking it again is a no-op
+// liking a rechirp likes its original
+func (cfg *apiConfig) like_chirp(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to like", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    chirp, err := cfg.originalChirp(r.Context(), userID, chirpID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Chirp to like not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    liked, err := cfg.dbQueries.CreateLike(r.Context(), database.CreateLikeParams{
+        UserID: userID,
+        ChirpID: chirp.ID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error creating like", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    // liking again doesn't notify again
+    if liked > 0 {
+        cfg.notify(r.Context(), chirp.UserID, notificationLike, userID, chirp.ID)
+    }
+    w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unlike_chirp(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to unlike", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    deleted, err := cfg.dbQueries.DeleteLike(r.Context(), database.DeleteLikeParams{
+        UserID: userID,
+        ChirpID: chirpID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error deleting like", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if deleted == 0 {
+        respondStatus(w, r, 404)
+        return
+    }
+    w.WriteHeader(204)
+}
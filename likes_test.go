@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestLikeChirp(t *testing.T) {
+    tests := []struct {
+        name     string
+        // like the rechirp of the original instead
+        ofRepost bool
+        missing  bool
+        blocked  bool
+        // liked before, nothing is inserted
+        again    bool
+        status   int
+    }{
+        {name: "chirp", status: 204},
+        {name: "rechirp", ofRepost: true, status: 204},
+        {name: "not found", missing: true, status: 404},
+        {name: "blocked", blocked: true, status: 404},
+        {name: "already liked", again: true, status: 204},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            liker := testUser(fake, "user")
+            now := time.Now().UTC()
+            original := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: author.ID}
+            repostOf := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: uuid.New(),
+                RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+            if !tt.missing {
+                answerChirps(fake, original, repostOf)
+            }
+            fake.answer("IsBlocked", tt.blocked)
+            fake.answer("IsHidden", false)
+            if tt.again {
+                fake.answer("CreateLike", int64(0))
+            }
+            target := original.ID
+            if tt.ofRepost {
+                target = repostOf.ID
+            }
+
+            rec := serve(t, "POST /api/chirps/{chirpID}/like", http.HandlerFunc(cfg.like_chirp), "/api/chirps/"+target.String()+"/like", testToken(t, liker.ID, time.Hour), "")
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+
+            liked := fake.called("CreateLike")
+            notified := fake.called("CreateNotification")
+            if tt.status != 204 {
+                if len(liked) != 0 || len(notified) != 0 {
+                    t.Errorf("Liked %v, notified %v", liked, notified)
+                }
+                return
+            }
+            // always the original, rechirps aren't liked
+            if len(liked) != 1 || liked[0].args[0] != liker.ID || liked[0].args[1] != original.ID {
+                t.Fatalf("Got likes %v", liked)
+            }
+            if tt.again {
+                if len(notified) != 0 {
+                    t.Errorf("Liking again notified %v", notified)
+                }
+                return
+            }
+            if len(notified) != 1 || notified[0].args[0] != author.ID || notified[0].args[1] != (uuid.NullUUID{UUID: liker.ID, Valid: true}) ||
+                notified[0].args[2] != notificationLike {
+                t.Errorf("Got notifications %v", notified)
+            }
+        })
+    }
+}
+
+func TestUnlikeChirp(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    chirpID := uuid.New()
+    token := testToken(t, user.ID, time.Hour)
+
+    fake.answer("DeleteLike", int64(0))
+    rec := serve(t, "DELETE /api/chirps/{chirpID}/like", http.HandlerFunc(cfg.unlike_chirp), "/api/chirps/"+chirpID.String()+"/like", token, "")
+    if rec.Code != 404 {
+        t.Errorf("Unliking a chirp not liked got status %d", rec.Code)
+    }
+
+    fake.answer("DeleteLike", int64(1))
+    rec = serve(t, "DELETE /api/chirps/{chirpID}/like", http.HandlerFunc(cfg.unlike_chirp), "/api/chirps/"+chirpID.String()+"/like", token, "")
+    if rec.Code != 204 {
+        t.Fatalf("Got status %d", rec.Code)
+    }
+    if deleted := fake.called("DeleteLike"); deleted[len(deleted)-1].args[0] != user.ID || deleted[len(deleted)-1].args[1] != chirpID {
+        t.Errorf("Got deletes %v", deleted)
+    }
+}
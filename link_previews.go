@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/elfabri/bdd-Chirpy-project/internal/unfurl"
+)
+
+// link preview caching
+const (
+    // previews are refreshed after this long
+    linkPreviewTTL = 24 * time.Hour
+    // urls without a preview are retried after this long
+    linkPreviewRetry = time.Hour
+    // fetches running at the same time, more are skipped
+    unfurlWorkers = 4
+    unfurlTimeout = 30 * time.Second
+)
+
+// preview of the first link of a chirp
+type cardRes struct {
+    URL         string `json:"url"`
+    Title       string `json:"title,omitempty"`
+    Description string `json:"description,omitempty"`
+    ImageURL    string `json:"image_url,omitempty"`
+    SiteName    string `json:"site_name,omitempty"`
+}
+
+func toCardRes(preview database.LinkPreview) *cardRes {
+    return &cardRes{
+        URL: preview.Url,
+        Title: preview.Title,
+        Description: preview.Description,
+        ImageURL: preview.ImageUrl,
+        SiteName: preview.SiteName,
+    }
+}
+
+// fill in the cached previews of chirp responses,
+// chirps whose link wasn't fetched yet go without a card
+func (cfg *apiConfig) attachCards(ctx context.Context, res []chirpRes) error {
+    urls := []string{}
+    for _, chirp := range res {
+        if link := unfurl.FirstURL(chirp.Body); link != "" {
+            urls = append(urls, link)
+        }
+    }
+    if len(urls) == 0 {
+        return nil
+    }
+
+    previews, err := cfg.dbQueries.GetLinkPreviews(ctx, urls)
+    if err != nil {
+        return err
+    }
+    cards := map[string]*cardRes{}
+    for _, preview := range previews {
+        cards[preview.Url] = toCardRes(preview)
+    }
+    for i := range res {
+        res[i].Card = cards[unfurl.FirstURL(res[i].Body)]
+    }
+    return nil
+}
+
+// fetch the preview of a new chirp's link in the background,
+// subscribers get a chirp.updated event once it has a card
+func (cfg *apiConfig) unfurlChirp(ctx context.Context, chirp chirpRes) {
+    link := unfurl.FirstURL(chirp.Body)
+    if link == "" {
+        return
+    }
+
+    select {
+    case cfg.unfurlSlots <- struct{}{}:
+    default:
+        slog.WarnContext(ctx, "Too many link previews in progress, skipping", "link", link)
+        return
+    }
+
+    ctx = context.WithoutCancel(ctx)
+    go func() {
+        defer func() { <-cfg.unfurlSlots }()
+        ctx, cancel := context.WithTimeout(ctx, unfurlTimeout)
+        defer cancel()
+
+        cached, err := cfg.dbQueries.GetLinkPreview(ctx, link)
+        if err == nil {
+            ttl := linkPreviewRetry
+            if cached.Ok {
+                ttl = linkPreviewTTL
+            }
+            if time.Since(cached.FetchedAt) < ttl {
+                return
+            }
+        }
+
+        card, err := cfg.unfurler.Fetch(ctx, link)
+        if err != nil {
+            slog.ErrorContext(ctx, "Couldn't get a preview", "link", link, "err", err)
+        }
+        preview := database.UpsertLinkPreviewParams{
+            Url: link,
+            Ok: err == nil,
+            Title: card.Title,
+            Description: card.Description,
+            ImageUrl: card.ImageURL,
+            SiteName: card.SiteName,
+        }
+        if err := cfg.dbQueries.UpsertLinkPreview(ctx, preview); err != nil {
+            slog.ErrorContext(ctx, "Error saving preview", "link", link, "err", err)
+            return
+        }
+
+        // a refreshed card that was already shown isn't worth an event
+        if preview.Ok && chirp.Card == nil {
+            chirp.Card = toCardRes(database.LinkPreview{
+                Url: link,
+                Title: preview.Title,
+                Description: preview.Description,
+                ImageUrl: preview.ImageUrl,
+                SiteName: preview.SiteName,
+            })
+            cfg.publishChirpEvent(events.ChirpUpdated, chirp)
+        }
+    }()
+}
@@ -1,22 +1,33 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
-	"sync/atomic"
+	"syscall"
 	"time"
     "sort"
 
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
 	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/blob"
 	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/elfabri/bdd-Chirpy-project/internal/logging"
+	"github.com/elfabri/bdd-Chirpy-project/internal/unfurl"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // bdd test
@@ -24,34 +35,142 @@ var cachedChirpID uuid.UUID
 
 // stateful handlers
 type apiConfig struct {
-    // atomic for safely increment
-    // and read an integer value
-    // across multiple goroutines (HTTP requests)
-	fileserverHits atomic.Int32
+    // series served on /metrics, the /app hit counter among them
+    metrics *appMetrics
+    // bearer token scrapers send to /metrics, required outside PLATFORM=dev
+    metricsToken string
+    // spans of requests, queries and outgoing calls
+    tracerProvider *sdktrace.TracerProvider
+    tracer trace.Tracer
+    db *sql.DB
     dbQueries *database.Queries
     platform string
+    // signing up with this email makes an admin, only with PLATFORM=dev
+    devAdminEmail string
     secret string
     polka_key string
-}
-
-type errors struct {
-    Error string `json:"error"`
+    // public url used in feed permalinks and activitypub ids,
+    // feeds and federation are off without it
+    base_url string
+    // live events for websocket clients
+    events *events.Hub
+    // client for requests to other fediverse servers
+    fedClient *http.Client
+    // uploaded media files
+    media blob.BlobStore
+    // uploaded images waiting for processing
+    mediaQueue chan uuid.UUID
+    // link previews, fetched without reaching private networks
+    unfurler *unfurl.Fetcher
+    unfurlSlots chan struct{}
+    // append-only trail of security events
+    auditLog *audit.Log
 }
 
 // middleware to count views
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        cfg.fileserverHits.Add(1)
+        cfg.metrics.fileserverHits.Add(1)
+        next.ServeHTTP(w, r)
+    })
+}
+
+// 404 for directories instead of an index of their files
+func noDirListing(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+            http.NotFound(w, r)
+            return
+        }
         next.ServeHTTP(w, r)
     })
 }
 
+// get the user id from the access token in the authorization header
+func (cfg *apiConfig) authenticatedUser(r *http.Request) (uuid.UUID, error) {
+    user, err := cfg.authenticatedAccount(r)
+    if err != nil {
+        return uuid.UUID{}, err
+    }
+    return user.ID, nil
+}
+
+// the user of the access token in the authorization header
+func (cfg *apiConfig) authenticatedAccount(r *http.Request) (database.User, error) {
+    token, err := auth.GetBearerToken(r.Header)
+    if err != nil {
+        return database.User{}, err
+    }
+    userID, err := auth.ValidateJWT(token, cfg.secret)
+    if err != nil {
+        return database.User{}, err
+    }
+    return cfg.activeAccount(r.Context(), userID)
+}
+
+// access tokens outlive account deletion, suspension and forced
+// password resets, the account must still exist and be allowed in
+func (cfg *apiConfig) activeAccount(ctx context.Context, userID uuid.UUID) (database.User, error) {
+    user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+    if err != nil {
+        return database.User{}, err
+    }
+    if user.SuspendedAt.Valid {
+        return database.User{}, &suspendedError{user: user}
+    }
+    if passwordResetPending(user) {
+        return database.User{}, errPasswordResetRequired
+    }
+    return user, nil
+}
+
+// activeAccount's error for suspended users
+type suspendedError struct {
+    user database.User
+}
+
+func (e *suspendedError) Error() string {
+    return "account suspended"
+}
+
+// the 403 with the reason for suspended users and pending
+// password resets, otherwise a 401
+func respondAuthError(w http.ResponseWriter, r *http.Request, err error) {
+    var suspended *suspendedError
+    if errors.As(err, &suspended) {
+        respondSuspended(w, r, suspended.user)
+        return
+    }
+    if errors.Is(err, errPasswordResetRequired) {
+        respondError(w, r, 403, codePasswordResetRequired, "Password reset required")
+        return
+    }
+    respondStatus(w, r, 401)
+}
+
+func respondSuspended(w http.ResponseWriter, r *http.Request, user database.User) {
+    message := "Account suspended"
+    if user.SuspensionReason != "" {
+        message += ": " + user.SuspensionReason
+    }
+    respondError(w, r, 403, codeAccountSuspended, message)
+}
+
+// like authenticatedUser for endpoints that also work logged out,
+// uuid.Nil without an authorization header
+func (cfg *apiConfig) optionalUser(r *http.Request) (uuid.UUID, error) {
+    if r.Header.Get("Authorization") == "" {
+        return uuid.Nil, nil
+    }
+    return cfg.authenticatedUser(r)
+}
+
 // readiness handler
-func readiness(resW http.ResponseWriter, req *http.Request) {
-    req.Header.Set("Content-Type", "application/json")
-    resW.WriteHeader(200)
-    resW.Write([]byte("OK"))
+func readiness(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.WriteHeader(200)
+    w.Write([]byte("OK"))
 }
 
 func cleanChirp(badChirp string, profaneW []string) string {
@@ -103,9 +222,24 @@ func validate_chirp(sus_chirp string) (string, chirpError) {
 
 }
 
+// validate_chirp with its errors on the "body" field,
+// shared by every path that publishes a chirp
+func validateChirpBody(v *validate.Validator, body string) string {
+    validChirp, chirpError := validate_chirp(body)
+    switch chirpError.num {
+    case 1:
+        // nil chirp error
+        v.Add("body", validate.CodeRequired, "Chirp can't be empty")
+    case 2:
+        // too long (>140) chirp error
+        v.Add("body", validate.CodeTooLong, "Chirp is too long")
+    }
+    return validChirp
+}
+
 // view count handler
 func (cfg *apiConfig) views(w http.ResponseWriter, r *http.Request) {
-    r.Header.Set("Content-Type", "text/html")
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
     content := fmt.Sprintf(`
     <html>
     <body>
@@ -113,22 +247,22 @@ func (cfg *apiConfig) views(w http.ResponseWriter, r *http.Request) {
         <p>Chirpy has been visited %d times!</p>
     </body>
     </html>
-    `, cfg.fileserverHits.Load())
+    `, cfg.metrics.fileserverHits.Load())
 
     w.Write([]byte(content))
 }
 
 // view count reset
 func (cfg *apiConfig) reset(w http.ResponseWriter, r *http.Request) {
-    cfg.fileserverHits.Store(0)
     if cfg.platform != "dev" {
-        http.Error(w, "Forbidden", http.StatusForbidden)
+        respondStatus(w, r, 403)
         return
     }
 
     err := cfg.dbQueries.DeleteAllUsers(r.Context())
     if err != nil {
-        http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+        slog.ErrorContext(r.Context(), "Error deleting all users", "err", err)
+        respondStatus(w, r, 500)
         return
     }
 
@@ -137,27 +271,28 @@ func (cfg *apiConfig) reset(w http.ResponseWriter, r *http.Request) {
 
 // create user handler
 func (cfg *apiConfig) create_user(w http.ResponseWriter, r *http.Request) {
-    r.Header.Set("Content-Type", "application/json")
-
     type parameters struct{
         Email string `json:"email"`
         Password string `json:"password"`
     }
 
-    decoder := json.NewDecoder(r.Body)
     params := parameters{}
-    err := decoder.Decode(&params)
-    if err != nil {
-        log.Printf("Error creating user: %v\n", err)
+    if !decodeJSON(w, r, &params) {
+        return
     }
 
-    if params.Email == "" {
-        log.Printf("invalid User email: %s\n", params.Email)
+    v := validate.Validator{}
+    v.Email("email", params.Email)
+    v.Password("password", params.Password)
+    if !checkValid(w, r, &v) {
+        return
     }
 
-    hashedPassw, err := auth.HahsPassword(params.Password)
+    hashedPassw, err := cfg.hashPassword(r.Context(), params.Password)
     if err != nil {
-        log.Printf("error hashing the user's password: %s\n", params.Email)
+        slog.ErrorContext(r.Context(), "Error hashing the user's password", "err", err)
+        respondStatus(w, r, 500)
+        return
     }
     userParams := database.CreateUserParams{
         Email: params.Email,
@@ -166,8 +301,20 @@ func (cfg *apiConfig) create_user(w http.ResponseWriter, r *http.Request) {
 
     user := database.User{}
     user, err = cfg.dbQueries.CreateUser(r.Context(), userParams)
+    if isUniqueViolation(err) {
+        respondError(w, r, 409, codeEmailTaken, "Email is already in use")
+        return
+    }
     if err != nil {
-        log.Printf("Error creating user in db: %v\n", err)
+        slog.ErrorContext(r.Context(), "Error creating user in db", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    user, err = cfg.seedDevAdmin(r.Context(), user)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error making the dev admin", "err", err)
+        respondStatus(w, r, 500)
+        return
     }
 
     type userRes struct {
@@ -186,193 +333,204 @@ func (cfg *apiConfig) create_user(w http.ResponseWriter, r *http.Request) {
         IsChirpyRed: user.IsChirpyRed,
     }
 
-    w.WriteHeader(201)
-    encodedUserRes, err := json.Marshal(userR)
-    if err != nil {
-        log.Printf("error marshalling user response: %v", err)
-    }
-    w.Write(encodedUserRes)
+    respondJSON(w, r, 201, userR)
 }
 
-// update user's email and password
-// requires access token in the header
-// new passw and email in the body
+// deprecated, the older url of PATCH /api/users/me kept for existing
+// clients: only the fields sent are changed and no current password
+// is asked, responses carry Deprecation and a Link to the successor
 func (cfg *apiConfig) update_user(w http.ResponseWriter, r *http.Request) {
-    r.Header.Set("Content-Type", "application/json")
+    w.Header().Set("Deprecation", "true")
+    w.Header().Set("Link", `</api/users/me>; rel="successor-version"`)
 
-    token, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        log.Printf("Error getting token from bearer: %s", err)
-        w.WriteHeader(401)
-        respError := errors {
-            Error: "Something went wrong",
-        }
-        encodedError, err := json.Marshal(respError)
-        if err != nil {
-            fmt.Printf("Error encoding Error JSON: %s", err)
-            return
-        }
-        w.Write(encodedError)
-        return
-    }
-
-    // user verification with jwt
-    userID, err := auth.ValidateJWT(token, cfg.secret)
+    user, err := cfg.authenticatedAccount(r)
     if err != nil {
-        log.Printf("Error, invalid refresh token: %s\n", err)
-        w.WriteHeader(401)
-        respError := errors {
-            Error: "Something went wrong",
-        }
-        encodedError, err := json.Marshal(respError)
-        if err != nil {
-            fmt.Printf("Error encoding Error JSON: %s\n", err)
-            return
-        }
-        w.Write(encodedError)
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
         return
     }
 
-    // get new email and passw from request body
+    // every field is optional, missing fields are left unchanged
     type parameters struct{
-        Email string `json:"email"`
-        Password string `json:"password"`
+        Email *string `json:"email"`
+        Password *string `json:"password"`
+        profileParams
     }
 
-    decoder := json.NewDecoder(r.Body)
     params := parameters{}
-    err = decoder.Decode(&params)
-    if err != nil {
-        log.Printf("Error decoding user's login info: %v\n", err)
-        w.WriteHeader(401)
+    if !decodeJSON(w, r, &params) {
         return
     }
 
-    hashedPassw, err := auth.HahsPassword(params.Password)
-    if err != nil {
-        log.Printf("error hashing the user's password: %s\n", params.Email)
-        w.WriteHeader(401)
-        return
+    v := validate.Validator{}
+    if params.Email != nil {
+        v.Email("email", *params.Email)
     }
-
-    updateUserParams := database.UpdateUserParams {
-        ID: userID,
-        Email: params.Email,
-        HashedPassword: hashedPassw,
+    if params.Password != nil {
+        v.Password("password", *params.Password)
     }
-
-    err = cfg.dbQueries.UpdateUser(r.Context(), updateUserParams)
-    if err != nil {
-        log.Printf("Error updating user in db: %v\n", err)
-        w.WriteHeader(401)
+    params.profileParams.check(&v)
+    if !checkValid(w, r, &v) {
         return
     }
 
-    // get user with userID
-    userUpdated, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
-    if err != nil {
-        log.Printf("Error, couldn't find user after update: %s\n", err)
-        w.WriteHeader(401)
-        respError := errors {
-            Error: "Something went wrong",
+    if params.Email != nil || params.Password != nil {
+        updateUserParams := database.UpdateUserParams {
+            ID: user.ID,
+            Email: user.Email,
+            HashedPassword: user.HashedPassword,
+        }
+
+        if params.Email != nil {
+            updateUserParams.Email = *params.Email
+        }
+
+        if params.Password != nil {
+            hashedPassw, err := cfg.hashPassword(r.Context(), *params.Password)
+            if err != nil {
+                slog.ErrorContext(r.Context(), "Error hashing the user's password", "err", err)
+                respondStatus(w, r, 500)
+                return
+            }
+            updateUserParams.HashedPassword = hashedPassw
+        }
+
+        err = cfg.dbQueries.UpdateUser(r.Context(), updateUserParams)
+        if isUniqueViolation(err) {
+            respondError(w, r, 409, codeEmailTaken, "Email is already in use")
+            return
         }
-        encodedError, err := json.Marshal(respError)
         if err != nil {
-            fmt.Printf("Error encoding Error JSON: %s\n", err)
+            slog.ErrorContext(r.Context(), "Error updating user in db", "err", err)
+            respondStatus(w, r, 500)
             return
         }
-        w.Write(encodedError)
-        return
-    }
-
-    // return user updated
-    type userRes struct {
-        Id string `json:"id"`
-        CreatedAt string `json:"created_at"`
-        UpdatedAt string `json:"updated_at"`
-        Email string `json:"email"`
+        if params.Password != nil {
+            cfg.recordAudit(r, audit.Event{
+                Type: audit.PasswordChanged,
+                ActorID: user.ID,
+                TargetType: "user",
+                TargetID: user.ID.String(),
+                Outcome: audit.Success,
+            })
+        }
     }
 
-    userR := userRes {
-        Id: userUpdated.ID.String(),
-        CreatedAt: userUpdated.CreatedAt.String(),
-        UpdatedAt: userUpdated.UpdatedAt.String(),
-        Email: userUpdated.Email,
+    if !params.profileParams.isEmpty() {
+        _, err = cfg.dbQueries.UpdateUserProfile(r.Context(), mergeProfile(user, params.profileParams))
+        if isUniqueViolation(err) {
+            respondError(w, r, 409, codeHandleTaken, "Handle is already taken")
+            return
+        }
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error updating user profile in db", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
     }
 
-    encodedUserRes, err := json.Marshal(userR)
+    userUpdated, err := cfg.dbQueries.GetUserByID(r.Context(), user.ID)
     if err != nil {
-        log.Printf("error marshalling user response: %v", err)
+        slog.ErrorContext(r.Context(), "Error, couldn't find user after update", "err", err)
+        respondStatus(w, r, 500)
+        return
     }
-    w.Write(encodedUserRes)
-    w.WriteHeader(200)
+
+    respondJSON(w, r, 200, toAccountRes(userUpdated))
 }
 
 // login handler
 func (cfg *apiConfig) login_user(w http.ResponseWriter, r *http.Request) {
-    r.Header.Set("Content-Type", "application/json")
-
     type parameters struct{
         Email string `json:"email"`
         Password string `json:"password"`
     }
 
-    decoder := json.NewDecoder(r.Body)
     params := parameters{}
-    err := decoder.Decode(&params)
-    if err != nil {
-        log.Printf("Error while user's login: %v\n", err)
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+
+    // the password rules of new accounts don't apply here,
+    // older accounts may not meet them
+    v := validate.Validator{}
+    v.Required("email", params.Email)
+    v.Required("password", params.Password)
+    if !checkValid(w, r, &v) {
+        return
     }
 
     // user lookup
     user, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
     if err != nil {
-        log.Printf("Error while searching user with email: %s, error %v\n", params.Email, err)
-        w.WriteHeader(401)
-        respError := errors{
-            Error: "Incorrect email or password",
-        }
-        encodedError, err := json.Marshal(respError)
-        if err != nil {
-            log.Printf("Error encoding Error JSON: %s", err)
-            return
-        }
-        w.Write(encodedError)
+        slog.WarnContext(r.Context(), "User to log in not found", "email", params.Email, "err", err)
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.UserLogin,
+            Outcome: audit.Failure,
+            Detail: "unknown email",
+        })
+        respondError(w, r, 401, codeInvalidCredentials, "Incorrect email or password")
         return
     }
 
     // passw comparison
-    err = auth.CheckPasswordHash(user.HashedPassword, params.Password)
+    err = cfg.checkPassword(r.Context(), user.HashedPassword, params.Password)
     if err != nil {
-        log.Printf("Error while authenticating user with email: %s, error %v\n", params.Email, err)
-        w.WriteHeader(401)
-        respError := errors{
-            Error: "Incorrect email or password",
-        }
-        encodedError, err := json.Marshal(respError)
-        if err != nil {
-            log.Printf("Error encoding Error JSON: %s", err)
-            return
-        }
-        w.Write(encodedError)
+        slog.WarnContext(r.Context(), "Wrong password at login", "email", params.Email)
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.UserLogin,
+            TargetType: "user",
+            TargetID: user.ID.String(),
+            Outcome: audit.Failure,
+            Detail: "wrong password",
+        })
+        respondError(w, r, 401, codeInvalidCredentials, "Incorrect email or password")
+        return
+    }
+
+    if passwordResetPending(user) {
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.UserLogin,
+            TargetType: "user",
+            TargetID: user.ID.String(),
+            Outcome: audit.Denied,
+            Detail: "password reset required",
+        })
+        respondError(w, r, 403, codePasswordResetRequired, "Password reset required")
+        return
+    }
+
+    if user.SuspendedAt.Valid {
+        slog.WarnContext(r.Context(), "Suspended user tried to log in", "email", params.Email)
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.UserLogin,
+            TargetType: "user",
+            TargetID: user.ID.String(),
+            Outcome: audit.Denied,
+            Detail: "suspended",
+        })
+        respondSuspended(w, r, user)
         return
     }
 
     // token gen for authentication
-    token, err := auth.MakeJWT(
+    token, err := auth.MakeJWTWithRole(
         user.ID,
+        user.Role,
         cfg.secret,
         time.Hour,
     )
     if err != nil {
-        log.Printf("Generation of jwt token failed: %s\n", err)
+        slog.ErrorContext(r.Context(), "Generation of jwt token failed", "err", err)
+        respondStatus(w, r, 500)
         return
     }
 
     // refresh token gen
     r_token, err := auth.MakeRefreshToken()
     if err != nil {
-        log.Printf("Generation of refresh token failed: %s\n", err)
+        slog.ErrorContext(r.Context(), "Generation of refresh token failed", "err", err)
+        respondStatus(w, r, 500)
         return
     }
 
@@ -386,9 +544,17 @@ func (cfg *apiConfig) login_user(w http.ResponseWriter, r *http.Request) {
 
     _, err = cfg.dbQueries.InsertRToken(r.Context(),userRTParams)
     if err != nil {
-        log.Printf("Error while inserting refresh token into db: %s\n", err)
+        slog.ErrorContext(r.Context(), "Error while inserting refresh token into db", "err", err)
+        respondStatus(w, r, 500)
         return
     }
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.UserLogin,
+        ActorID: user.ID,
+        TargetType: "user",
+        TargetID: user.ID.String(),
+        Outcome: audit.Success,
+    })
 
     type userRes struct {
         Id string `json:"id"`
@@ -410,14 +576,7 @@ func (cfg *apiConfig) login_user(w http.ResponseWriter, r *http.Request) {
         IsChirpyRed: user.IsChirpyRed,
     }
 
-    encodedUserRes, err := json.Marshal(userR)
-    if err != nil {
-        log.Printf("error marshalling user response: %v\n", err)
-        w.WriteHeader(500)
-        return
-    }
-    w.WriteHeader(200)
-    w.Write(encodedUserRes)
+    respondJSON(w, r, 200, userR)
 }
 
 // check refresh token from db
@@ -427,8 +586,8 @@ func (cfg *apiConfig) login_user(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) check_ref_tok(w http.ResponseWriter, r *http.Request) {
     rtok, err := auth.GetBearerToken(r.Header)
     if err != nil {
-        log.Printf("error while getting user token: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "Error while getting user token", "err", err)
+        respondStatus(w, r, 401)
         return
     }
 
@@ -436,30 +595,40 @@ func (cfg *apiConfig) check_ref_tok(w http.ResponseWriter, r *http.Request) {
     // check existance, expireDate and if it was revoked
     rT, err := cfg.dbQueries.GetUserFromRToken(r.Context(), rtok)
     if err != nil {
-        log.Printf("Error while getting user with refresh_token, error: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "Error while getting user with refresh token", "err", err)
+        respondStatus(w, r, 401)
         return
     }
     if rT.ExpiresAt.Before(time.Now()) {
-        log.Printf("Token has already expired\n")
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "Token has already expired")
+        respondStatus(w, r, 401)
         return
     }
     if rT.RevokedAt.Valid {
-        log.Printf("Token has been revoked\n")
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "Token has been revoked")
+        respondStatus(w, r, 401)
+        return
+    }
+
+    // the account may have been deleted since the login, or its role changed
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), rT.UserID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error getting user of refresh token", "err", err)
+        respondStatus(w, r, 401)
         return
     }
 
     // token gen for authentication
-    jwt, err := auth.MakeJWT(
+    jwt, err := auth.MakeJWTWithRole(
         rT.UserID,
+        user.Role,
         cfg.secret,
         time.Hour,
     )
 
     if err != nil {
-        log.Printf("Generation of jwt token failed: %s\n", err)
+        slog.ErrorContext(r.Context(), "Generation of jwt token failed", "err", err)
+        respondStatus(w, r, 500)
         return
     }
     type validRToken struct {
@@ -470,149 +639,137 @@ func (cfg *apiConfig) check_ref_tok(w http.ResponseWriter, r *http.Request) {
         Token: jwt,
     }
     
-    encodedValidRes, err := json.Marshal(valid)
-    if err != nil {
-        log.Printf("error marshalling refresh token: %v\n", err)
-        return
-    }
-    w.WriteHeader(200)
-    w.Write(encodedValidRes)
+    respondJSON(w, r, 200, valid)
 }
 
 // revoke refresh token
 func (cfg *apiConfig) revoke_ref_tok(w http.ResponseWriter, r *http.Request) {
     tok, err := auth.GetBearerToken(r.Header)
     if err != nil {
-        log.Printf("error while getting user token: %v\n", err)
+        slog.WarnContext(r.Context(), "Error while getting user token", "err", err)
+        respondStatus(w, r, 401)
+        return
+    }
+    rT, err := cfg.dbQueries.GetUserFromRToken(r.Context(), tok)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error, refresh token to revoke not found", "err", err)
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.TokenRevoked,
+            TargetType: "refresh_token",
+            Outcome: audit.Failure,
+            Detail: "unknown token",
+        })
+        respondStatus(w, r, 401)
         return
     }
     err = cfg.dbQueries.RevokeRToken(r.Context(), tok)
     if err != nil {
-        log.Printf("error while revoking user token: %v\n", err)
+        slog.ErrorContext(r.Context(), "Error while revoking user token", "err", err)
+        respondStatus(w, r, 500)
         return 
     }
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.TokenRevoked,
+        ActorID: rT.UserID,
+        TargetType: "user",
+        TargetID: rT.UserID.String(),
+        Outcome: audit.Success,
+        Detail: "one session",
+    })
     w.WriteHeader(204)
 }
 
 // create chirp
 func (cfg *apiConfig) create_chirp(w http.ResponseWriter, r *http.Request) {
-    r.Header.Set("Content-Type", "application/json")
-
-    token, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        log.Printf("Error getting token from bearer: %s", err)
-        w.WriteHeader(401)
-        respError := errors {
-            Error: "Something went wrong",
-        }
-        encodedError, err := json.Marshal(respError)
-        if err != nil {
-            fmt.Printf("Error encoding Error JSON: %s", err)
-            return
-        }
-        w.Write(encodedError)
-        return
-    }
-
     type chirpRequest struct {
         Body   string    `json:"body"`
         UserID string `json:"user_id"`
+        // optional, a future time queues the chirp
+        PublishAt *time.Time `json:"publish_at"`
+        // optional, ids from POST /api/media
+        MediaIDs []string `json:"media_ids"`
+        // optional, id of the chirp being quoted
+        QuoteOf string `json:"quote_of"`
+        // optional, id of the chirp being replied to
+        InReplyTo string `json:"in_reply_to"`
     }
 
-    decoder := json.NewDecoder(r.Body)
     params := chirpRequest{}
-    err = decoder.Decode(&params)
+    if !decodeJSON(w, r, &params) {
+        return
+    }
 
+    // user verification with jwt
+    userID, err := cfg.authenticatedUser(r)
     if err != nil {
-        log.Printf("Error decoding parameters: %s", err)
-        w.WriteHeader(500)
-        respError := errors{
-            Error: "Something went wrong",
-        }
-        encodedError, err := json.Marshal(respError)
-        if err != nil {
-            fmt.Printf("Error encoding Error JSON: %s", err)
-            return
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    // validate chirp, before anything reaches the db
+    v := validate.Validator{}
+    validChirp := validateChirpBody(&v, params.Body)
+    if params.QuoteOf != "" {
+        v.UUID("quote_of", params.QuoteOf)
+    }
+    if params.InReplyTo != "" {
+        v.UUID("in_reply_to", params.InReplyTo)
+    }
+    for i, id := range params.MediaIDs {
+        v.UUID(fmt.Sprintf("media_ids[%d]", i), id)
+    }
+    if isScheduled(params.PublishAt) {
+        if err := validatePublishAt(*params.PublishAt); err != nil {
+            v.Add("publish_at", validate.CodeInvalid, err.Error())
         }
-        w.Write(encodedError)
+    }
+    if !checkValid(w, r, &v) {
         return
     }
 
-    // user verification with jwt
-    userID, err := auth.ValidateJWT(token, cfg.secret)
+    mediaIDs, err := cfg.resolveMedia(r.Context(), userID, params.MediaIDs)
     if err != nil {
-        log.Printf("Error validating token from user: %s", err)
-        w.WriteHeader(401)
-        respError := errors {
-            Error: "Something went wrong",
-        }
-        encodedError, err := json.Marshal(respError)
-        if err != nil {
-            fmt.Printf("Error encoding Error JSON: %s", err)
-            return
-        }
-        w.Write(encodedError)
+        respondError(w, r, 400, codeBadRequest, err.Error())
         return
     }
 
-    // validate chirp
-    validChirp, chirpError := validate_chirp(params.Body)
-    if chirpError.num != 0 {
-        switch chirpError.num {
-        case 1:
-            // nil chirp error
-            log.Println("error, chirp can not be null")
-            w.WriteHeader(400)
-            respError := errors {
-                Error: "Chirp is null",
-            }
-            encodedError, err := json.Marshal(respError)
-            if err != nil {
-                fmt.Printf("Error encoding Error JSON: %s", err)
-                return
-            }
-            w.Write(encodedError)
-            return
-        case 2:
-            // too long (>140) chirp error
-            w.WriteHeader(400)
-            respError := errors{
-                Error: "Chirp is too long",
-            }
-            encodedError, err := json.Marshal(respError)
-            if err != nil {
-                fmt.Printf("Error encoding Error JSON: %s", err)
-                return
-            }
-            w.Write(encodedError)
-            return
-        }
+    quoteOf, err := cfg.resolveQuote(r.Context(), userID, params.QuoteOf)
+    if err != nil {
+        respondError(w, r, 400, codeBadRequest, err.Error())
+        return
+    }
+
+    inReplyTo, err := cfg.resolveReply(r.Context(), userID, params.InReplyTo)
+    if err != nil {
+        respondError(w, r, 400, codeBadRequest, err.Error())
+        return
     }
 
     params.Body = validChirp
+    if isScheduled(params.PublishAt) {
+        cfg.create_scheduled_chirp(w, r, userID, params.Body, *params.PublishAt, mediaIDs, quoteOf, inReplyTo)
+        return
+    }
+
     chirp := database.Chirp{}
-    chirp, err = cfg.dbQueries.CreateChirp(
-        r.Context(),
-        database.CreateChirpParams{
-            Body: params.Body,
-            UserID: userID,
-        },
-    )
+    chirp, err = cfg.createChirp(r.Context(), params.Body, userID, nil, mediaIDs, quoteOf, inReplyTo)
     if err != nil {
-        log.Printf("Error creating chirp in db: %v\n", err)
+        slog.ErrorContext(r.Context(), "Error creating chirp in db", "err", err)
+        respondStatus(w, r, 500)
+        return
     }
+    cfg.chirpPublished(r.Context(), chirp)
 
     // cache chirpID to be use on bdd tests
     cachedChirpID = chirp.ID
 
-    chirpData, err := json.Marshal(chirp)
+    res, err := cfg.loadChirp(r.Context(), chirp)
     if err != nil {
-        log.Printf("Error marshalling chirp data: %v\n", err)
+        slog.ErrorContext(r.Context(), "Error loading chirp", "err", err)
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(201)
-    w.Write(chirpData)
+    respondJSON(w, r, 201, res)
 }
 
 // get all chirps ordered by created_at
@@ -622,27 +779,38 @@ func (cfg *apiConfig) get_chirps(w http.ResponseWriter, r *http.Request) {
     // optional query "sort"
     order := r.URL.Query().Get("sort")
     var chirps []database.Chirp
-    var err error
+
+    // optional auth, muted and blocked users are left out of the viewer's timeline
+    viewerID, err := cfg.optionalUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
     if author_id != "" {
         user_id, err := uuid.Parse(author_id)
         if err != nil {
-            log.Printf("Invalid author_id: %v\n", err)
-            w.WriteHeader(404)
+            slog.WarnContext(r.Context(), "Invalid author_id", "err", err)
+            respondStatus(w, r, 404)
             return
         }
 
-        chirps, err = cfg.dbQueries.GetChirpsFromUser( r.Context(), user_id )
+        chirps, err = cfg.dbQueries.GetChirpsFromUser(r.Context(), database.GetChirpsFromUserParams{
+            UserID: user_id,
+            ViewerID: viewerID,
+        })
         if err != nil {
-            log.Printf("author_id not found: %v\n", err)
-            w.WriteHeader(404)
+            slog.WarnContext(r.Context(), "Author not found", "err", err)
+            respondStatus(w, r, 404)
             return
         }
 
     } else {
-        chirps, err = cfg.dbQueries.GetChirps( r.Context() )
+        chirps, err = cfg.dbQueries.GetChirps( r.Context(), viewerID )
         if err != nil {
-            log.Printf("Error while getting chirps: %v\n", err)
-            w.WriteHeader(404)
+            slog.ErrorContext(r.Context(), "Error while getting chirps", "err", err)
+            respondStatus(w, r, 500)
             return
         }
     }
@@ -654,72 +822,90 @@ func (cfg *apiConfig) get_chirps(w http.ResponseWriter, r *http.Request) {
         })
     }
 
-    chirpData, err := json.Marshal(chirps)
+    res, err := cfg.loadChirps(r.Context(), chirps)
     if err != nil {
-        log.Printf("Error marshalling chirp data: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "Error loading chirps", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if err := cfg.hideBlockedQuotes(r.Context(), viewerID, res); err != nil {
+        slog.ErrorContext(r.Context(), "Error getting hidden users", "err", err)
+        respondStatus(w, r, 500)
         return
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(200)
-    w.Write(chirpData)
+    respondJSON(w, r, 200, res)
 }
 
 // get specific chirp searched by chirp_id
 func (cfg *apiConfig) get_chirp_by_id(w http.ResponseWriter, r *http.Request) {
     chirpID := r.PathValue("chirpID")
 
-    if chirpID[0:2] == "${" && os.Getenv("PLATFORM") == "dev" {
+    if strings.HasPrefix(chirpID, "${") && os.Getenv("PLATFORM") == "dev" {
         // test chirp should be ${chirpID} format
-        log.Printf("Parsing test chirp: %s\n", chirpID)
+        slog.InfoContext(r.Context(), "Parsing test chirp", "chirp_id", chirpID)
         chirpID = cachedChirpID.String()
     }
 
     chirpUUID, err := uuid.Parse(chirpID)
     if err != nil {
-        log.Printf("Error parsing chirp uuid: %s;\n - error: %v\n", chirpID,  err)
-        w.WriteHeader(500)
+        slog.InfoContext(r.Context(), "Error parsing chirp uuid", "chirp_id", chirpID, "err", err)
+        respondStatus(w, r, 404)
         return
     }
 
     chirp, err := cfg.dbQueries.GetChirpByID( r.Context(), chirpUUID )
     if err != nil {
-        log.Printf("Error searching for chirp: %v\n", err)
-        w.WriteHeader(404)
+        slog.WarnContext(r.Context(), "Chirp not found", "err", err)
+        respondStatus(w, r, 404)
         return
     }
 
-    chirpData, err := json.Marshal(chirp)
+    // blocked either way looks the same as a missing chirp
+    viewerID, err := cfg.optionalUser(r)
     if err != nil {
-        log.Printf("Error marshalling chirp data: %v\n", err)
-        w.WriteHeader(500)
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+    blocked, err := cfg.blockedChirp(r.Context(), viewerID, chirp)
+    if errors.Is(err, sql.ErrNoRows) || blocked {
+        // the original of the rechirp may be deleted in between
+        respondStatus(w, r, 404)
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error checking blocks", "err", err)
+        respondStatus(w, r, 500)
         return
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(200)
-    w.Write(chirpData)
+    res, err := cfg.loadChirp(r.Context(), chirp)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error loading chirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    shown := []chirpRes{res}
+    if err := cfg.hideBlockedQuotes(r.Context(), viewerID, shown); err != nil {
+        slog.ErrorContext(r.Context(), "Error getting hidden users", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    res = shown[0]
+
+    respondJSON(w, r, 200, res)
 }
 
 // delete specific chirp
 // can only delete users' own chirps
 // user's validation on req.header
 func (cfg *apiConfig) delete_chirp_by_id(w http.ResponseWriter, r *http.Request) {
-    r.Header.Set("Content-Type", "application/json")
-
-    token, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        log.Printf("Error getting token from bearer: %s", err)
-        w.WriteHeader(401)
-        return
-    }
-
     // user verification with jwt
-    userID, err := auth.ValidateJWT(token, cfg.secret)
+    userID, err := cfg.authenticatedUser(r)
     if err != nil {
-        log.Printf("Error validating token from user: %s", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
         return
     }
 
@@ -727,57 +913,86 @@ func (cfg *apiConfig) delete_chirp_by_id(w http.ResponseWriter, r *http.Request)
 
     var chirpUUID uuid.UUID
     // chirp Id may be a test of format "${chirpID}"
-    if chirpID[0:2] == "${" && os.Getenv("PLATFORM") == "dev" {
+    if strings.HasPrefix(chirpID, "${") && os.Getenv("PLATFORM") == "dev" {
         // test chirp should be ${chirpID} format
-        log.Printf("Using cached test chirp: %s\n", chirpID)
+        slog.InfoContext(r.Context(), "Using cached test chirp", "chirp_id", chirpID)
         chirpUUID = cachedChirpID
     } else {
         chirpUUID, err = uuid.Parse(chirpID)
         if err != nil {
-            log.Printf("Error parsing chirp uuid: %s;\n - error: %v\n", chirpID,  err)
-            w.WriteHeader(500)
+            slog.InfoContext(r.Context(), "Error parsing chirp uuid", "chirp_id", chirpID, "err", err)
+            respondStatus(w, r, 404)
             return
         }
     }
 
     chirp, err := cfg.dbQueries.GetChirpByID( r.Context(), chirpUUID )
     if err != nil {
-        log.Printf("Error searching for chirp: %v\n", err)
-        w.WriteHeader(404)
+        slog.WarnContext(r.Context(), "Chirp not found", "err", err)
+        respondStatus(w, r, 404)
         return
     }
 
     if chirp.UserID != userID {
-        log.Print("Invalid chirp deletion\n")
-        log.Print("Trying to delete someone else's chirp\n")
-        w.WriteHeader(403)
+        slog.WarnContext(r.Context(), "Invalid chirp deletion")
+        slog.WarnContext(r.Context(), "Trying to delete someone else's chirp")
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.ChirpDeleted,
+            ActorID: userID,
+            TargetType: "chirp",
+            TargetID: chirp.ID.String(),
+            Outcome: audit.Denied,
+            Detail: "not the author",
+        })
+        respondStatus(w, r, 403)
         return
     }
 
-    err = cfg.dbQueries.DeleteChirp( r.Context(), chirpUUID )
+    // a rechirp has nothing to restore, it's removed for good
+    if chirp.RepostOf.Valid {
+        err = cfg.dbQueries.DeleteRepost( r.Context(), chirpUUID )
+    } else {
+        err = cfg.dbQueries.DeleteChirp( r.Context(), chirpUUID )
+    }
     if err != nil {
-        log.Printf("Error deleting chirp: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "Error deleting chirp", "err", err)
+        respondStatus(w, r, 500)
         return
     }
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.ChirpDeleted,
+        ActorID: userID,
+        TargetType: "chirp",
+        TargetID: chirp.ID.String(),
+        Outcome: audit.Success,
+    })
+    cfg.publishChirpEvent(events.ChirpDeleted, toChirpRes(chirp))
+    if !chirp.RepostOf.Valid {
+        cfg.federateChirp(r.Context(), chirp, true)
+        // its rechirps are hidden with it
+        cfg.publishRepostEvents(r.Context(), chirp.ID, events.ChirpDeleted)
+    }
 
     w.WriteHeader(204)
 }
 
 // polka handler - upgrade user to chirpy red
 func (cfg *apiConfig) upgrade_user(w http.ResponseWriter, r *http.Request) {
-    r.Header.Set("Content-Type", "application/json")
-
     apiKey, err := auth.GetAPIKey(r.Header)
     if err != nil {
-        log.Printf("error while getting api key: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "Error while getting api key", "err", err)
+        respondStatus(w, r, 401)
         return
     }
 
     if apiKey != cfg.polka_key {
-        log.Print("Wrong Api Key to upgrade user\n")
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "Wrong Api Key to upgrade user")
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.SubscriptionChanged,
+            Outcome: audit.Denied,
+            Detail: "wrong polka api key",
+        })
+        respondStatus(w, r, 401)
         return
     }
 
@@ -790,12 +1005,8 @@ func (cfg *apiConfig) upgrade_user(w http.ResponseWriter, r *http.Request) {
         Data    dataParams  `json:"data"`
     }
 
-    decoder := json.NewDecoder(r.Body)
     params := upgradeParams{}
-    err = decoder.Decode(&params)
-    if err != nil {
-        log.Printf("Error while decoding params to upgrade user: %v\n", err)
-        w.WriteHeader(500)
+    if !decodeWebhookJSON(w, r, &params) {
         return
     }
 
@@ -804,70 +1015,189 @@ func (cfg *apiConfig) upgrade_user(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    id, err := uuid.Parse(params.Data.UserID)
-    if err != nil {
-        log.Print("Invalid User ID\n")
-        log.Printf("Couldn't parse user id (%v) while upgrading to chirpy red: %v\n", id, err)
-        w.WriteHeader(500)
+    v := validate.Validator{}
+    id := v.UUID("data.user_id", params.Data.UserID)
+    if !checkValid(w, r, &v) {
         return
     }
 
-    err = cfg.dbQueries.UpgradeUser(r.Context(), id)
+    rows, err := cfg.dbQueries.UpgradeUser(r.Context(), id)
     if err != nil {
-        log.Print("User Not Found\n")
-        log.Printf("Couldn't upgrade user (id: %v) to chirpy red: %v\n", id, err)
-        w.WriteHeader(404)
+        slog.ErrorContext(r.Context(), "Error upgrading user to chirpy red", "user_id", id, "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    // unknown or deleted users
+    if rows == 0 {
+        slog.WarnContext(r.Context(), "Couldn't upgrade user to chirpy red", "user_id", id)
+        cfg.recordAudit(r, audit.Event{
+            Type: audit.SubscriptionChanged,
+            TargetType: "user",
+            TargetID: id.String(),
+            Outcome: audit.Failure,
+            Detail: params.Event,
+        })
+        respondStatus(w, r, 404)
         return
     }
-    log.Printf(" - - Upgraded user (id: %v) to chirpy red\n", id)
+    slog.InfoContext(r.Context(), "Upgraded user to chirpy red", "user_id", id)
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.SubscriptionChanged,
+        TargetType: "user",
+        TargetID: id.String(),
+        Outcome: audit.Success,
+        Detail: params.Event,
+    })
+    err = cfg.dbQueries.CreateSubscriptionEvent(r.Context(), database.CreateSubscriptionEventParams{
+        UserID: id,
+        Event: params.Event,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Couldn't record subscription event for user", "user_id", id, "err", err)
+    }
+    cfg.notify(r.Context(), id, notificationUpgrade, uuid.Nil, uuid.Nil)
     w.WriteHeader(204)
 }
 
 func main() {
     godotenv.Load()
+    // LOG_LEVEL "debug", "info", "warn" or "error"
+    slog.SetDefault(logging.New(os.Stdout, logging.ParseLevel(os.Getenv("LOG_LEVEL"))))
     dbURL := os.Getenv("DB_URL")
     db, err := sql.Open("postgres", dbURL)
     if err != nil {
-        log.Fatal("Error loading .env file")
+        slog.Error("Error opening the database", "err", err)
+        os.Exit(1)
     }
 
     mux := http.NewServeMux()
     server := &http.Server{
         Addr:       ":8080",
-        Handler:    mux,
     }
 
-    dbQueries := database.New(db)
+    baseURL := os.Getenv("BASE_URL")
+    if baseURL != "" {
+        u, err := url.Parse(baseURL)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            slog.Error("BASE_URL must be an absolute http or https url", "base_url", baseURL)
+            os.Exit(1)
+        }
+    }
+
+    mediaDir := os.Getenv("MEDIA_DIR")
+    if mediaDir == "" {
+        mediaDir = "media"
+    }
+    mediaStore, err := blob.NewLocalStore(mediaDir)
+    if err != nil {
+        slog.Error("Error opening media directory", "err", err)
+        os.Exit(1)
+    }
+
+    tracerProvider, err := newTracerProvider(context.Background())
+    if err != nil {
+        slog.Error("Error setting up tracing", "err", err)
+        os.Exit(1)
+    }
+
     apiCfg := apiConfig {
-        fileserverHits: atomic.Int32{},
-        dbQueries: dbQueries,
+        metrics: newAppMetrics(),
+        metricsToken: os.Getenv("METRICS_TOKEN"),
+        tracerProvider: tracerProvider,
+        tracer: tracerProvider.Tracer(tracerName),
+        db: db,
         platform: os.Getenv("PLATFORM"),
+        devAdminEmail: os.Getenv("DEV_ADMIN_EMAIL"),
         secret: os.Getenv("SECRET"),
         polka_key: os.Getenv("POLKA_KEY"),
-    }
+        base_url: baseURL,
+        events: events.NewHub(),
+        media: mediaStore,
+        mediaQueue: make(chan uuid.UUID, mediaQueueSize),
+        unfurler: unfurl.NewFetcher(unfurl.Options{}),
+        unfurlSlots: make(chan struct{}, unfurlWorkers),
+    }
+    apiCfg.dbQueries = database.New(apiCfg.instrumentDB(db))
+    apiCfg.auditLog = audit.New(db, apiCfg.instrumentDB)
+    // remote actors choose the key and inbox urls, so the same
+    // address checks as link previews
+    apiCfg.fedClient = unfurl.NewClient(unfurl.Options{Timeout: time.Second * 10})
+    apiCfg.fedClient.Transport = apiCfg.tracingTransport(apiCfg.fedClient.Transport)
+    server.Handler = apiCfg.middlewareRequestID(apiCfg.middlewareTracing(apiCfg.middlewareMetrics(mux)))
 
     // handler main page
-    handler := http.StripPrefix("/app/", http.FileServer(http.Dir(".")))
-    mux.Handle("/app/", apiCfg.middlewareMetricsInc(handler))
+    // only index.html and the assets directory are public,
+    // not the rest of the working directory
+    mux.Handle("GET /app/{$}", apiCfg.middlewareMetricsInc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.ServeFile(w, r, "index.html")
+    })))
+    assets := http.StripPrefix("/app/assets/", noDirListing(http.FileServer(http.Dir("assets"))))
+    mux.Handle("GET /app/assets/", apiCfg.middlewareMetricsInc(assets))
 
     // readiness endpoint
     mux.HandleFunc("GET /api/healthz", readiness)
 
+    // Prometheus scrapes, see METRICS_TOKEN
+    mux.HandleFunc("GET /metrics", apiCfg.serve_metrics)
+    if apiCfg.metricsToken == "" && apiCfg.platform != "dev" {
+        slog.Warn("METRICS_TOKEN is not set, /metrics is off")
+    }
+
+    // every /admin route needs a role, see requireRole
+    admin := func(pattern, role string, handler http.HandlerFunc) {
+        mux.Handle(pattern, apiCfg.requireRole(role, handler))
+    }
+
     // view couter show & reset
-    mux.HandleFunc("GET /admin/metrics", apiCfg.views)
-    mux.HandleFunc("POST /admin/reset", apiCfg.reset)
+    admin("GET /admin/metrics", auth.RoleAdmin, apiCfg.views)
+    admin("POST /admin/reset", auth.RoleAdmin, apiCfg.reset)
+
+    // grant or revoke roles
+    admin("PUT /admin/users/{userID}/role", auth.RoleAdmin, apiCfg.set_user_role)
+
+    // audit trail of security events
+    admin("GET /admin/audit", auth.RoleAdmin, apiCfg.get_audit_log)
+    admin("GET /admin/audit/verify", auth.RoleAdmin, apiCfg.verify_audit_log)
+
+    // user management, suspensions are in the moderation queue
+    admin("GET /admin/users", auth.RoleAdmin, apiCfg.search_users)
+    admin("GET /admin/users/{userID}", auth.RoleAdmin, apiCfg.get_admin_user)
+    admin("POST /admin/users/{userID}/password-reset", auth.RoleAdmin, apiCfg.force_password_reset)
+    admin("POST /admin/users/{userID}/revoke-tokens", auth.RoleAdmin, apiCfg.revoke_user_tokens)
+    admin("PUT /admin/users/{userID}/red", auth.RoleAdmin, apiCfg.set_chirpy_red)
+
+    // moderation queue
+    admin("GET /admin/reports", auth.RoleModerator, apiCfg.get_reports)
+    admin("POST /admin/reports/{reportID}/claim", auth.RoleModerator, apiCfg.claim_report)
+    admin("POST /admin/reports/{reportID}/resolve", auth.RoleModerator, apiCfg.resolve_report)
+    admin("POST /admin/chirps/{chirpID}/hide", auth.RoleModerator, apiCfg.hide_chirp)
+    admin("POST /admin/users/{userID}/suspend", auth.RoleModerator, apiCfg.suspend_user)
+    admin("DELETE /admin/users/{userID}/suspend", auth.RoleModerator, apiCfg.unsuspend_user)
+    admin("GET /admin/moderation/actions", auth.RoleModerator, apiCfg.get_moderation_actions)
 
     mux.Handle("/assets", http.FileServer(http.Dir("./assets/logo.png")))
 
     // create users
     mux.HandleFunc("POST /api/users", apiCfg.create_user)
 
-    // update users emails and/or passwords
+    // update users emails, passwords and/or profiles,
+    // PUT is the deprecated url without the current password check
     mux.HandleFunc("PUT /api/users", apiCfg.update_user)
+    mux.HandleFunc("PATCH /api/users/me", apiCfg.patch_user)
+
+    // account deletion and data export
+    mux.HandleFunc("DELETE /api/users/me", apiCfg.delete_user_me)
+    mux.HandleFunc("GET /api/users/me/export", apiCfg.export_user_me)
+
+    // public profile by handle or id
+    mux.HandleFunc("GET /api/users/{handleOrID}", apiCfg.get_user_profile)
 
     // login user
     mux.HandleFunc("POST /api/login", apiCfg.login_user)
 
+    // new password after a reset forced by an admin
+    mux.HandleFunc("POST /api/password-reset", apiCfg.reset_password)
+
     // refresh_token lookup
     mux.HandleFunc("POST /api/refresh", apiCfg.check_ref_tok)
 
@@ -883,13 +1213,105 @@ func main() {
     // get specific chirp by id
     mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.get_chirp_by_id)
 
+    // scheduled chirps of the logged user
+    mux.HandleFunc("GET /api/scheduled_chirps", apiCfg.get_scheduled_chirps)
+    mux.HandleFunc("PUT /api/scheduled_chirps/{chirpID}", apiCfg.reschedule_chirp)
+    mux.HandleFunc("DELETE /api/scheduled_chirps/{chirpID}", apiCfg.cancel_scheduled_chirp)
+
     // delete specific chirp by id
     mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.delete_chirp_by_id)
 
+    // restore a deleted chirp
+    mux.HandleFunc("POST /api/chirps/{chirpID}/restore", apiCfg.restore_chirp)
+
+    // rechirp a chirp or undo it
+    mux.HandleFunc("POST /api/chirps/{chirpID}/repost", apiCfg.repost_chirp)
+    mux.HandleFunc("DELETE /api/chirps/{chirpID}/repost", apiCfg.undo_repost)
+
+    // report a chirp to the moderators
+    mux.HandleFunc("POST /api/chirps/{chirpID}/report", apiCfg.report_chirp)
+
+    // block and mute other users
+    mux.HandleFunc("POST /api/users/{handleOrID}/block", apiCfg.block_user)
+    mux.HandleFunc("DELETE /api/users/{handleOrID}/block", apiCfg.unblock_user)
+    mux.HandleFunc("POST /api/users/{handleOrID}/mute", apiCfg.mute_user)
+    mux.HandleFunc("DELETE /api/users/{handleOrID}/mute", apiCfg.unmute_user)
+    mux.HandleFunc("GET /api/users/me/blocks", apiCfg.get_blocks)
+    mux.HandleFunc("GET /api/users/me/mutes", apiCfg.get_mutes)
+
+    // like a chirp or undo it
+    mux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.like_chirp)
+    mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.unlike_chirp)
+
+    // private bookmarks of the logged user
+    mux.HandleFunc("POST /api/chirps/{chirpID}/bookmark", apiCfg.bookmark_chirp)
+    mux.HandleFunc("DELETE /api/chirps/{chirpID}/bookmark", apiCfg.delete_bookmark)
+    mux.HandleFunc("GET /api/bookmarks", apiCfg.get_bookmarks)
+
+    // media uploads, attached to chirps with media_ids
+    mux.HandleFunc("POST /api/media", apiCfg.upload_media)
+    mux.HandleFunc("GET /api/media/{mediaID}", apiCfg.get_media_status)
+    mux.HandleFunc("GET /media/{mediaID}", apiCfg.get_media)
+    mux.HandleFunc("GET /media/{mediaID}/{size}", apiCfg.get_media_thumbnail)
+
+    // private drafts of the logged user
+    mux.HandleFunc("POST /api/drafts", apiCfg.create_draft)
+    mux.HandleFunc("GET /api/drafts", apiCfg.get_drafts)
+    mux.HandleFunc("GET /api/drafts/{draftID}", apiCfg.get_draft)
+    mux.HandleFunc("PUT /api/drafts/{draftID}", apiCfg.update_draft)
+    mux.HandleFunc("DELETE /api/drafts/{draftID}", apiCfg.delete_draft)
+    mux.HandleFunc("POST /api/drafts/{draftID}/publish", apiCfg.publish_draft)
+
     // upgrade user to chirpy red
     mux.HandleFunc("POST /api/polka/webhooks", apiCfg.upgrade_user)
 
-    if err := server.ListenAndServe(); err != nil {
-        fmt.Printf("error: %v", err)
+    // live timeline and notifications
+    mux.HandleFunc("GET /api/ws", apiCfg.ws_connect)
+
+    // in-app notifications
+    mux.HandleFunc("GET /api/notifications", apiCfg.get_notifications)
+    mux.HandleFunc("POST /api/notifications/read", apiCfg.read_notifications)
+    mux.HandleFunc("GET /api/notifications/preferences", apiCfg.get_notification_preferences)
+    mux.HandleFunc("PUT /api/notifications/preferences", apiCfg.update_notification_preferences)
+
+    // feeds and federation hand out absolute urls, those come from BASE_URL only
+    if apiCfg.base_url != "" {
+        // atom and rss feeds, global and per author
+        mux.HandleFunc("GET /api/feed.atom", apiCfg.get_global_feed)
+        mux.HandleFunc("GET /api/feed.rss", apiCfg.get_global_feed)
+        mux.HandleFunc("GET /api/users/{userID}/feed.atom", apiCfg.get_user_feed)
+        mux.HandleFunc("GET /api/users/{userID}/feed.rss", apiCfg.get_user_feed)
+
+        // activitypub federation
+        mux.HandleFunc("GET /.well-known/webfinger", apiCfg.webfinger)
+        mux.HandleFunc("GET /ap/users/{userID}", apiCfg.get_actor)
+        mux.HandleFunc("GET /ap/users/{userID}/outbox", apiCfg.get_outbox)
+        mux.HandleFunc("GET /ap/users/{userID}/followers", apiCfg.get_followers)
+        mux.HandleFunc("POST /ap/users/{userID}/inbox", apiCfg.post_inbox)
+    } else {
+        slog.Warn("BASE_URL is not set, feeds and federation are off")
+    }
+
+    apiCfg.startJobs()
+
+    // stop on ctrl-c or a SIGTERM from the process manager
+    stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer cancelStop()
+    go func() {
+        if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            slog.Error("Server stopped", "err", err)
+        }
+        cancelStop()
+    }()
+    <-stop.Done()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := server.Shutdown(ctx); err != nil {
+        slog.Error("Error shutting down the server", "err", err)
+    }
+    // send the spans still buffered
+    if err := apiCfg.tracerProvider.Shutdown(ctx); err != nil {
+        slog.Error("Error flushing traces", "err", err)
     }
 }
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/blob"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+// media limits
+const (
+    maxMediaPerChirp = 4
+    maxImageSize     = 10 << 20
+    maxVideoSize     = 40 << 20
+)
+
+// uploads never attached to a chirp are removed after this long
+const mediaOrphanTTL = 24 * time.Hour
+
+// accepted content types, as sniffed from the file itself, and their size limit
+// webp is left out, the standard library can't decode it to strip its metadata
+var mediaTypes = map[string]int64{
+    "image/jpeg": maxImageSize,
+    "image/png":  maxImageSize,
+    "image/gif":  maxImageSize,
+    "video/mp4":  maxVideoSize,
+    "video/webm": maxVideoSize,
+}
+
+// images go through processing before they can be served
+func isImage(contentType string) bool {
+    return strings.HasPrefix(contentType, "image/")
+}
+
+type thumbnailRes struct {
+    Size   string `json:"size"`
+    Width  int32  `json:"width"`
+    Height int32  `json:"height"`
+    URL    string `json:"url"`
+}
+
+type mediaRes struct {
+    Id          string         `json:"id"`
+    ContentType string         `json:"content_type"`
+    SizeBytes   int64          `json:"size_bytes"`
+    URL         string         `json:"url"`
+    Status      string         `json:"status"`
+    Error       string         `json:"error,omitempty"`
+    Width       int32          `json:"width,omitempty"`
+    Height      int32          `json:"height,omitempty"`
+    Blurhash    string         `json:"blurhash,omitempty"`
+    Thumbnails  []thumbnailRes `json:"thumbnails,omitempty"`
+}
+
+func mediaURL(mediaID uuid.UUID) string {
+    return "/media/" + mediaID.String()
+}
+
+func toMediaRes(media database.MediaFile, thumbnails []database.MediaThumbnail) mediaRes {
+    res := mediaRes{
+        Id: media.ID.String(),
+        ContentType: media.ContentType,
+        SizeBytes: media.SizeBytes,
+        URL: mediaURL(media.ID),
+        Status: media.Status,
+        Error: media.ProcessingError,
+        Width: media.Width,
+        Height: media.Height,
+        Blurhash: media.Blurhash,
+    }
+    for _, t := range thumbnails {
+        res.Thumbnails = append(res.Thumbnails, thumbnailRes{
+            Size: t.Size,
+            Width: t.Width,
+            Height: t.Height,
+            URL: mediaURL(media.ID) + "/" + t.Size,
+        })
+    }
+    return res
+}
+
+// multipart upload, the file goes in the "file" field
+func (cfg *apiConfig) upload_media(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for upload", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    // room for the biggest file plus the multipart framing
+    r.Body = http.MaxBytesReader(w, r.Body, maxVideoSize+(1<<20))
+    mr, err := r.MultipartReader()
+    if err != nil {
+        respondError(w, r, 400, codeBadRequest, "Expected a multipart/form-data upload")
+        return
+    }
+
+    var part io.Reader
+    for {
+        p, err := mr.NextPart()
+        if err != nil {
+            respondError(w, r, 400, codeBadRequest, "Missing file field")
+            return
+        }
+        if p.FormName() == "file" {
+            part = p
+            break
+        }
+    }
+
+    // the client's content type is not trusted, sniff the first bytes
+    head := make([]byte, 512)
+    n, err := io.ReadFull(part, head)
+    if err != nil && err != io.ErrUnexpectedEOF {
+        respondError(w, r, 400, codeBadRequest, "Empty file")
+        return
+    }
+    head = head[:n]
+    contentType := http.DetectContentType(head)
+    limit, ok := mediaTypes[contentType]
+    if !ok {
+        respondError(w, r, 415, codeUnsupportedMediaType, fmt.Sprintf("Unsupported media type %s", contentType))
+        return
+    }
+
+    mediaID := uuid.New()
+    key := mediaID.String()
+    body := io.LimitReader(io.MultiReader(bytes.NewReader(head), part), limit+1)
+    size, err := cfg.media.Put(r.Context(), key, body)
+    var maxBytesErr *http.MaxBytesError
+    if errors.As(err, &maxBytesErr) || (err == nil && size > limit) {
+        cfg.media.Delete(context.Background(), key)
+        respondError(w, r, 413, codePayloadTooLarge, fmt.Sprintf("File is too big, %s files can be up to %d MB", contentType, limit>>20))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error storing upload", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    status := mediaReady
+    if isImage(contentType) {
+        status = mediaPending
+    }
+
+    media, err := cfg.dbQueries.CreateMediaFile(r.Context(), database.CreateMediaFileParams{
+        ID: mediaID,
+        UserID: userID,
+        ContentType: contentType,
+        SizeBytes: size,
+        BlobKey: key,
+        Status: status,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error saving media", "err", err)
+        cfg.media.Delete(context.Background(), key)
+        respondStatus(w, r, 500)
+        return
+    }
+    if status == mediaPending {
+        cfg.enqueueMedia(media.ID)
+    }
+
+    respondJSON(w, r, 201, toMediaRes(media, nil))
+}
+
+// processing status of an upload, only for its owner
+func (cfg *apiConfig) get_media_status(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for media status", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    mediaID, err := uuid.Parse(r.PathValue("mediaID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    media, err := cfg.dbQueries.GetMediaFileByID(r.Context(), mediaID)
+    if err != nil || media.UserID != userID {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    thumbnails, err := cfg.dbQueries.GetThumbnailsForMedia(r.Context(), []uuid.UUID{media.ID})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting thumbnails", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    respondJSON(w, r, 200, toMediaRes(media, thumbnails))
+}
+
+// serve an uploaded file
+// only blobs with a media row can be reached, never arbitrary paths
+func (cfg *apiConfig) get_media(w http.ResponseWriter, r *http.Request) {
+    media, ok := cfg.readyMedia(w, r)
+    if !ok {
+        return
+    }
+    cfg.serveBlob(w, r, media.BlobKey, media.ContentType, media.StatusUpdatedAt)
+}
+
+// serve a thumbnail, /media/{mediaID}/{size}
+func (cfg *apiConfig) get_media_thumbnail(w http.ResponseWriter, r *http.Request) {
+    media, ok := cfg.readyMedia(w, r)
+    if !ok {
+        return
+    }
+
+    thumbnail, err := cfg.dbQueries.GetMediaThumbnail(r.Context(), database.GetMediaThumbnailParams{
+        MediaID: media.ID,
+        Size: r.PathValue("size"),
+    })
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    cfg.serveBlob(w, r, thumbnail.BlobKey, thumbnail.ContentType, media.StatusUpdatedAt)
+}
+
+// media from the {mediaID} path value, writes 404 unless it's ready
+// and the viewer may see it: their own upload, or attached to a chirp
+// that is published, not deleted or hidden, and whose author didn't block them
+// unprocessed images still have their metadata and are never served
+func (cfg *apiConfig) readyMedia(w http.ResponseWriter, r *http.Request) (database.MediaFile, bool) {
+    mediaID, err := uuid.Parse(r.PathValue("mediaID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return database.MediaFile{}, false
+    }
+
+    viewerID, err := cfg.optionalUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return database.MediaFile{}, false
+    }
+
+    media, err := cfg.dbQueries.GetMediaFileByID(r.Context(), mediaID)
+    if err != nil || media.Status != mediaReady {
+        respondStatus(w, r, 404)
+        return database.MediaFile{}, false
+    }
+    if viewerID != uuid.Nil && media.UserID == viewerID {
+        return media, true
+    }
+
+    visible, err := cfg.dbQueries.IsMediaVisible(r.Context(), database.IsMediaVisibleParams{
+        MediaID: media.ID,
+        ViewerID: viewerID,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error checking media visibility", "media_id", media.ID, "err", err)
+        respondStatus(w, r, 500)
+        return database.MediaFile{}, false
+    }
+    if !visible {
+        respondStatus(w, r, 404)
+        return database.MediaFile{}, false
+    }
+    return media, true
+}
+
+func (cfg *apiConfig) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType string, modified time.Time) {
+    f, err := cfg.media.Open(r.Context(), key)
+    if errors.Is(err, blob.ErrNotFound) {
+        slog.WarnContext(r.Context(), "Blob is missing", "key", key)
+        respondStatus(w, r, 404)
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error opening blob", "key", key, "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    defer f.Close()
+
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+    // files don't change once ready, but who may see them does:
+    // a chirp can be deleted or its author can block the viewer
+    w.Header().Set("Cache-Control", "private, max-age=3600")
+    http.ServeContent(w, r, "", modified, f)
+}
+
+// check the media a user wants to attach to a chirp
+// the returned error is meant for the client
+func (cfg *apiConfig) resolveMedia(ctx context.Context, userID uuid.UUID, ids []string) ([]uuid.UUID, error) {
+    if len(ids) > maxMediaPerChirp {
+        return nil, fmt.Errorf("A chirp can have up to %d media", maxMediaPerChirp)
+    }
+
+    mediaIDs := make([]uuid.UUID, 0, len(ids))
+    seen := map[uuid.UUID]bool{}
+    for _, id := range ids {
+        mediaID, err := uuid.Parse(id)
+        if err != nil || seen[mediaID] {
+            return nil, fmt.Errorf("Invalid media id %q", id)
+        }
+        seen[mediaID] = true
+        mediaIDs = append(mediaIDs, mediaID)
+    }
+    if len(mediaIDs) == 0 {
+        return nil, nil
+    }
+
+    found, err := cfg.dbQueries.GetMediaFilesByIDs(ctx, mediaIDs)
+    if err != nil {
+        slog.ErrorContext(ctx, "Error getting media", "err", err)
+        return nil, fmt.Errorf("Something went wrong")
+    }
+    owned := 0
+    for _, media := range found {
+        if media.Status == mediaFailed {
+            return nil, fmt.Errorf("Media %s couldn't be processed", media.ID)
+        }
+        if media.UserID == userID {
+            owned++
+        }
+    }
+    if owned != len(mediaIDs) {
+        return nil, fmt.Errorf("Media not found")
+    }
+    return mediaIDs, nil
+}
+
+// fill in the media of chirp responses
+func (cfg *apiConfig) attachMedia(ctx context.Context, res []chirpRes) error {
+    if len(res) == 0 {
+        return nil
+    }
+
+    ids := make([]uuid.UUID, 0, len(res))
+    for _, chirp := range res {
+        ids = append(ids, chirp.ID)
+    }
+    rows, err := cfg.dbQueries.GetMediaForChirps(ctx, ids)
+    if err != nil || len(rows) == 0 {
+        return err
+    }
+
+    mediaIDs := make([]uuid.UUID, 0, len(rows))
+    for _, row := range rows {
+        mediaIDs = append(mediaIDs, row.ID)
+    }
+    thumbnails, err := cfg.dbQueries.GetThumbnailsForMedia(ctx, mediaIDs)
+    if err != nil {
+        return err
+    }
+    thumbnailsOf := map[uuid.UUID][]database.MediaThumbnail{}
+    for _, t := range thumbnails {
+        thumbnailsOf[t.MediaID] = append(thumbnailsOf[t.MediaID], t)
+    }
+
+    media := map[uuid.UUID][]mediaRes{}
+    for _, row := range rows {
+        media[row.ChirpID] = append(media[row.ChirpID], toMediaRes(database.MediaFile{
+            ID: row.ID,
+            CreatedAt: row.CreatedAt,
+            UserID: row.UserID,
+            ContentType: row.ContentType,
+            SizeBytes: row.SizeBytes,
+            BlobKey: row.BlobKey,
+            Status: row.Status,
+            StatusUpdatedAt: row.StatusUpdatedAt,
+            Width: row.Width,
+            Height: row.Height,
+            Blurhash: row.Blurhash,
+            ProcessingError: row.ProcessingError,
+        }, thumbnailsOf[row.ID]))
+    }
+    for i := range res {
+        res[i].Media = media[res[i].ID]
+    }
+    return nil
+}
+
+// remove uploads that were never attached to a chirp
+// and the media left behind by purged chirps
+func (cfg *apiConfig) purgeOrphanMedia(ctx context.Context) {
+    orphans, err := cfg.dbQueries.GetOrphanMediaFiles(ctx, time.Now().Add(-mediaOrphanTTL))
+    if err != nil {
+        slog.ErrorContext(ctx, "Error getting orphan media", "err", err)
+        return
+    }
+
+    if purged := cfg.deleteMediaFiles(ctx, orphans); purged > 0 {
+        slog.InfoContext(ctx, "Purged orphan media", "count", purged)
+    }
+}
+
+// delete the blobs and thumbnails of files, then their rows
+// returns how many were deleted, a file whose blob is left stays in the db
+func (cfg *apiConfig) deleteMediaFiles(ctx context.Context, files []database.MediaFile) int {
+    ids := make([]uuid.UUID, 0, len(files))
+    for _, media := range files {
+        ids = append(ids, media.ID)
+    }
+    thumbnails, err := cfg.dbQueries.GetThumbnailsForMedia(ctx, ids)
+    if err != nil {
+        slog.ErrorContext(ctx, "Error getting thumbnails of media", "err", err)
+        return 0
+    }
+    for _, t := range thumbnails {
+        if err := cfg.media.Delete(ctx, t.BlobKey); err != nil {
+            slog.ErrorContext(ctx, "Error deleting thumbnail", "blob_key", t.BlobKey, "err", err)
+        }
+    }
+
+    deleted := 0
+    for _, media := range files {
+        if err := cfg.media.Delete(ctx, media.BlobKey); err != nil {
+            slog.ErrorContext(ctx, "Error deleting blob of media", "media_id", media.ID, "err", err)
+            continue
+        }
+        if err := cfg.dbQueries.DeleteMediaFile(ctx, media.ID); err != nil {
+            slog.ErrorContext(ctx, "Error deleting media", "media_id", media.ID, "err", err)
+            continue
+        }
+        deleted++
+    }
+    return deleted
+}
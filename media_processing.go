@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/imaging"
+	"github.com/google/uuid"
+)
+
+// media status, clients poll GET /api/media/{mediaID} until it's ready
+const (
+    mediaPending    = "pending"
+    mediaProcessing = "processing"
+    mediaReady      = "ready"
+    mediaFailed     = "failed"
+)
+
+// processing limits
+const (
+    // decoded size, a few kB of png can claim gigabytes of pixels
+    maxImagePixels = 40_000_000
+    mediaWorkers   = 2
+    mediaQueueSize = 100
+    // media processing for longer is assumed lost (server restarted)
+    mediaProcessingTimeout = 10 * time.Minute
+)
+
+// thumbnails generated for every image, by longest side
+// images smaller than a size don't get that thumbnail
+var thumbnailSizes = []struct {
+    Name    string
+    MaxSide int
+}{
+    {"small", 160},
+    {"medium", 640},
+    {"large", 1280},
+}
+
+// workers that process uploaded images off the request path
+func (cfg *apiConfig) startMediaWorkers() {
+    for i := 0; i < mediaWorkers; i++ {
+        go func() {
+            for mediaID := range cfg.mediaQueue {
+                cfg.processMedia(mediaID)
+            }
+        }()
+    }
+}
+
+// queue media for processing without blocking the upload,
+// when the queue is full the media stays pending for requeuePendingMedia
+func (cfg *apiConfig) enqueueMedia(mediaID uuid.UUID) {
+    select {
+    case cfg.mediaQueue <- mediaID:
+    default:
+        slog.Warn("Media queue is full, it will be processed later", "media_id", mediaID)
+    }
+}
+
+// pick up media left pending by a full queue or a restart
+func (cfg *apiConfig) requeuePendingMedia(ctx context.Context) {
+    reset, err := cfg.dbQueries.ResetStuckMediaFiles(ctx, time.Now().Add(-mediaProcessingTimeout))
+    if err != nil {
+        slog.ErrorContext(ctx, "Error resetting stuck media", "err", err)
+        return
+    }
+    if reset > 0 {
+        slog.WarnContext(ctx, "Reset media stuck in processing", "count", reset)
+    }
+
+    pending, err := cfg.dbQueries.GetPendingMediaFiles(ctx, mediaQueueSize)
+    if err != nil {
+        slog.ErrorContext(ctx, "Error getting pending media", "err", err)
+        return
+    }
+    for _, mediaID := range pending {
+        cfg.enqueueMedia(mediaID)
+    }
+}
+
+func (cfg *apiConfig) processMedia(mediaID uuid.UUID) {
+    ctx, cancel := context.WithTimeout(context.Background(), mediaProcessingTimeout)
+    defer cancel()
+
+    // several workers may get the same id, only one claims it
+    media, err := cfg.dbQueries.ClaimMediaFile(ctx, mediaID)
+    if err != nil {
+        return
+    }
+
+    if err := cfg.processImage(ctx, media); err != nil {
+        slog.ErrorContext(ctx, "Error processing media", "media_id", media.ID, "err", err)
+        // the original still has its metadata, it can't stay around
+        cfg.media.Delete(ctx, media.BlobKey)
+        reason := "Couldn't process the image"
+        if errors.Is(err, imaging.ErrTooLarge) {
+            reason = "Image dimensions are too large"
+        }
+        if err := cfg.dbQueries.FailMediaFile(ctx, database.FailMediaFileParams{
+            ID: media.ID,
+            ProcessingError: reason,
+        }); err != nil {
+            slog.ErrorContext(ctx, "Error marking media as failed", "media_id", media.ID, "err", err)
+        }
+    }
+}
+
+// strip the metadata of the original, make the thumbnails and the blurhash
+// thumbnails written before a failure are deleted, nothing would serve them
+func (cfg *apiConfig) processImage(ctx context.Context, media database.MediaFile) (err error) {
+    var written []string
+    defer func() {
+        if err == nil {
+            return
+        }
+        for _, key := range written {
+            if err := cfg.media.Delete(ctx, key); err != nil {
+                slog.ErrorContext(ctx, "Error deleting thumbnail of failed media", "blob_key", key, "err", err)
+            }
+        }
+    }()
+
+    f, err := cfg.media.Open(ctx, media.BlobKey)
+    if err != nil {
+        return err
+    }
+    data, err := io.ReadAll(io.LimitReader(f, maxImageSize+1))
+    f.Close()
+    if err != nil {
+        return err
+    }
+
+    img, err := imaging.Decode(data, maxImagePixels)
+    if err != nil {
+        return err
+    }
+
+    // re-encoding keeps the pixels only, exif and gps data are gone
+    var clean bytes.Buffer
+    if err := imaging.Encode(&clean, img); err != nil {
+        return err
+    }
+    size, err := cfg.media.Put(ctx, media.BlobKey, &clean)
+    if err != nil {
+        return err
+    }
+
+    bounds := img.Bounds()
+    longest := max(bounds.Dx(), bounds.Dy())
+    for _, ts := range thumbnailSizes {
+        if longest <= ts.MaxSide {
+            continue
+        }
+        thumb := imaging.Fit(img.Image, ts.MaxSide)
+        var buf bytes.Buffer
+        contentType, err := imaging.EncodeThumbnail(&buf, thumb, img.Format)
+        if err != nil {
+            return err
+        }
+        key := fmt.Sprintf("%s_%s", media.ID, ts.Name)
+        thumbSize, err := cfg.media.Put(ctx, key, &buf)
+        if err != nil {
+            return err
+        }
+        written = append(written, key)
+        err = cfg.dbQueries.UpsertMediaThumbnail(ctx, database.UpsertMediaThumbnailParams{
+            MediaID: media.ID,
+            Size: ts.Name,
+            Width: int32(thumb.Bounds().Dx()),
+            Height: int32(thumb.Bounds().Dy()),
+            ContentType: contentType,
+            SizeBytes: thumbSize,
+            BlobKey: key,
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    return cfg.dbQueries.FinishMediaFile(ctx, database.FinishMediaFileParams{
+        ID: media.ID,
+        SizeBytes: size,
+        Width: int32(bounds.Dx()),
+        Height: int32(bounds.Dy()),
+        Blurhash: imaging.Blurhash(img.Image, 4, 3),
+    })
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/blob"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+// a media file of userID with its blob stored, answered by GetMediaFileByID
+func testMedia(t *testing.T, cfg *apiConfig, fake *fakeDB, userID uuid.UUID, status string) database.MediaFile {
+    t.Helper()
+    store, err := blob.NewLocalStore(t.TempDir())
+    if err != nil {
+        t.Fatalf("Couldn't create store: %v", err)
+    }
+    cfg.media = store
+    now := time.Now().UTC()
+    media := database.MediaFile{ID: uuid.New(), CreatedAt: now, UserID: userID, ContentType: "image/png", SizeBytes: 5,
+        BlobKey: uuid.NewString() + ".png", Status: status, StatusUpdatedAt: now}
+    if _, err := store.Put(context.Background(), media.BlobKey, strings.NewReader("image")); err != nil {
+        t.Fatalf("Couldn't store blob: %v", err)
+    }
+    fake.answer("GetMediaFileByID", media)
+    return media
+}
+
+func TestGetMedia(t *testing.T) {
+    tests := []struct {
+        name    string
+        status  string
+        // "owner", "viewer" or anonymous
+        caller  string
+        visible bool
+        code    int
+    }{
+        {name: "owner", status: mediaReady, caller: "owner", code: 200},
+        {name: "on a visible chirp", status: mediaReady, caller: "viewer", visible: true, code: 200},
+        {name: "anonymous on a visible chirp", status: mediaReady, visible: true, code: 200},
+        {name: "not visible", status: mediaReady, caller: "viewer", code: 404},
+        {name: "anonymous not visible", status: mediaReady, code: 404},
+        // images keep their metadata until processed
+        {name: "pending", status: mediaPending, caller: "owner", code: 404},
+        {name: "failed", status: mediaFailed, caller: "owner", code: 404},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            owner := testUser(fake, "user")
+            viewer := testUser(fake, "user")
+            media := testMedia(t, cfg, fake, owner.ID, tt.status)
+            fake.answer("IsMediaVisible", tt.visible)
+            token := ""
+            viewerID := uuid.Nil
+            switch tt.caller {
+            case "owner":
+                token = testToken(t, owner.ID, time.Hour)
+            case "viewer":
+                token = testToken(t, viewer.ID, time.Hour)
+                viewerID = viewer.ID
+            }
+
+            rec := serve(t, "GET /media/{mediaID}", http.HandlerFunc(cfg.get_media), "/media/"+media.ID.String(), token, "")
+            if rec.Code != tt.code {
+                t.Fatalf("Got status %d, want %d", rec.Code, tt.code)
+            }
+            if tt.code == 200 {
+                if rec.Body.String() != "image" || rec.Header().Get("X-Content-Type-Options") != "nosniff" ||
+                    !strings.HasPrefix(rec.Header().Get("Cache-Control"), "private") {
+                    t.Errorf("Got %v: %s", rec.Header(), rec.Body)
+                }
+            }
+
+            checks := fake.called("IsMediaVisible")
+            if tt.status != mediaReady || tt.caller == "owner" {
+                if len(checks) != 0 {
+                    t.Errorf("Checked visibility: %v", checks)
+                }
+                return
+            }
+            if len(checks) != 1 || checks[0].args[0] != media.ID || checks[0].args[1] != viewerID {
+                t.Errorf("Got visibility checks %v", checks)
+            }
+        })
+    }
+}
+
+func TestGetMediaStatus(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    owner := testUser(fake, "user")
+    other := testUser(fake, "user")
+    media := testMedia(t, cfg, fake, owner.ID, mediaPending)
+
+    rec := serve(t, "GET /api/media/{mediaID}", http.HandlerFunc(cfg.get_media_status), "/api/media/"+media.ID.String(), testToken(t, owner.ID, time.Hour), "")
+    if rec.Code != 200 || !strings.Contains(rec.Body.String(), mediaPending) {
+        t.Errorf("The owner got status %d: %s", rec.Code, rec.Body)
+    }
+    rec = serve(t, "GET /api/media/{mediaID}", http.HandlerFunc(cfg.get_media_status), "/api/media/"+media.ID.String(), testToken(t, other.ID, time.Hour), "")
+    if rec.Code != 404 {
+        t.Errorf("Someone else got status %d", rec.Code)
+    }
+}
+
+func TestResolveMedia(t *testing.T) {
+    owner := uuid.New()
+    now := time.Now().UTC()
+    own := database.MediaFile{ID: uuid.New(), CreatedAt: now, UserID: owner, Status: mediaReady, StatusUpdatedAt: now}
+    pending := database.MediaFile{ID: uuid.New(), CreatedAt: now, UserID: owner, Status: mediaPending, StatusUpdatedAt: now}
+    failed := database.MediaFile{ID: uuid.New(), CreatedAt: now, UserID: owner, Status: mediaFailed, StatusUpdatedAt: now}
+    others := database.MediaFile{ID: uuid.New(), CreatedAt: now, UserID: uuid.New(), Status: mediaReady, StatusUpdatedAt: now}
+    files := map[uuid.UUID]database.MediaFile{own.ID: own, pending.ID: pending, failed.ID: failed, others.ID: others}
+
+    tests := []struct {
+        name  string
+        ids   []string
+        valid bool
+    }{
+        {name: "none", valid: true},
+        // pending media is attached, it's served once processed
+        {name: "own", ids: []string{own.ID.String(), pending.ID.String()}, valid: true},
+        {name: "someone else's", ids: []string{own.ID.String(), others.ID.String()}},
+        {name: "unknown", ids: []string{uuid.NewString()}},
+        {name: "failed", ids: []string{failed.ID.String()}},
+        {name: "duplicate", ids: []string{own.ID.String(), own.ID.String()}},
+        {name: "invalid id", ids: []string{"nope"}},
+        {name: "too many", ids: []string{uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            fake.on("GetMediaFilesByIDs", func(args []any) (any, error) {
+                found := []database.MediaFile{}
+                for _, id := range tt.ids {
+                    if media, ok := files[uuid.MustParse(id)]; ok {
+                        found = append(found, media)
+                    }
+                }
+                return found, nil
+            })
+
+            ids, err := cfg.resolveMedia(context.Background(), owner, tt.ids)
+            if tt.valid != (err == nil) {
+                t.Fatalf("Got error %v", err)
+            }
+            if tt.valid && len(ids) != len(tt.ids) {
+                t.Errorf("Got %v, want %v", ids, tt.ids)
+            }
+        })
+    }
+}
+
+func TestPurgeDeletedUsersMedia(t *testing.T) {
+    tests := []struct {
+        name string
+        // DeleteMediaFile fails, so the media would be lost in the cascade
+        failDelete bool
+        purged     bool
+    }{
+        {name: "blobs deleted before the purge", purged: true},
+        {name: "media left behind", failDelete: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            media := testMedia(t, cfg, fake, uuid.New(), mediaReady)
+            thumbnail := database.MediaThumbnail{MediaID: media.ID, Size: "small", Width: 1, Height: 1,
+                ContentType: "image/jpeg", SizeBytes: 5, BlobKey: uuid.NewString() + ".jpg"}
+            if _, err := cfg.media.Put(context.Background(), thumbnail.BlobKey, strings.NewReader("thumb")); err != nil {
+                t.Fatalf("Couldn't store thumbnail: %v", err)
+            }
+            fake.answer("GetMediaFilesOfDeletedUsers", []database.MediaFile{media})
+            fake.answer("GetThumbnailsForMedia", []database.MediaThumbnail{thumbnail})
+            if tt.failDelete {
+                fake.on("DeleteMediaFile", func([]any) (any, error) { return nil, errors.New("db is gone") })
+            }
+
+            cfg.purgeDeletedUsers(context.Background())
+
+            for _, key := range []string{media.BlobKey, thumbnail.BlobKey} {
+                if f, err := cfg.media.Open(context.Background(), key); err == nil {
+                    f.Close()
+                    t.Errorf("Blob %s is still stored", key)
+                }
+            }
+            if calls := fake.called("PurgeDeletedUsers"); tt.purged != (len(calls) == 1) {
+                t.Errorf("Got purges %v", calls)
+            }
+        })
+    }
+}
+
+// thumbnails already written are deleted when processing fails later on
+func TestProcessMediaFailureCleansUp(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    media := testMedia(t, cfg, fake, uuid.New(), mediaPending)
+    var buf bytes.Buffer
+    png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 700, 700)))
+    if _, err := cfg.media.Put(context.Background(), media.BlobKey, &buf); err != nil {
+        t.Fatalf("Couldn't store image: %v", err)
+    }
+    fake.answer("ClaimMediaFile", media)
+    fake.on("UpsertMediaThumbnail", func(args []any) (any, error) {
+        if args[1] == "medium" {
+            return nil, errors.New("db is gone")
+        }
+        return nil, nil
+    })
+
+    cfg.processMedia(media.ID)
+
+    if calls := fake.called("FailMediaFile"); len(calls) != 1 {
+        t.Fatalf("Got failures %v", calls)
+    }
+    for _, size := range []string{"small", "medium"} {
+        if f, err := cfg.media.Open(context.Background(), media.ID.String()+"_"+size); err == nil {
+            f.Close()
+            t.Errorf("The %s thumbnail is still stored", size)
+        }
+    }
+}
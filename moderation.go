@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+)
+
+// reasons a chirp can be reported for
+var reportReasons = map[string]bool{
+    "spam": true,
+    "harassment": true,
+    "hate": true,
+    "violence": true,
+    "sexual": true,
+    "self_harm": true,
+    "misinformation": true,
+    // needs a comment
+    "other": true,
+}
+
+const maxReportComment = 500
+
+// moderation_actions.action values
+const (
+    actionClaimReport   = "claim_report"
+    actionResolveReport = "resolve_report"
+    actionHideChirp     = "hide_chirp"
+    actionSuspendUser   = "suspend_user"
+    actionUnsuspendUser = "unsuspend_user"
+    actionSetRole       = "set_role"
+    // admin user management
+    actionRequirePasswordReset = "require_password_reset"
+    actionRevokeTokens         = "revoke_tokens"
+    actionSetChirpyRed         = "set_chirpy_red"
+)
+
+type reportRes struct {
+    ID         uuid.UUID  `json:"id"`
+    CreatedAt  time.Time  `json:"created_at"`
+    ChirpID    uuid.UUID  `json:"chirp_id"`
+    Reason     string     `json:"reason"`
+    Comment    string     `json:"comment"`
+    Status     string     `json:"status"`
+    ClaimedBy  *uuid.UUID `json:"claimed_by,omitempty"`
+    ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+    ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+    Resolution string     `json:"resolution,omitempty"`
+}
+
+func toReportRes(report database.Report) reportRes {
+    res := reportRes{
+        ID: report.ID,
+        CreatedAt: report.CreatedAt,
+        ChirpID: report.ChirpID,
+        Reason: report.Reason,
+        Comment: report.Comment,
+        Status: report.Status,
+        Resolution: report.Resolution,
+    }
+    if report.ClaimedBy.Valid {
+        res.ClaimedBy = &report.ClaimedBy.UUID
+    }
+    if report.ClaimedAt.Valid {
+        res.ClaimedAt = &report.ClaimedAt.Time
+    }
+    if report.ResolvedAt.Valid {
+        res.ResolvedAt = &report.ResolvedAt.Time
+    }
+    return res
+}
+
+// report a chirp to the moderators
+// reporting a rechirp reports its original
+func (cfg *apiConfig) report_chirp(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to report", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    type parameters struct {
+        Reason  string `json:"reason"`
+        Comment string `json:"comment"`
+    }
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    if v.Required("reason", params.Reason) {
+        v.Check(reportReasons[params.Reason], "reason", validate.CodeInvalid, "Unknown report reason")
+    }
+    if params.Reason == "other" {
+        v.Check(params.Comment != "", "comment", validate.CodeRequired, "A comment is required for other reasons")
+    }
+    v.MaxLen("comment", params.Comment, maxReportComment)
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    chirp, err := cfg.originalChirp(r.Context(), userID, chirpID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Chirp to report not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+    if chirp.UserID == userID {
+        respondError(w, r, 400, codeBadRequest, "You can't report your own chirp")
+        return
+    }
+
+    report, err := cfg.dbQueries.CreateReport(r.Context(), database.CreateReportParams{
+        ReporterID: uuid.NullUUID{UUID: userID, Valid: true},
+        ChirpID: chirp.ID,
+        Reason: params.Reason,
+        Comment: params.Comment,
+    })
+    if isUniqueViolation(err) {
+        respondError(w, r, 409, codeConflict, "Chirp already reported")
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error creating report", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    respondJSON(w, r, 201, toReportRes(report))
+}
+
+// every moderator action is recorded, a failure is only logged
+// since the action itself already happened
+func (cfg *apiConfig) recordAction(ctx context.Context, params database.CreateModerationActionParams) {
+    if err := cfg.dbQueries.CreateModerationAction(ctx, params); err != nil {
+        slog.ErrorContext(ctx, "Error recording moderation action", "action", params.Action, "err", err)
+    }
+}
+
+func nullID(id uuid.UUID) uuid.NullUUID {
+    return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+// optional query "limit", 20 by default and at most 100
+func queryLimit(r *http.Request) (int32, bool) {
+    l := r.URL.Query().Get("limit")
+    if l == "" {
+        return 20, true
+    }
+    limit, err := strconv.Atoi(l)
+    if err != nil || limit < 1 || limit > 100 {
+        return 0, false
+    }
+    return int32(limit), true
+}
+
+// the moderation queue, oldest first
+// optional queries "status" (open by default, claimed or resolved) and "limit"
+func (cfg *apiConfig) get_reports(w http.ResponseWriter, r *http.Request) {
+    status := r.URL.Query().Get("status")
+    if status == "" {
+        status = "open"
+    }
+    if status != "open" && status != "claimed" && status != "resolved" {
+        respondError(w, r, 400, codeBadRequest, "Invalid status")
+        return
+    }
+    limit, ok := queryLimit(r)
+    if !ok {
+        respondStatus(w, r, 400)
+        return
+    }
+
+    rows, err := cfg.dbQueries.GetReportsByStatus(r.Context(), database.GetReportsByStatusParams{
+        Status: status,
+        Limit: limit,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting reports", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    type queuedReport struct {
+        reportRes
+        ChirpBody     string    `json:"chirp_body"`
+        ChirpAuthorID uuid.UUID `json:"chirp_author_id"`
+        ChirpHidden   bool      `json:"chirp_hidden"`
+    }
+
+    res := []queuedReport{}
+    for _, row := range rows {
+        res = append(res, queuedReport{
+            reportRes: toReportRes(database.Report{
+                ID: row.ID,
+                CreatedAt: row.CreatedAt,
+                ReporterID: row.ReporterID,
+                ChirpID: row.ChirpID,
+                Reason: row.Reason,
+                Comment: row.Comment,
+                Status: row.Status,
+                ClaimedBy: row.ClaimedBy,
+                ClaimedAt: row.ClaimedAt,
+                ResolvedAt: row.ResolvedAt,
+                Resolution: row.Resolution,
+            }),
+            ChirpBody: row.ChirpBody,
+            ChirpAuthorID: row.ChirpAuthorID,
+            ChirpHidden: row.ChirpHiddenAt.Valid,
+        })
+    }
+    respondJSON(w, r, 200, res)
+}
+
+// take an open report, so two moderators don't work on the same one
+func (cfg *apiConfig) claim_report(w http.ResponseWriter, r *http.Request) {
+    moderatorID := adminUser(r)
+
+    reportID, err := uuid.Parse(r.PathValue("reportID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    report, err := cfg.dbQueries.ClaimReport(r.Context(), database.ClaimReportParams{
+        ID: reportID,
+        ClaimedBy: nullID(moderatorID),
+    })
+    if err == sql.ErrNoRows {
+        cfg.reportConflict(w, r, reportID)
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error claiming report", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: moderatorID,
+        Action: actionClaimReport,
+        ReportID: nullID(report.ID),
+        ChirpID: nullID(report.ChirpID),
+    })
+    respondJSON(w, r, 200, toReportRes(report))
+}
+
+// close a report claimed by the moderator, with what was done about it
+func (cfg *apiConfig) resolve_report(w http.ResponseWriter, r *http.Request) {
+    moderatorID := adminUser(r)
+
+    reportID, err := uuid.Parse(r.PathValue("reportID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    type parameters struct {
+        Resolution string `json:"resolution"`
+    }
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    v.Required("resolution", params.Resolution)
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    report, err := cfg.dbQueries.ResolveReport(r.Context(), database.ResolveReportParams{
+        ID: reportID,
+        ClaimedBy: nullID(moderatorID),
+        Resolution: params.Resolution,
+    })
+    if err == sql.ErrNoRows {
+        cfg.reportConflict(w, r, reportID)
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error resolving report", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: moderatorID,
+        Action: actionResolveReport,
+        ReportID: nullID(report.ID),
+        ChirpID: nullID(report.ChirpID),
+        Note: params.Resolution,
+    })
+    respondJSON(w, r, 200, toReportRes(report))
+}
+
+// a claim or resolve that matched nothing, either the report
+// doesn't exist or it's in the wrong state for this moderator
+func (cfg *apiConfig) reportConflict(w http.ResponseWriter, r *http.Request, reportID uuid.UUID) {
+    report, err := cfg.dbQueries.GetReportByID(r.Context(), reportID)
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    msg := "Report is claimed by another moderator"
+    switch report.Status {
+    case "open":
+        msg = "Claim the report first"
+    case "resolved":
+        msg = "Report is already resolved"
+    }
+    respondError(w, r, 409, codeConflict, msg)
+}
+
+// take a chirp down, its author can't restore it
+// resolves every pending report of the chirp
+func (cfg *apiConfig) hide_chirp(w http.ResponseWriter, r *http.Request) {
+    moderatorID := adminUser(r)
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    type parameters struct {
+        Note string `json:"note"`
+    }
+    params := parameters{}
+    // the note is optional, so is the body
+    if !decodeOptionalJSON(w, r, &params) {
+        return
+    }
+
+    chirp, err := cfg.dbQueries.HideChirp(r.Context(), chirpID)
+    if err == sql.ErrNoRows {
+        respondError(w, r, 404, codeNotFound, "Chirp not found or already hidden")
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error hiding chirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    if _, err := cfg.dbQueries.ResolveReportsForChirp(r.Context(), database.ResolveReportsForChirpParams{
+        ChirpID: chirp.ID,
+        Resolution: "chirp hidden",
+    }); err != nil {
+        slog.ErrorContext(r.Context(), "Error resolving reports of hidden chirp", "err", err)
+    }
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: moderatorID,
+        Action: actionHideChirp,
+        ChirpID: nullID(chirp.ID),
+        UserID: nullID(chirp.UserID),
+        Note: params.Note,
+    })
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.ChirpDeleted,
+        ActorID: moderatorID,
+        TargetType: "chirp",
+        TargetID: chirp.ID.String(),
+        Outcome: audit.Success,
+        Detail: "hidden by a moderator",
+    })
+
+    cfg.publishChirpEvent(events.ChirpDeleted, toChirpRes(chirp))
+    if !chirp.RepostOf.Valid {
+        cfg.federateChirp(r.Context(), chirp, true)
+        cfg.publishRepostEvents(r.Context(), chirp.ID, events.ChirpDeleted)
+    }
+    w.WriteHeader(204)
+}
+
+// suspended users can't log in or chirp, their sessions are revoked
+func (cfg *apiConfig) suspend_user(w http.ResponseWriter, r *http.Request) {
+    moderatorID := adminUser(r)
+
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    if userID == moderatorID {
+        respondError(w, r, 400, codeBadRequest, "You can't suspend yourself")
+        return
+    }
+
+    type parameters struct {
+        Reason string `json:"reason"`
+    }
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    v.Required("reason", params.Reason)
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    // so a moderator can't lock out the admins
+    if user.Role != auth.RoleUser {
+        respondError(w, r, 403, codeForbidden, "Revoke the user's role before suspending them")
+        return
+    }
+
+    if err := cfg.dbQueries.SuspendUser(r.Context(), database.SuspendUserParams{
+        ID: userID,
+        SuspensionReason: params.Reason,
+    }); err != nil {
+        slog.ErrorContext(r.Context(), "Error suspending user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if err := cfg.dbQueries.RevokeUserRTokens(r.Context(), userID); err != nil {
+        slog.ErrorContext(r.Context(), "Error revoking tokens of suspended user", "err", err)
+    }
+
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: moderatorID,
+        Action: actionSuspendUser,
+        UserID: nullID(userID),
+        Note: params.Reason,
+    })
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.UserSuspended,
+        ActorID: moderatorID,
+        TargetType: "user",
+        TargetID: userID.String(),
+        Outcome: audit.Success,
+        Detail: "all sessions revoked",
+    })
+    w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unsuspend_user(w http.ResponseWriter, r *http.Request) {
+    moderatorID := adminUser(r)
+
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    if !user.SuspendedAt.Valid {
+        respondError(w, r, 409, codeConflict, "User is not suspended")
+        return
+    }
+
+    if err := cfg.dbQueries.UnsuspendUser(r.Context(), userID); err != nil {
+        slog.ErrorContext(r.Context(), "Error unsuspending user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: moderatorID,
+        Action: actionUnsuspendUser,
+        UserID: nullID(userID),
+    })
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.UserUnsuspended,
+        ActorID: moderatorID,
+        TargetType: "user",
+        TargetID: userID.String(),
+        Outcome: audit.Success,
+    })
+    w.WriteHeader(204)
+}
+
+// the audit trail, last action first, optional query "limit"
+func (cfg *apiConfig) get_moderation_actions(w http.ResponseWriter, r *http.Request) {
+    limit, ok := queryLimit(r)
+    if !ok {
+        respondStatus(w, r, 400)
+        return
+    }
+
+    actions, err := cfg.dbQueries.GetModerationActions(r.Context(), limit)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting moderation actions", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    type actionRes struct {
+        ID          uuid.UUID  `json:"id"`
+        CreatedAt   time.Time  `json:"created_at"`
+        ModeratorID uuid.UUID  `json:"moderator_id"`
+        Action      string     `json:"action"`
+        ReportID    *uuid.UUID `json:"report_id,omitempty"`
+        ChirpID     *uuid.UUID `json:"chirp_id,omitempty"`
+        UserID      *uuid.UUID `json:"user_id,omitempty"`
+        Note        string     `json:"note,omitempty"`
+    }
+
+    res := []actionRes{}
+    for _, a := range actions {
+        item := actionRes{
+            ID: a.ID,
+            CreatedAt: a.CreatedAt,
+            ModeratorID: a.ModeratorID,
+            Action: a.Action,
+            Note: a.Note,
+        }
+        if a.ReportID.Valid {
+            item.ReportID = &a.ReportID.UUID
+        }
+        if a.ChirpID.Valid {
+            item.ChirpID = &a.ChirpID.UUID
+        }
+        if a.UserID.Valid {
+            item.UserID = &a.UserID.UUID
+        }
+        res = append(res, item)
+    }
+    respondJSON(w, r, 200, res)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// a report of chirpID as the db has it, in status
+func testReport(chirpID uuid.UUID, status string, claimedBy uuid.UUID) database.Report {
+    report := database.Report{ID: uuid.New(), CreatedAt: time.Now().UTC(), ReporterID: nullID(uuid.New()), ChirpID: chirpID,
+        Reason: "spam", Status: status}
+    if claimedBy != uuid.Nil {
+        report.ClaimedBy = nullID(claimedBy)
+        report.ClaimedAt = sql.NullTime{Time: report.CreatedAt, Valid: true}
+    }
+    return report
+}
+
+func TestReportChirp(t *testing.T) {
+    tests := []struct {
+        name     string
+        body     string
+        ofRepost bool
+        own      bool
+        again    bool
+        status   int
+    }{
+        {name: "spam", body: `{"reason": "spam"}`, status: 201},
+        {name: "rechirp", body: `{"reason": "spam"}`, ofRepost: true, status: 201},
+        {name: "other with a comment", body: `{"reason": "other", "comment": "weird"}`, status: 201},
+        {name: "other without a comment", body: `{"reason": "other"}`, status: 422},
+        {name: "unknown reason", body: `{"reason": "boring"}`, status: 422},
+        {name: "own chirp", body: `{"reason": "spam"}`, own: true, status: 400},
+        {name: "already reported", body: `{"reason": "spam"}`, again: true, status: 409},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            reporter := testUser(fake, "user")
+            if tt.own {
+                reporter = author
+            }
+            now := time.Now().UTC()
+            original := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "buy now", UserID: author.ID}
+            repost := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: uuid.New(),
+                RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+            answerChirps(fake, original, repost)
+            fake.answer("IsBlocked", false)
+            fake.on("CreateReport", func(args []any) (any, error) {
+                if tt.again {
+                    return nil, &pq.Error{Code: "23505"}
+                }
+                report := testReport(args[1].(uuid.UUID), "open", uuid.Nil)
+                report.ReporterID = args[0].(uuid.NullUUID)
+                return report, nil
+            })
+            target := original.ID
+            if tt.ofRepost {
+                target = repost.ID
+            }
+
+            rec := serve(t, "POST /api/chirps/{chirpID}/report", http.HandlerFunc(cfg.report_chirp), "/api/chirps/"+target.String()+"/report", testToken(t, reporter.ID, time.Hour), tt.body)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            created := fake.called("CreateReport")
+            if tt.status != 201 {
+                if (len(created) != 0) != tt.again {
+                    t.Errorf("Reported: %v", created)
+                }
+                return
+            }
+            if len(created) != 1 || created[0].args[0] != nullID(reporter.ID) || created[0].args[1] != original.ID {
+                t.Errorf("Got reports %v", created)
+            }
+            res := reportRes{}
+            json.Unmarshal(rec.Body.Bytes(), &res)
+            if res.Status != "open" || res.ChirpID != original.ID {
+                t.Errorf("Got %+v", res)
+            }
+        })
+    }
+}
+
+func TestClaimReport(t *testing.T) {
+    tests := []struct {
+        name    string
+        // the report before the claim, none when it doesn't exist
+        status  string
+        byOther bool
+        code    int
+    }{
+        {name: "open", status: "open", code: 200},
+        {name: "claimed by the moderator", status: "claimed", code: 200},
+        {name: "claimed by another moderator", status: "claimed", byOther: true, code: 409},
+        {name: "resolved", status: "resolved", code: 409},
+        {name: "not found", code: 404},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            moderator := testUser(fake, auth.RoleModerator)
+            other := testUser(fake, auth.RoleModerator)
+            claimedBy := uuid.Nil
+            if tt.status != "open" {
+                claimedBy = moderator.ID
+                if tt.byOther {
+                    claimedBy = other.ID
+                }
+            }
+            report := testReport(uuid.New(), tt.status, claimedBy)
+            if tt.status != "" {
+                fake.answer("GetReportByID", report)
+            }
+            // as the query does it, an open report or one claimed by the same moderator
+            fake.on("ClaimReport", func(args []any) (any, error) {
+                if tt.status == "open" || (tt.status == "claimed" && claimedBy == args[1].(uuid.NullUUID).UUID) {
+                    claimed := report
+                    claimed.Status = "claimed"
+                    claimed.ClaimedBy = args[1].(uuid.NullUUID)
+                    return claimed, nil
+                }
+                return nil, nil
+            })
+
+            rec := serve(t, "POST /admin/reports/{reportID}/claim", cfg.requireRole(auth.RoleModerator, cfg.claim_report), "/admin/reports/"+report.ID.String()+"/claim", testToken(t, moderator.ID, time.Hour), "")
+            if rec.Code != tt.code {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+            }
+            actions := fake.called("CreateModerationAction")
+            if tt.code != 200 {
+                if len(actions) != 0 {
+                    t.Errorf("Got actions %v", actions)
+                }
+                return
+            }
+            res := reportRes{}
+            json.Unmarshal(rec.Body.Bytes(), &res)
+            if res.Status != "claimed" || res.ClaimedBy == nil || *res.ClaimedBy != moderator.ID {
+                t.Errorf("Got %+v", res)
+            }
+            if len(actions) != 1 || actions[0].args[0] != moderator.ID || actions[0].args[1] != actionClaimReport || actions[0].args[2] != nullID(report.ID) {
+                t.Errorf("Got actions %v", actions)
+            }
+        })
+    }
+}
+
+func TestResolveReport(t *testing.T) {
+    tests := []struct {
+        name    string
+        body    string
+        status  string
+        byOther bool
+        code    int
+    }{
+        {name: "claimed", body: `{"resolution": "not spam"}`, status: "claimed", code: 200},
+        {name: "no resolution", body: `{}`, status: "claimed", code: 422},
+        {name: "not claimed", body: `{"resolution": "not spam"}`, status: "open", code: 409},
+        {name: "claimed by another moderator", body: `{"resolution": "not spam"}`, status: "claimed", byOther: true, code: 409},
+        {name: "already resolved", body: `{"resolution": "not spam"}`, status: "resolved", code: 409},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            moderator := testUser(fake, auth.RoleModerator)
+            other := testUser(fake, auth.RoleModerator)
+            claimedBy := uuid.Nil
+            if tt.status != "open" {
+                claimedBy = moderator.ID
+                if tt.byOther {
+                    claimedBy = other.ID
+                }
+            }
+            report := testReport(uuid.New(), tt.status, claimedBy)
+            fake.answer("GetReportByID", report)
+            // only reports claimed by the same moderator
+            fake.on("ResolveReport", func(args []any) (any, error) {
+                if tt.status != "claimed" || claimedBy != args[1].(uuid.NullUUID).UUID {
+                    return nil, nil
+                }
+                resolved := report
+                resolved.Status = "resolved"
+                resolved.ResolvedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+                resolved.Resolution = args[2].(string)
+                return resolved, nil
+            })
+
+            rec := serve(t, "POST /admin/reports/{reportID}/resolve", cfg.requireRole(auth.RoleModerator, cfg.resolve_report), "/admin/reports/"+report.ID.String()+"/resolve", testToken(t, moderator.ID, time.Hour), tt.body)
+            if rec.Code != tt.code {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+            }
+            actions := fake.called("CreateModerationAction")
+            if tt.code != 200 {
+                if len(actions) != 0 {
+                    t.Errorf("Got actions %v", actions)
+                }
+                return
+            }
+            res := reportRes{}
+            json.Unmarshal(rec.Body.Bytes(), &res)
+            if res.Status != "resolved" || res.Resolution != "not spam" {
+                t.Errorf("Got %+v", res)
+            }
+            if len(actions) != 1 || actions[0].args[1] != actionResolveReport || actions[0].args[5] != "not spam" {
+                t.Errorf("Got actions %v", actions)
+            }
+        })
+    }
+}
+
+func TestHideChirp(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    moderator := testUser(fake, auth.RoleModerator)
+    author := testUser(fake, "user")
+    now := time.Now().UTC()
+    chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "buy now", UserID: author.ID,
+        DeletedAt: sql.NullTime{Time: now, Valid: true}, HiddenAt: sql.NullTime{Time: now, Valid: true}}
+    fake.answer("HideChirp", chirp)
+    sub := events.NewSubscriber(4)
+    cfg.events.Subscribe(events.GlobalChannel, sub)
+    token := testToken(t, moderator.ID, time.Hour)
+
+    rec := serve(t, "POST /admin/chirps/{chirpID}/hide", cfg.requireRole(auth.RoleModerator, cfg.hide_chirp), "/admin/chirps/"+chirp.ID.String()+"/hide", token, `{"note": "spam"}`)
+    if rec.Code != 204 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    // every pending report of the chirp is closed
+    if resolved := fake.called("ResolveReportsForChirp"); len(resolved) != 1 || resolved[0].args[0] != chirp.ID {
+        t.Errorf("Got resolves %v", resolved)
+    }
+    if actions := fake.called("CreateModerationAction"); len(actions) != 1 || actions[0].args[1] != actionHideChirp ||
+        actions[0].args[4] != nullID(author.ID) || actions[0].args[5] != "spam" {
+        t.Errorf("Got actions %v", actions)
+    }
+    if got := fake.audited(audit.ChirpDeleted); len(got) != 1 || got[0] != audit.Success {
+        t.Errorf("Got audit %v", got)
+    }
+    select {
+    case ev := <-sub.C:
+        if ev.Type != events.ChirpDeleted {
+            t.Errorf("Got event %v", ev.Type)
+        }
+    default:
+        t.Errorf("No event")
+    }
+
+    // already hidden
+    fake.answer("HideChirp", nil)
+    rec = serve(t, "POST /admin/chirps/{chirpID}/hide", cfg.requireRole(auth.RoleModerator, cfg.hide_chirp), "/admin/chirps/"+chirp.ID.String()+"/hide", token, "")
+    if rec.Code != 404 {
+        t.Errorf("Hiding a hidden chirp got status %d", rec.Code)
+    }
+}
+
+func TestSuspendUser(t *testing.T) {
+    tests := []struct {
+        name   string
+        body   string
+        self   bool
+        role   string
+        status int
+    }{
+        {name: "user", body: `{"reason": "spam"}`, role: auth.RoleUser, status: 204},
+        {name: "no reason", body: `{}`, role: auth.RoleUser, status: 422},
+        {name: "yourself", body: `{"reason": "spam"}`, self: true, status: 400},
+        // so a moderator can't lock out the admins
+        {name: "admin", body: `{"reason": "spam"}`, role: auth.RoleAdmin, status: 403},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            moderator := testUser(fake, auth.RoleModerator)
+            target := moderator
+            if !tt.self {
+                target = testUser(fake, tt.role)
+            }
+            fake.on("SuspendUser", func(args []any) (any, error) {
+                target.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+                target.SuspensionReason = args[1].(string)
+                fake.addUser(target)
+                return nil, nil
+            })
+            token := testToken(t, target.ID, time.Hour)
+
+            rec := serve(t, "POST /admin/users/{userID}/suspend", cfg.requireRole(auth.RoleModerator, cfg.suspend_user), "/admin/users/"+target.ID.String()+"/suspend", testToken(t, moderator.ID, time.Hour), tt.body)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            suspended := fake.called("SuspendUser")
+            if tt.status != 204 {
+                if len(suspended) != 0 {
+                    t.Errorf("Suspended: %v", suspended)
+                }
+                return
+            }
+            if revoked := fake.called("RevokeUserRTokens"); len(revoked) != 1 || revoked[0].args[0] != target.ID {
+                t.Errorf("Got revocations %v", revoked)
+            }
+            if actions := fake.called("CreateModerationAction"); len(actions) != 1 || actions[0].args[1] != actionSuspendUser {
+                t.Errorf("Got actions %v", actions)
+            }
+            if got := fake.audited(audit.UserSuspended); len(got) != 1 || got[0] != audit.Success {
+                t.Errorf("Got audit %v", got)
+            }
+            // the access token left stops working too
+            rec = serve(t, "GET /api/users/me/export", http.HandlerFunc(cfg.export_user_me), "/api/users/me/export", token, "")
+            if rec.Code != 403 || errorCode(t, rec) != codeAccountSuspended {
+                t.Errorf("The suspended user got status %d", rec.Code)
+            }
+        })
+    }
+}
+
+func TestUnsuspendUser(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    moderator := testUser(fake, auth.RoleModerator)
+    user := testUser(fake, "user")
+    token := testToken(t, moderator.ID, time.Hour)
+
+    rec := serve(t, "DELETE /admin/users/{userID}/suspend", cfg.requireRole(auth.RoleModerator, cfg.unsuspend_user), "/admin/users/"+user.ID.String()+"/suspend", token, "")
+    if rec.Code != 409 {
+        t.Errorf("Unsuspending a user not suspended got status %d", rec.Code)
+    }
+
+    user.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+    fake.addUser(user)
+    rec = serve(t, "DELETE /admin/users/{userID}/suspend", cfg.requireRole(auth.RoleModerator, cfg.unsuspend_user), "/admin/users/"+user.ID.String()+"/suspend", token, "")
+    if rec.Code != 204 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    if calls := fake.called("UnsuspendUser"); len(calls) != 1 || calls[0].args[0] != user.ID {
+        t.Errorf("Got %v", calls)
+    }
+    if got := fake.audited(audit.UserUnsuspended); len(got) != 1 || got[0] != audit.Success {
+        t.Errorf("Got audit %v", got)
+    }
+}
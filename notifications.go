@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+)
+
+// notification types
+const (
+    notificationReply   = "reply"
+    notificationLike    = "like"
+    notificationMention = "mention"
+    notificationRepost  = "repost"
+    notificationQuote   = "quote"
+    notificationUpgrade = "chirpy_red"
+)
+
+// every type a user can turn on or off, all enabled by default
+var notificationTypes = []string{
+    notificationReply,
+    notificationLike,
+    notificationMention,
+    notificationRepost,
+    notificationQuote,
+    notificationUpgrade,
+}
+
+func isNotificationType(t string) bool {
+    for _, nt := range notificationTypes {
+        if nt == t {
+            return true
+        }
+    }
+    return false
+}
+
+type notificationRes struct {
+    Id        string  `json:"id"`
+    CreatedAt string  `json:"created_at"`
+    Type      string  `json:"type"`
+    ActorID   *string `json:"actor_id"`
+    ChirpID   *string `json:"chirp_id"`
+    Read      bool    `json:"read"`
+}
+
+func toNotificationRes(n database.Notification) notificationRes {
+    res := notificationRes{
+        Id: n.ID.String(),
+        CreatedAt: n.CreatedAt.String(),
+        Type: n.Type,
+        Read: n.ReadAt.Valid,
+    }
+    if n.ActorID.Valid {
+        actor := n.ActorID.UUID.String()
+        res.ActorID = &actor
+    }
+    if n.ChirpID.Valid {
+        chirp := n.ChirpID.UUID.String()
+        res.ChirpID = &chirp
+    }
+    return res
+}
+
+// store a notification for userID unless the user turned that type off
+// actorID and chirpID may be uuid.Nil, errors are only logged
+// since notifications never fail the action that caused them
+func (cfg *apiConfig) notify(ctx context.Context, userID uuid.UUID, notificationType string, actorID, chirpID uuid.UUID) {
+    // no need to notify users about their own actions
+    if actorID == userID {
+        return
+    }
+
+    // nothing from muted users or across a block, the actor isn't told
+    if actorID != uuid.Nil {
+        hidden, err := cfg.dbQueries.IsHidden(ctx, database.IsHiddenParams{
+            ViewerID: userID,
+            UserID: actorID,
+        })
+        if err != nil {
+            slog.ErrorContext(ctx, "Error checking if actor is hidden from user", "actor_id", actorID, "user_id", userID, "err", err)
+            return
+        }
+        if hidden {
+            return
+        }
+    }
+
+    enabled, err := cfg.dbQueries.GetNotificationPreference(ctx, database.GetNotificationPreferenceParams{
+        UserID: userID,
+        Type: notificationType,
+    })
+    if err != nil && err != sql.ErrNoRows {
+        slog.ErrorContext(ctx, "Error getting notification preference", "err", err)
+        return
+    }
+    if err == nil && !enabled {
+        return
+    }
+
+    n, err := cfg.dbQueries.CreateNotification(ctx, database.CreateNotificationParams{
+        UserID: userID,
+        ActorID: uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+        Type: notificationType,
+        ChirpID: uuid.NullUUID{UUID: chirpID, Valid: chirpID != uuid.Nil},
+    })
+    if err != nil {
+        slog.ErrorContext(ctx, "Error creating notification", "type", notificationType, "user_id", userID, "err", err)
+        return
+    }
+
+    cfg.events.Publish(events.NotificationsChannel(userID), events.NotificationCreated, toNotificationRes(n))
+}
+
+// list the user's notifications, newest first
+// optional queries "unread=true" and "limit" (max 100)
+func (cfg *apiConfig) get_notifications(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    limit := 20
+    if l := r.URL.Query().Get("limit"); l != "" {
+        limit, err = strconv.Atoi(l)
+        if err != nil || limit < 1 || limit > 100 {
+            respondStatus(w, r, 400)
+            return
+        }
+    }
+
+    var notifications []database.Notification
+    if r.URL.Query().Get("unread") == "true" {
+        notifications, err = cfg.dbQueries.GetUnreadNotifications(r.Context(), database.GetUnreadNotificationsParams{
+            UserID: userID,
+            Limit: int32(limit),
+        })
+    } else {
+        notifications, err = cfg.dbQueries.GetNotifications(r.Context(), database.GetNotificationsParams{
+            UserID: userID,
+            Limit: int32(limit),
+        })
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting notifications", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    unread, err := cfg.dbQueries.CountUnreadNotifications(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error counting unread notifications", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    type notificationsRes struct {
+        UnreadCount   int64             `json:"unread_count"`
+        Notifications []notificationRes `json:"notifications"`
+    }
+
+    res := notificationsRes{
+        UnreadCount: unread,
+        Notifications: []notificationRes{},
+    }
+    for _, n := range notifications {
+        res.Notifications = append(res.Notifications, toNotificationRes(n))
+    }
+
+    respondJSON(w, r, 200, res)
+}
+
+// mark notifications as read
+// body {"ids": [...]} or {"all": true}
+func (cfg *apiConfig) read_notifications(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    type parameters struct {
+        Ids []string `json:"ids"`
+        All bool     `json:"all"`
+    }
+
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+
+    ids := make([]uuid.UUID, 0, len(params.Ids))
+    v := validate.Validator{}
+    for i, id := range params.Ids {
+        ids = append(ids, v.UUID(fmt.Sprintf("ids[%d]", i), id))
+    }
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    if params.All {
+        err = cfg.dbQueries.MarkAllNotificationsRead(r.Context(), userID)
+    } else {
+        err = cfg.dbQueries.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+            UserID: userID,
+            Ids: ids,
+        })
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error marking notifications as read", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    unread, err := cfg.dbQueries.CountUnreadNotifications(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error counting unread notifications", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    type readRes struct {
+        UnreadCount int64 `json:"unread_count"`
+    }
+    respondJSON(w, r, 200, readRes{UnreadCount: unread})
+}
+
+// preferences as {"<type>": enabled}, with every known type present
+func (cfg *apiConfig) notificationPreferences(ctx context.Context, userID uuid.UUID) (map[string]bool, error) {
+    prefs := map[string]bool{}
+    for _, t := range notificationTypes {
+        prefs[t] = true
+    }
+
+    stored, err := cfg.dbQueries.GetNotificationPreferences(ctx, userID)
+    if err != nil {
+        return nil, err
+    }
+    for _, p := range stored {
+        // rows of types that are gone are left out
+        if isNotificationType(p.Type) {
+            prefs[p.Type] = p.Enabled
+        }
+    }
+    return prefs, nil
+}
+
+func (cfg *apiConfig) get_notification_preferences(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    prefs, err := cfg.notificationPreferences(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting notification preferences", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    respondJSON(w, r, 200, prefs)
+}
+
+// partial update, body {"<type>": enabled, ...}
+func (cfg *apiConfig) update_notification_preferences(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    params := map[string]bool{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+
+    v := validate.Validator{}
+    for _, t := range slices.Sorted(maps.Keys(params)) {
+        v.Check(isNotificationType(t), t, validate.CodeUnknownField, "Unknown notification type")
+    }
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    for t, enabled := range params {
+        err := cfg.dbQueries.UpsertNotificationPreference(r.Context(), database.UpsertNotificationPreferenceParams{
+            UserID: userID,
+            Type: t,
+            Enabled: enabled,
+        })
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error updating notification preference", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+    }
+
+    prefs, err := cfg.notificationPreferences(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting notification preferences", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    respondJSON(w, r, 200, prefs)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+func TestNotify(t *testing.T) {
+    tests := []struct {
+        name    string
+        self    bool
+        hidden  bool
+        // nil when the user never set the preference
+        enabled any
+        created bool
+    }{
+        {name: "default preference", created: true},
+        {name: "enabled", enabled: true, created: true},
+        {name: "disabled", enabled: false},
+        {name: "own action", self: true},
+        {name: "muted or blocked actor", hidden: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, "user")
+            actor := testUser(fake, "user")
+            if tt.self {
+                actor = user
+            }
+            chirpID := uuid.New()
+            fake.answer("IsHidden", tt.hidden)
+            fake.answer("GetNotificationPreference", tt.enabled)
+            fake.on("CreateNotification", func(args []any) (any, error) {
+                return database.Notification{
+                    ID: uuid.New(),
+                    CreatedAt: time.Now(),
+                    UserID: args[0].(uuid.UUID),
+                    ActorID: args[1].(uuid.NullUUID),
+                    Type: args[2].(string),
+                    ChirpID: args[3].(uuid.NullUUID),
+                }, nil
+            })
+            sub := events.NewSubscriber(1)
+            cfg.events.Subscribe(events.NotificationsChannel(user.ID), sub)
+
+            cfg.notify(context.Background(), user.ID, notificationRepost, actor.ID, chirpID)
+
+            created := fake.called("CreateNotification")
+            if !tt.created {
+                if len(created) != 0 || len(sub.C) != 0 {
+                    t.Errorf("Notified: %v", created)
+                }
+                return
+            }
+            if len(created) != 1 || created[0].args[0] != user.ID || created[0].args[2] != notificationRepost {
+                t.Fatalf("Got notifications %v", created)
+            }
+            select {
+            case ev := <-sub.C:
+                n := ev.Data.(notificationRes)
+                if ev.Type != events.NotificationCreated || *n.ActorID != actor.ID.String() || *n.ChirpID != chirpID.String() {
+                    t.Errorf("Got event %+v", ev)
+                }
+            default:
+                t.Errorf("No notification event")
+            }
+        })
+    }
+}
+
+func TestGetNotifications(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    token := testToken(t, user.ID, time.Hour)
+    unread := database.Notification{ID: uuid.New(), CreatedAt: time.Now(), UserID: user.ID, Type: notificationMention}
+    fake.answer("GetUnreadNotifications", []database.Notification{unread})
+    fake.answer("CountUnreadNotifications", int64(1))
+
+    rec := serve(t, "GET /api/notifications", http.HandlerFunc(cfg.get_notifications), "/api/notifications?unread=true&limit=5", token, "")
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    var res struct {
+        UnreadCount   int64             `json:"unread_count"`
+        Notifications []notificationRes `json:"notifications"`
+    }
+    json.Unmarshal(rec.Body.Bytes(), &res)
+    if res.UnreadCount != 1 || len(res.Notifications) != 1 || res.Notifications[0].Id != unread.ID.String() {
+        t.Errorf("Got %+v", res)
+    }
+    calls := fake.called("GetUnreadNotifications")
+    if len(calls) != 1 || calls[0].args[0] != user.ID || calls[0].args[1] != int32(5) {
+        t.Errorf("Got queries %v", calls)
+    }
+    if len(fake.called("GetNotifications")) != 0 {
+        t.Errorf("Read notifications were listed")
+    }
+
+    for _, target := range []string{"/api/notifications?limit=0", "/api/notifications?limit=101", "/api/notifications?limit=x"} {
+        if rec := serve(t, "GET /api/notifications", http.HandlerFunc(cfg.get_notifications), target, token, ""); rec.Code != 400 {
+            t.Errorf("%s got status %d", target, rec.Code)
+        }
+    }
+    if rec := serve(t, "GET /api/notifications", http.HandlerFunc(cfg.get_notifications), "/api/notifications", "", ""); rec.Code != 401 {
+        t.Errorf("Without a token got status %d", rec.Code)
+    }
+}
+
+func TestReadNotifications(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    token := testToken(t, user.ID, time.Hour)
+    id := uuid.New()
+    fake.answer("CountUnreadNotifications", int64(0))
+
+    rec := serve(t, "POST /api/notifications/read", http.HandlerFunc(cfg.read_notifications), "/api/notifications/read", token, `{"ids": ["`+id.String()+`"]}`)
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    calls := fake.called("MarkNotificationsRead")
+    if len(calls) != 1 || calls[0].args[0] != user.ID {
+        t.Errorf("Got queries %v", calls)
+    }
+
+    rec = serve(t, "POST /api/notifications/read", http.HandlerFunc(cfg.read_notifications), "/api/notifications/read", token, `{"all": true}`)
+    if rec.Code != 200 || len(fake.called("MarkAllNotificationsRead")) != 1 {
+        t.Errorf("Marking all got status %d", rec.Code)
+    }
+
+    rec = serve(t, "POST /api/notifications/read", http.HandlerFunc(cfg.read_notifications), "/api/notifications/read", token, `{"ids": ["nope"]}`)
+    if rec.Code != 422 {
+        t.Errorf("A bad id got status %d", rec.Code)
+    }
+}
+
+func TestUpdateNotificationPreferences(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    token := testToken(t, user.ID, time.Hour)
+    fake.answer("GetNotificationPreferences", []database.NotificationPreference{
+        {UserID: user.ID, Type: notificationQuote, Enabled: false},
+    })
+
+    rec := serve(t, "PUT /api/notifications/preferences", http.HandlerFunc(cfg.update_notification_preferences), "/api/notifications/preferences", token, `{"likes": false}`)
+    if rec.Code != 422 || len(fake.called("UpsertNotificationPreference")) != 0 {
+        t.Errorf("An unknown type got status %d", rec.Code)
+    }
+
+    rec = serve(t, "PUT /api/notifications/preferences", http.HandlerFunc(cfg.update_notification_preferences), "/api/notifications/preferences", token, `{"quote": false}`)
+    if rec.Code != 200 {
+        t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+    }
+    prefs := map[string]bool{}
+    json.Unmarshal(rec.Body.Bytes(), &prefs)
+    if len(prefs) != len(notificationTypes) || prefs[notificationQuote] || !prefs[notificationMention] {
+        t.Errorf("Got preferences %v", prefs)
+    }
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// profile limits
+const (
+    maxDisplayNameLen = 50
+    maxBioLen         = 160
+    maxAvatarURLLen   = 2048
+)
+
+// handles are stored lowercase
+var handleRegex = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// @handle inside a chirp body
+var mentionRegex = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@])@([a-zA-Z0-9_]{3,30})\b`)
+
+// profile fields as sent by the client, nil means "don't change"
+type profileParams struct {
+    Handle      *string `json:"handle"`
+    DisplayName *string `json:"display_name"`
+    Bio         *string `json:"bio"`
+    AvatarURL   *string `json:"avatar_url"`
+}
+
+func (p profileParams) isEmpty() bool {
+    return p.Handle == nil && p.DisplayName == nil && p.Bio == nil && p.AvatarURL == nil
+}
+
+func normalizeHandle(handle string) string {
+    return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+}
+
+func validateHandle(handle string) error {
+    if !handleRegex.MatchString(handle) {
+        return fmt.Errorf("Handle must be 3 to 30 letters, numbers or underscores")
+    }
+    return nil
+}
+
+func validateAvatarURL(avatar string) error {
+    if avatar == "" {
+        return nil
+    }
+    if len(avatar) > maxAvatarURLLen {
+        return fmt.Errorf("Avatar url is too long")
+    }
+    u, err := url.Parse(avatar)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return fmt.Errorf("Avatar url must be an http or https url")
+    }
+    return nil
+}
+
+// check the sent fields, an empty handle or avatar clears it
+func (p profileParams) check(v *validate.Validator) {
+    if p.Handle != nil {
+        if handle := normalizeHandle(*p.Handle); handle != "" {
+            if err := validateHandle(handle); err != nil {
+                v.Add("handle", validate.CodeInvalid, err.Error())
+            }
+        }
+    }
+    if p.DisplayName != nil {
+        v.MaxLen("display_name", strings.TrimSpace(*p.DisplayName), maxDisplayNameLen)
+    }
+    if p.Bio != nil {
+        v.MaxLen("bio", strings.TrimSpace(*p.Bio), maxBioLen)
+    }
+    if p.AvatarURL != nil {
+        if err := validateAvatarURL(strings.TrimSpace(*p.AvatarURL)); err != nil {
+            v.Add("avatar_url", validate.CodeInvalid, err.Error())
+        }
+    }
+}
+
+// apply the sent fields over the current profile, p has been checked
+func mergeProfile(user database.User, p profileParams) database.UpdateUserProfileParams {
+    merged := database.UpdateUserProfileParams{
+        ID: user.ID,
+        Handle: user.Handle,
+        DisplayName: user.DisplayName,
+        Bio: user.Bio,
+        AvatarUrl: user.AvatarUrl,
+    }
+
+    if p.Handle != nil {
+        handle := normalizeHandle(*p.Handle)
+        merged.Handle = sql.NullString{String: handle, Valid: handle != ""}
+    }
+    if p.DisplayName != nil {
+        merged.DisplayName = strings.TrimSpace(*p.DisplayName)
+    }
+    if p.Bio != nil {
+        merged.Bio = strings.TrimSpace(*p.Bio)
+    }
+    if p.AvatarURL != nil {
+        merged.AvatarUrl = strings.TrimSpace(*p.AvatarURL)
+    }
+
+    return merged
+}
+
+// duplicated value on a unique column
+func isUniqueViolation(err error) bool {
+    pqErr, ok := err.(*pq.Error)
+    return ok && pqErr.Code == "23505"
+}
+
+// public name of a user, display name, handle or id
+func userDisplayName(user database.User) string {
+    if user.DisplayName != "" {
+        return user.DisplayName
+    }
+    if user.Handle.Valid {
+        return "@" + user.Handle.String
+    }
+    return user.ID.String()
+}
+
+// username used for federation, the handle if the user has one
+func userUsername(user database.User) string {
+    if user.Handle.Valid {
+        return user.Handle.String
+    }
+    return user.ID.String()
+}
+
+// find a user by id or by handle
+func (cfg *apiConfig) lookupUser(ctx context.Context, handleOrID string) (database.User, error) {
+    if id, err := uuid.Parse(handleOrID); err == nil {
+        return cfg.dbQueries.GetUserByID(ctx, id)
+    }
+    handle := normalizeHandle(handleOrID)
+    return cfg.dbQueries.GetUserByHandle(ctx, sql.NullString{String: handle, Valid: handle != ""})
+}
+
+// notify every user mentioned with @handle in a chirp
+func (cfg *apiConfig) notifyMentions(ctx context.Context, chirp database.Chirp) {
+    notified := map[string]bool{}
+    for _, m := range mentionRegex.FindAllStringSubmatch(chirp.Body, -1) {
+        handle := strings.ToLower(m[1])
+        if notified[handle] {
+            continue
+        }
+        notified[handle] = true
+
+        user, err := cfg.dbQueries.GetUserByHandle(ctx, sql.NullString{String: handle, Valid: true})
+        if err != nil {
+            continue
+        }
+        cfg.notify(ctx, user.ID, notificationMention, chirp.UserID, chirp.ID)
+    }
+}
+
+type profileRes struct {
+    Id            string  `json:"id"`
+    Handle        *string `json:"handle"`
+    DisplayName   string  `json:"display_name"`
+    Bio           string  `json:"bio"`
+    AvatarURL     string  `json:"avatar_url"`
+    CreatedAt     string  `json:"created_at"`
+    IsChirpyRed   bool    `json:"is_chirpy_red"`
+    ChirpCount    int64   `json:"chirp_count"`
+    // there are no local follows, only ActivityPub followers
+    RemoteFollowerCount int64 `json:"remote_follower_count"`
+}
+
+// public profile, by user id or handle
+// never includes the email
+// blocked either way looks the same as a missing user
+func (cfg *apiConfig) get_user_profile(w http.ResponseWriter, r *http.Request) {
+    viewerID, err := cfg.optionalUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error validating token from user", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    user, err := cfg.lookupUser(r.Context(), r.PathValue("handleOrID"))
+    if err != nil {
+        slog.InfoContext(r.Context(), "User profile not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    if viewerID != uuid.Nil {
+        blocked, err := cfg.dbQueries.IsBlocked(r.Context(), database.IsBlockedParams{
+            ViewerID: viewerID,
+            UserID: user.ID,
+        })
+        if err != nil {
+            slog.ErrorContext(r.Context(), "Error checking blocks", "err", err)
+            respondStatus(w, r, 500)
+            return
+        }
+        if blocked {
+            slog.InfoContext(r.Context(), "User profile hidden by a block", "user_id", user.ID)
+            respondStatus(w, r, 404)
+            return
+        }
+    }
+
+    chirpCount, err := cfg.dbQueries.CountChirpsFromUser(r.Context(), user.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error counting chirps from user", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    remoteFollowers, err := cfg.dbQueries.CountRemoteFollowers(r.Context(), user.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error counting followers", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    res := profileRes{
+        Id: user.ID.String(),
+        DisplayName: user.DisplayName,
+        Bio: user.Bio,
+        AvatarURL: user.AvatarUrl,
+        CreatedAt: user.CreatedAt.String(),
+        IsChirpyRed: user.IsChirpyRed,
+        ChirpCount: chirpCount,
+        RemoteFollowerCount: remoteFollowers,
+    }
+    if user.Handle.Valid {
+        res.Handle = &user.Handle.String
+    }
+
+    respondJSON(w, r, 200, res)
+}
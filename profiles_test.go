@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestGetUserProfile(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    user.Handle = sql.NullString{String: "alice", Valid: true}
+    user.DisplayName = "Alice"
+    fake.addUser(user)
+    fake.on("GetUserByHandle", func(args []any) (any, error) {
+        if args[0].(sql.NullString).String == "alice" {
+            return user, nil
+        }
+        return nil, nil
+    })
+    fake.answer("CountChirpsFromUser", int64(3))
+    fake.answer("CountRemoteFollowers", int64(2))
+
+    for _, handleOrID := range []string{user.ID.String(), "alice", "@Alice"} {
+        rec := serve(t, "GET /api/users/{handleOrID}", http.HandlerFunc(cfg.get_user_profile), "/api/users/"+handleOrID, "", "")
+        if rec.Code != 200 {
+            t.Fatalf("%s got status %d", handleOrID, rec.Code)
+        }
+        if strings.Contains(rec.Body.String(), user.Email) {
+            t.Errorf("The profile has the email: %s", rec.Body)
+        }
+        res := profileRes{}
+        json.Unmarshal(rec.Body.Bytes(), &res)
+        if res.Id != user.ID.String() || res.Handle == nil || *res.Handle != "alice" || res.DisplayName != "Alice" ||
+            res.ChirpCount != 3 || res.RemoteFollowerCount != 2 {
+            t.Errorf("%s got %+v", handleOrID, res)
+        }
+    }
+
+    for _, handleOrID := range []string{"bob", uuid.NewString()} {
+        if rec := serve(t, "GET /api/users/{handleOrID}", http.HandlerFunc(cfg.get_user_profile), "/api/users/"+handleOrID, "", ""); rec.Code != 404 {
+            t.Errorf("%s got status %d", handleOrID, rec.Code)
+        }
+    }
+}
+
+func TestGetUserProfileBlocked(t *testing.T) {
+    tests := []struct {
+        name      string
+        anonymous bool
+        blocked   bool
+        status    int
+    }{
+        {name: "not blocked", status: 200},
+        {name: "blocked", blocked: true, status: 404},
+        {name: "anonymous", anonymous: true, blocked: true, status: 200},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            viewer := testUser(fake, "user")
+            user := testUser(fake, "user")
+            fake.answer("CountChirpsFromUser", int64(0))
+            fake.answer("CountRemoteFollowers", int64(0))
+            // a block either way, IsBlocked covers both
+            fake.on("IsBlocked", func(args []any) (any, error) {
+                return tt.blocked && args[0] == viewer.ID && args[1] == user.ID, nil
+            })
+            token := ""
+            if !tt.anonymous {
+                token = testToken(t, viewer.ID, time.Hour)
+            }
+
+            rec := serve(t, "GET /api/users/{handleOrID}", http.HandlerFunc(cfg.get_user_profile), "/api/users/"+user.ID.String(), token, "")
+            if rec.Code != tt.status {
+                t.Errorf("Got status %d, want %d", rec.Code, tt.status)
+            }
+        })
+    }
+}
+
+func TestUpdateProfile(t *testing.T) {
+    tests := []struct {
+        name    string
+        body    string
+        taken   bool
+        status  int
+        code    string
+        // the profile stored, when it's changed
+        want    *database.UpdateUserProfileParams
+    }{
+        {name: "handle", body: `{"handle": "@New_Handle"}`, status: 200,
+            want: &database.UpdateUserProfileParams{Handle: sql.NullString{String: "new_handle", Valid: true}, DisplayName: "Alice", Bio: "hi"}},
+        {name: "clear the handle", body: `{"handle": "", "bio": "  bye "}`, status: 200,
+            want: &database.UpdateUserProfileParams{DisplayName: "Alice", Bio: "bye"}},
+        {name: "invalid handle", body: `{"handle": "a!"}`, status: 422, code: codeValidation},
+        {name: "avatar not http", body: `{"avatar_url": "javascript:alert(1)"}`, status: 422, code: codeValidation},
+        {name: "bio too long", body: `{"bio": "` + strings.Repeat("a", maxBioLen+1) + `"}`, status: 422, code: codeValidation},
+        {name: "handle taken", body: `{"handle": "bob"}`, taken: true, status: 409, code: codeHandleTaken},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, "user")
+            user.Handle = sql.NullString{String: "alice", Valid: true}
+            user.DisplayName = "Alice"
+            user.Bio = "hi"
+            fake.addUser(user)
+            fake.on("UpdateUserProfile", func(args []any) (any, error) {
+                if tt.taken {
+                    return nil, &pq.Error{Code: "23505"}
+                }
+                return user, nil
+            })
+
+            rec := serve(t, "PATCH /api/users/me", http.HandlerFunc(cfg.patch_user), "/api/users/me", testToken(t, user.ID, time.Hour), tt.body)
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            if tt.code != "" {
+                if code := errorCode(t, rec); code != tt.code {
+                    t.Errorf("Got code %q, want %q", code, tt.code)
+                }
+            }
+            // profile changes don't need the password
+            if len(fake.called("UpdateUser")) != 0 {
+                t.Errorf("The credentials were updated")
+            }
+
+            updates := fake.called("UpdateUserProfile")
+            if tt.want == nil {
+                if len(updates) != 0 && !tt.taken {
+                    t.Errorf("Got profile updates %v", updates)
+                }
+                return
+            }
+            want := *tt.want
+            want.ID = user.ID
+            if len(updates) != 1 {
+                t.Fatalf("Got profile updates %v", updates)
+            }
+            got := database.UpdateUserProfileParams{
+                ID: updates[0].args[0].(uuid.UUID),
+                Handle: updates[0].args[1].(sql.NullString),
+                DisplayName: updates[0].args[2].(string),
+                Bio: updates[0].args[3].(string),
+                AvatarUrl: updates[0].args[4].(string),
+            }
+            if got != want {
+                t.Errorf("Got profile %+v, want %+v", got, want)
+            }
+        })
+    }
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+// in_reply_to from a new chirp, replying to a rechirp replies to its original
+func (cfg *apiConfig) resolveReply(ctx context.Context, userID uuid.UUID, inReplyTo string) (uuid.NullUUID, error) {
+    return cfg.resolveChirpRef(ctx, userID, inReplyTo, "Replied chirp")
+}
+
+// let the author of the chirp being replied to know
+func (cfg *apiConfig) notifyRepliedAuthor(ctx context.Context, chirp database.Chirp) {
+    if !chirp.InReplyTo.Valid {
+        return
+    }
+    replied, err := cfg.dbQueries.GetChirpByID(ctx, chirp.InReplyTo.UUID)
+    if err != nil {
+        return
+    }
+    cfg.notify(ctx, replied.UserID, notificationReply, chirp.UserID, chirp.ID)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestReplyChirp(t *testing.T) {
+    tests := []struct {
+        name     string
+        ofRepost bool
+        missing  bool
+        blocked  bool
+        // the author turned reply notifications off
+        disabled bool
+        status   int
+    }{
+        {name: "chirp", status: 201},
+        {name: "rechirp", ofRepost: true, status: 201},
+        {name: "not found", missing: true, status: 400},
+        {name: "blocked", blocked: true, status: 400},
+        {name: "notifications off", disabled: true, status: 201},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            replier := testUser(fake, "user")
+            now := time.Now().UTC()
+            original := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: author.ID}
+            repostOf := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: uuid.New(),
+                RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+            if !tt.missing {
+                answerChirps(fake, original, repostOf)
+            }
+            fake.answer("IsBlocked", tt.blocked)
+            fake.answer("IsHidden", false)
+            fake.on("GetNotificationPreference", func(args []any) (any, error) {
+                if tt.disabled && args[0] == author.ID && args[1] == notificationReply {
+                    return false, nil
+                }
+                return nil, nil
+            })
+            fake.on("CreateChirp", func(args []any) (any, error) {
+                return database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: args[0].(string), UserID: args[1].(uuid.UUID),
+                    InReplyTo: args[3].(uuid.NullUUID)}, nil
+            })
+            replied := original.ID
+            if tt.ofRepost {
+                replied = repostOf.ID
+            }
+
+            body, _ := json.Marshal(map[string]string{"body": "me too", "in_reply_to": replied.String()})
+            rec := serve(t, "POST /api/chirps", http.HandlerFunc(cfg.create_chirp), "/api/chirps", testToken(t, replier.ID, time.Hour), string(body))
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+
+            created := fake.called("CreateChirp")
+            if tt.status != 201 {
+                if len(created) != 0 {
+                    t.Errorf("Created: %v", created)
+                }
+                return
+            }
+            if len(created) != 1 || created[0].args[3] != (uuid.NullUUID{UUID: original.ID, Valid: true}) {
+                t.Fatalf("Got chirps %v", created)
+            }
+            res := chirpRes{}
+            json.Unmarshal(rec.Body.Bytes(), &res)
+            if res.InReplyTo == nil || *res.InReplyTo != original.ID {
+                t.Errorf("Got %+v", res)
+            }
+
+            notified := fake.called("CreateNotification")
+            if tt.disabled {
+                if len(notified) != 0 {
+                    t.Errorf("Got notifications %v", notified)
+                }
+                return
+            }
+            if len(notified) != 1 || notified[0].args[0] != author.ID || notified[0].args[2] != notificationReply ||
+                notified[0].args[3] != (uuid.NullUUID{UUID: res.ID, Valid: true}) {
+                t.Errorf("Got notifications %v", notified)
+            }
+        })
+    }
+}
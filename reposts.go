@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+// rechirping a rechirp rechirps its original
+// chirps of users blocked either way by userID are not found
+func (cfg *apiConfig) originalChirp(ctx context.Context, userID, chirpID uuid.UUID) (database.Chirp, error) {
+    chirp, err := cfg.dbQueries.GetChirpByID(ctx, chirpID)
+    if err != nil {
+        return chirp, err
+    }
+    if chirp.RepostOf.Valid {
+        chirp, err = cfg.dbQueries.GetChirpByID(ctx, chirp.RepostOf.UUID)
+        if err != nil {
+            return chirp, err
+        }
+    }
+
+    blocked, err := cfg.dbQueries.IsBlocked(ctx, database.IsBlockedParams{
+        ViewerID: userID,
+        UserID: chirp.UserID,
+    })
+    if err != nil {
+        return chirp, err
+    }
+    if blocked {
+        return database.Chirp{}, sql.ErrNoRows
+    }
+    return chirp, nil
+}
+
+// rechirp someone's chirp (or your own) to your timeline
+func (cfg *apiConfig) repost_chirp(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to rechirp", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    original, err := cfg.originalChirp(r.Context(), userID, chirpID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Chirp to rechirp not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    repostOf := uuid.NullUUID{UUID: original.ID, Valid: true}
+    repost, err := cfg.dbQueries.CreateRepost(r.Context(), database.CreateRepostParams{
+        UserID: userID,
+        RepostOf: repostOf,
+    })
+    // a second rechirp racing the first
+    if isUniqueViolation(err) {
+        respondError(w, r, 409, codeConflict, "Chirp already rechirped")
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error creating rechirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    cfg.chirpPublished(r.Context(), repost)
+
+    res, err := cfg.loadChirp(r.Context(), repost)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error loading rechirp", "err", err)
+    }
+    respondJSON(w, r, 201, res)
+}
+
+// remove your rechirp of a chirp
+func (cfg *apiConfig) undo_repost(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user to undo rechirp", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    repost, err := cfg.dbQueries.GetRepost(r.Context(), database.GetRepostParams{
+        UserID: userID,
+        RepostOf: uuid.NullUUID{UUID: chirpID, Valid: true},
+    })
+    if err != nil {
+        slog.WarnContext(r.Context(), "Rechirp not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    if err := cfg.dbQueries.DeleteRepost(r.Context(), repost.ID); err != nil {
+        slog.ErrorContext(r.Context(), "Error deleting rechirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    cfg.publishChirpEvent(events.ChirpDeleted, toChirpRes(repost))
+
+    w.WriteHeader(204)
+}
+
+// quote_of from a new chirp, quoting a rechirp quotes its original
+func (cfg *apiConfig) resolveQuote(ctx context.Context, userID uuid.UUID, quoteOf string) (uuid.NullUUID, error) {
+    return cfg.resolveChirpRef(ctx, userID, quoteOf, "Quoted chirp")
+}
+
+// a chirp referenced by a new chirp, name is what the errors call it
+func (cfg *apiConfig) resolveChirpRef(ctx context.Context, userID uuid.UUID, ref, name string) (uuid.NullUUID, error) {
+    if ref == "" {
+        return uuid.NullUUID{}, nil
+    }
+    chirpID, err := uuid.Parse(ref)
+    if err != nil {
+        return uuid.NullUUID{}, fmt.Errorf("Invalid %s id", strings.ToLower(name))
+    }
+    original, err := cfg.originalChirp(ctx, userID, chirpID)
+    if err == sql.ErrNoRows {
+        return uuid.NullUUID{}, fmt.Errorf("%s not found", name)
+    }
+    if err != nil {
+        slog.ErrorContext(ctx, "Error getting referenced chirp", "name", name, "err", err)
+        return uuid.NullUUID{}, fmt.Errorf("Something went wrong")
+    }
+    return uuid.NullUUID{UUID: original.ID, Valid: true}, nil
+}
+
+// embed quoted chirps, quotes of deleted chirps keep only QuoteOf
+func (cfg *apiConfig) attachQuotes(ctx context.Context, res []chirpRes) error {
+    ids := []uuid.UUID{}
+    for _, chirp := range res {
+        if chirp.QuoteOf != nil {
+            ids = append(ids, *chirp.QuoteOf)
+        }
+    }
+    if len(ids) == 0 {
+        return nil
+    }
+
+    chirps, err := cfg.dbQueries.GetChirpsByIDs(ctx, ids)
+    if err != nil {
+        return err
+    }
+    // one level only, a quoted quote shows its QuoteOf without embedding it
+    quoted := toChirpsRes(chirps)
+    if err := cfg.attachMedia(ctx, quoted); err != nil {
+        return err
+    }
+    if err := cfg.attachCards(ctx, quoted); err != nil {
+        return err
+    }
+
+    byID := map[uuid.UUID]*chirpRes{}
+    for i := range quoted {
+        byID[quoted[i].ID] = &quoted[i]
+    }
+    for i := range res {
+        if res[i].QuoteOf != nil {
+            res[i].Quoted = byID[*res[i].QuoteOf]
+        }
+    }
+    return nil
+}
+
+// let the author of a rechirped or quoted chirp know
+func (cfg *apiConfig) notifyOriginalAuthor(ctx context.Context, chirp database.Chirp) {
+    notificationType, originalID := notificationRepost, chirp.RepostOf
+    if chirp.QuoteOf.Valid {
+        notificationType, originalID = notificationQuote, chirp.QuoteOf
+    }
+    if !originalID.Valid {
+        return
+    }
+
+    original, err := cfg.dbQueries.GetChirpByID(ctx, originalID.UUID)
+    if err != nil {
+        return
+    }
+    cfg.notify(ctx, original.UserID, notificationType, chirp.UserID, chirp.ID)
+}
+
+// live events for the rechirps of a chirp that was deleted or restored
+func (cfg *apiConfig) publishRepostEvents(ctx context.Context, chirpID uuid.UUID, eventType string) {
+    reposts, err := cfg.dbQueries.GetRepostsOf(ctx, uuid.NullUUID{UUID: chirpID, Valid: true})
+    if err != nil {
+        slog.ErrorContext(ctx, "Error getting rechirps", "chirp_id", chirpID, "err", err)
+        return
+    }
+    for _, repost := range toChirpsRes(reposts) {
+        cfg.publishChirpEvent(eventType, repost)
+    }
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// chirps answered by GetChirpByID from their id
+func answerChirps(fake *fakeDB, chirps ...database.Chirp) {
+    fake.on("GetChirpByID", func(args []any) (any, error) {
+        for _, chirp := range chirps {
+            if chirp.ID == args[0] {
+                return chirp, nil
+            }
+        }
+        return nil, nil
+    })
+}
+
+func TestRepostChirp(t *testing.T) {
+    tests := []struct {
+        name     string
+        // rechirp the rechirp of the original instead
+        ofRepost bool
+        missing  bool
+        blocked  bool
+        again    bool
+        status   int
+        code     string
+    }{
+        {name: "chirp", status: 201},
+        {name: "rechirp", ofRepost: true, status: 201},
+        {name: "not found", missing: true, status: 404},
+        {name: "blocked", blocked: true, status: 404},
+        {name: "already rechirped", again: true, status: 409, code: codeConflict},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            reposter := testUser(fake, "user")
+            now := time.Now().UTC()
+            original := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: author.ID}
+            repostOf := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: uuid.New(),
+                RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+            if !tt.missing {
+                answerChirps(fake, original, repostOf)
+            }
+            fake.answer("IsBlocked", tt.blocked)
+            fake.answer("IsHidden", false)
+            fake.on("CreateRepost", func(args []any) (any, error) {
+                if tt.again {
+                    return nil, &pq.Error{Code: "23505"}
+                }
+                return database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: args[0].(uuid.UUID),
+                    RepostOf: args[1].(uuid.NullUUID)}, nil
+            })
+            sub := events.NewSubscriber(4)
+            cfg.events.Subscribe(events.GlobalChannel, sub)
+            target := original.ID
+            if tt.ofRepost {
+                target = repostOf.ID
+            }
+
+            rec := serve(t, "POST /api/chirps/{chirpID}/repost", http.HandlerFunc(cfg.repost_chirp), "/api/chirps/"+target.String()+"/repost", testToken(t, reposter.ID, time.Hour), "")
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            if tt.code != "" {
+                if code := errorCode(t, rec); code != tt.code {
+                    t.Errorf("Got code %q, want %q", code, tt.code)
+                }
+            }
+
+            created := fake.called("CreateRepost")
+            if tt.status != 201 {
+                if (len(created) != 0) != tt.again || len(sub.C) != 0 {
+                    t.Errorf("Rechirped: %v", created)
+                }
+                return
+            }
+            // always of the original, never a rechirp of a rechirp
+            if len(created) != 1 || created[0].args[1] != (uuid.NullUUID{UUID: original.ID, Valid: true}) {
+                t.Fatalf("Got rechirps %v", created)
+            }
+            res := chirpRes{}
+            json.Unmarshal(rec.Body.Bytes(), &res)
+            if res.RepostOf == nil || *res.RepostOf != original.ID || res.UserID != reposter.ID {
+                t.Errorf("Got %+v", res)
+            }
+            if notified := fake.called("CreateNotification"); len(notified) != 1 || notified[0].args[0] != author.ID ||
+                notified[0].args[2] != notificationRepost {
+                t.Errorf("Got notifications %v", notified)
+            }
+            if len(sub.C) != 1 {
+                t.Errorf("Got %d events", len(sub.C))
+            }
+        })
+    }
+}
+
+func TestUndoRepost(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    now := time.Now().UTC()
+    originalID := uuid.New()
+    repost := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: user.ID,
+        RepostOf: uuid.NullUUID{UUID: originalID, Valid: true}}
+    token := testToken(t, user.ID, time.Hour)
+
+    rec := serve(t, "DELETE /api/chirps/{chirpID}/repost", http.HandlerFunc(cfg.undo_repost), "/api/chirps/"+originalID.String()+"/repost", token, "")
+    if rec.Code != 404 {
+        t.Errorf("Undoing a missing rechirp got status %d", rec.Code)
+    }
+
+    fake.answer("GetRepost", repost)
+    rec = serve(t, "DELETE /api/chirps/{chirpID}/repost", http.HandlerFunc(cfg.undo_repost), "/api/chirps/"+originalID.String()+"/repost", token, "")
+    if rec.Code != 204 {
+        t.Fatalf("Got status %d", rec.Code)
+    }
+    if lookups := fake.called("GetRepost"); lookups[len(lookups)-1].args[0] != user.ID {
+        t.Errorf("Looked up %v", lookups)
+    }
+    if deleted := fake.called("DeleteRepost"); len(deleted) != 1 || deleted[0].args[0] != repost.ID {
+        t.Errorf("Got deletes %v", deleted)
+    }
+}
+
+func TestQuoteChirp(t *testing.T) {
+    tests := []struct {
+        name     string
+        ofRepost bool
+        missing  bool
+        blocked  bool
+        status   int
+    }{
+        {name: "chirp", status: 201},
+        {name: "rechirp", ofRepost: true, status: 201},
+        {name: "not found", missing: true, status: 400},
+        {name: "blocked", blocked: true, status: 400},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            quoter := testUser(fake, "user")
+            now := time.Now().UTC()
+            original := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello", UserID: author.ID}
+            repostOf := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, UserID: uuid.New(),
+                RepostOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+            if !tt.missing {
+                answerChirps(fake, original, repostOf)
+            }
+            fake.answer("IsBlocked", tt.blocked)
+            fake.answer("IsHidden", false)
+            fake.on("CreateChirp", func(args []any) (any, error) {
+                return database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: args[0].(string), UserID: args[1].(uuid.UUID),
+                    QuoteOf: args[2].(uuid.NullUUID)}, nil
+            })
+            quoted := original.ID
+            if tt.ofRepost {
+                quoted = repostOf.ID
+            }
+
+            body, _ := json.Marshal(map[string]string{"body": "look", "quote_of": quoted.String()})
+            rec := serve(t, "POST /api/chirps", http.HandlerFunc(cfg.create_chirp), "/api/chirps", testToken(t, quoter.ID, time.Hour), string(body))
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+
+            created := fake.called("CreateChirp")
+            if tt.status != 201 {
+                if len(created) != 0 {
+                    t.Errorf("Created: %v", created)
+                }
+                return
+            }
+            if len(created) != 1 || created[0].args[2] != (uuid.NullUUID{UUID: original.ID, Valid: true}) {
+                t.Fatalf("Got chirps %v", created)
+            }
+            if notified := fake.called("CreateNotification"); len(notified) != 1 || notified[0].args[0] != author.ID ||
+                notified[0].args[2] != notificationQuote {
+                t.Errorf("Got notifications %v", notified)
+            }
+        })
+    }
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/logging"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stable error codes, clients switch on these rather than on messages
+const (
+    codeBadRequest            = "bad_request"
+    codeInvalidJSON           = "invalid_json"
+    codeValidation            = "validation_failed"
+    codeUnauthorized          = "unauthorized"
+    codeInvalidCredentials    = "invalid_credentials"
+    codePasswordResetRequired = "password_reset_required"
+    codeForbidden             = "forbidden"
+    codeAccountSuspended      = "account_suspended"
+    codeNotFound              = "not_found"
+    codeConflict              = "conflict"
+    codeEmailTaken            = "email_taken"
+    codeHandleTaken           = "handle_taken"
+    codeGone                  = "gone"
+    codePayloadTooLarge       = "payload_too_large"
+    codeUnsupportedMediaType  = "unsupported_media_type"
+    codeTooManyRequests       = "too_many_requests"
+    codeInternal              = "internal_error"
+    codeUnavailable           = "unavailable"
+)
+
+// the code of an error nothing more specific is known about
+func codeForStatus(status int) string {
+    switch status {
+    case 400:
+        return codeBadRequest
+    case 401:
+        return codeUnauthorized
+    case 403:
+        return codeForbidden
+    case 404:
+        return codeNotFound
+    case 409:
+        return codeConflict
+    case 410:
+        return codeGone
+    case 413:
+        return codePayloadTooLarge
+    case 415:
+        return codeUnsupportedMediaType
+    case 422:
+        return codeValidation
+    case 429:
+        return codeTooManyRequests
+    case 503:
+        return codeUnavailable
+    }
+    return codeInternal
+}
+
+// body of every error response, an RFC 7807 problem
+// with the code, request id and field errors as extensions
+type apiError struct {
+    Type      string          `json:"type"`
+    Title     string          `json:"title"`
+    Status    int             `json:"status"`
+    Code      string          `json:"code"`
+    // the message, for people
+    Detail    string          `json:"detail"`
+    Instance  string          `json:"instance"`
+    RequestID string          `json:"request_id,omitempty"`
+    Fields    validate.Errors `json:"errors,omitempty"`
+}
+
+// encode v as the json body of the response
+// keeps a more specific Content-Type if the caller already set one
+func respondJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+    // under the request's span, a no-op without one
+    parent := trace.SpanFromContext(r.Context())
+    _, span := parent.TracerProvider().Tracer(tracerName).Start(r.Context(), "json.encode")
+    data, err := json.Marshal(v)
+    span.End()
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error marshalling response", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if w.Header().Get("Content-Type") == "" {
+        w.Header().Set("Content-Type", "application/json")
+    }
+    w.WriteHeader(status)
+    w.Write(data)
+}
+
+// an error response with its code and message
+func respondError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+    respondProblem(w, r, apiError{
+        Status: status,
+        Code: code,
+        Detail: message,
+    })
+}
+
+// an error that needs no more explanation than its status
+func respondStatus(w http.ResponseWriter, r *http.Request, status int) {
+    respondError(w, r, status, codeForStatus(status), http.StatusText(status))
+}
+
+// the rest of p is filled in from the status and the request
+func respondProblem(w http.ResponseWriter, r *http.Request, p apiError) {
+    p.Type = "about:blank"
+    p.Title = http.StatusText(p.Status)
+    p.Instance = r.URL.Path
+    p.RequestID = logging.RequestID(r.Context())
+
+    data, err := json.Marshal(p)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error marshalling problem", "err", err)
+        w.WriteHeader(p.Status)
+        return
+    }
+    w.Header().Set("Content-Type", "application/problem+json")
+    w.WriteHeader(p.Status)
+    w.Write(data)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+)
+
+// the first admin of a dev server, with PLATFORM=dev the user signing
+// up with DEV_ADMIN_EMAIL gets the admin role instead of a psql grant
+func (cfg *apiConfig) seedDevAdmin(ctx context.Context, user database.User) (database.User, error) {
+    if cfg.platform != "dev" || cfg.devAdminEmail == "" || !strings.EqualFold(user.Email, cfg.devAdminEmail) {
+        return user, nil
+    }
+    admin, err := cfg.dbQueries.SetUserRole(ctx, database.SetUserRoleParams{
+        ID: user.ID,
+        Role: auth.RoleAdmin,
+    })
+    if err != nil {
+        return user, err
+    }
+    slog.InfoContext(ctx, "Made the dev admin", "user_id", user.ID)
+    return admin, nil
+}
+
+type ctxKey int
+
+const adminUserKey ctxKey = iota
+
+// guards an /admin endpoint, the user must have at least the wanted role
+// it's read from the db on every request, so a revoked role stops working right away
+func (cfg *apiConfig) requireRole(wanted string, next http.HandlerFunc) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        user, err := cfg.authenticatedAccount(r)
+        if err != nil {
+            slog.WarnContext(r.Context(), "Error validating admin token", "err", err)
+            respondAuthError(w, r, err)
+            return
+        }
+        if !auth.HasRole(user.Role, wanted) {
+            cfg.recordAudit(r, audit.Event{
+                Type: audit.AdminAccess,
+                ActorID: user.ID,
+                TargetType: "endpoint",
+                TargetID: r.Pattern,
+                Outcome: audit.Denied,
+                Detail: "needs " + wanted,
+            })
+            respondStatus(w, r, 403)
+            return
+        }
+
+        next(w, r.WithContext(context.WithValue(r.Context(), adminUserKey, user.ID)))
+    })
+}
+
+// the user let through by requireRole
+func adminUser(r *http.Request) uuid.UUID {
+    id, _ := r.Context().Value(adminUserKey).(uuid.UUID)
+    return id
+}
+
+// grant a role, or revoke it by setting the user role back
+// it applies to the next request of the user
+func (cfg *apiConfig) set_user_role(w http.ResponseWriter, r *http.Request) {
+    adminID := adminUser(r)
+
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    // keeps the last admin from locking everyone out
+    if userID == adminID {
+        respondError(w, r, 400, codeBadRequest, "You can't change your own role")
+        return
+    }
+
+    type parameters struct {
+        Role string `json:"role"`
+    }
+    params := parameters{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    if v.Required("role", params.Role) {
+        v.Check(auth.ValidRole(params.Role), "role", validate.CodeInvalid, "Role must be user, moderator or admin")
+    }
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+    if err != nil {
+        respondStatus(w, r, 404)
+        return
+    }
+    previous := user.Role
+
+    user, err = cfg.dbQueries.SetUserRole(r.Context(), database.SetUserRoleParams{
+        ID: userID,
+        Role: params.Role,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error setting user role", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    cfg.recordAction(r.Context(), database.CreateModerationActionParams{
+        ModeratorID: adminID,
+        Action: actionSetRole,
+        UserID: nullID(userID),
+        Note: fmt.Sprintf("%s -> %s", previous, user.Role),
+    })
+    cfg.recordAudit(r, audit.Event{
+        Type: audit.RoleChanged,
+        ActorID: adminID,
+        TargetType: "user",
+        TargetID: userID.String(),
+        Outcome: audit.Success,
+        Detail: fmt.Sprintf("%s -> %s", previous, user.Role),
+    })
+
+    type roleRes struct {
+        ID   uuid.UUID `json:"id"`
+        Role string    `json:"role"`
+    }
+    respondJSON(w, r, 200, roleRes{
+        ID: user.ID,
+        Role: user.Role,
+    })
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestRequireRole(t *testing.T) {
+    tests := []struct {
+        name   string
+        wanted string
+        // the user as the db has it now, the token is made for it
+        role      string
+        change    func(user *database.User)
+        expiresIn time.Duration
+        noToken   bool
+        status    int
+        code      string
+        denied    bool
+    }{
+        {name: "admin", wanted: auth.RoleAdmin, role: auth.RoleAdmin, status: 200},
+        {name: "moderator route", wanted: auth.RoleModerator, role: auth.RoleAdmin, status: 200},
+        {name: "missing token", wanted: auth.RoleAdmin, role: auth.RoleAdmin, noToken: true, status: 401, code: codeUnauthorized},
+        {name: "expired token", wanted: auth.RoleAdmin, role: auth.RoleAdmin, expiresIn: -time.Minute, status: 401, code: codeUnauthorized},
+        {name: "downgraded since the login", wanted: auth.RoleAdmin, role: auth.RoleAdmin,
+            change: func(user *database.User) { user.Role = auth.RoleUser },
+            status: 403, code: codeForbidden, denied: true},
+        {name: "suspended admin", wanted: auth.RoleAdmin, role: auth.RoleAdmin,
+            change: func(user *database.User) {
+                user.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+                user.SuspensionReason = "spam"
+            },
+            status: 403, code: codeAccountSuspended},
+        {name: "deleted admin", wanted: auth.RoleAdmin, role: auth.RoleAdmin,
+            change: func(user *database.User) { user.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true} },
+            status: 401, code: codeUnauthorized},
+        {name: "moderator on an admin route", wanted: auth.RoleAdmin, role: auth.RoleModerator, status: 403, code: codeForbidden, denied: true},
+        {name: "user on a moderator route", wanted: auth.RoleModerator, role: auth.RoleUser, status: 403, code: codeForbidden, denied: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, tt.role)
+            token := ""
+            if !tt.noToken {
+                expiresIn := tt.expiresIn
+                if expiresIn == 0 {
+                    expiresIn = time.Hour
+                }
+                // the token claims the role, requireRole reads the db
+                var err error
+                token, err = auth.MakeJWTWithRole(user.ID, tt.role, testSecret, expiresIn)
+                if err != nil {
+                    t.Fatalf("Couldn't make jwt: %v", err)
+                }
+            }
+            if tt.change != nil {
+                tt.change(&user)
+                fake.addUser(user)
+            }
+
+            var let uuid.UUID
+            handler := cfg.requireRole(tt.wanted, func(w http.ResponseWriter, r *http.Request) {
+                let = adminUser(r)
+                respondStatus(w, r, 200)
+            })
+            rec := serve(t, "GET /admin/things", handler, "/admin/things", token, "")
+
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            if tt.status == 200 {
+                if let != user.ID {
+                    t.Errorf("Handler got admin user %v, want %v", let, user.ID)
+                }
+            } else {
+                if let != uuid.Nil {
+                    t.Errorf("Handler ran for a %d", tt.status)
+                }
+                if code := errorCode(t, rec); code != tt.code {
+                    t.Errorf("Got code %q, want %q", code, tt.code)
+                }
+            }
+
+            denied := fake.audited(audit.AdminAccess)
+            if tt.denied && (len(denied) != 1 || denied[0] != audit.Denied) {
+                t.Errorf("Got admin access audit %v, want one denied", denied)
+            }
+            if !tt.denied && len(denied) != 0 {
+                t.Errorf("Got admin access audit %v, want none", denied)
+            }
+        })
+    }
+}
+
+func TestSeedDevAdmin(t *testing.T) {
+    tests := []struct {
+        name     string
+        platform string
+        email    string
+        admin    bool
+    }{
+        {name: "dev admin", platform: "dev", email: "Admin@example.com", admin: true},
+        {name: "another user", platform: "dev", email: "someone@example.com"},
+        {name: "not dev", email: "admin@example.com"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            cfg.platform = tt.platform
+            cfg.devAdminEmail = "admin@example.com"
+            fake.on("CreateUser", func(args []any) (any, error) {
+                return database.User{ID: uuid.New(), Email: args[0].(string), Role: auth.RoleUser}, nil
+            })
+            fake.on("SetUserRole", func(args []any) (any, error) {
+                return database.User{ID: args[0].(uuid.UUID), Email: tt.email, Role: args[1].(string)}, nil
+            })
+
+            body := `{"email": "` + tt.email + `", "password": "a new long password 42"}`
+            rec := serve(t, "POST /api/users", http.HandlerFunc(cfg.create_user), "/api/users", "", body)
+            if rec.Code != 201 {
+                t.Fatalf("Got status %d: %s", rec.Code, rec.Body)
+            }
+
+            granted := fake.called("SetUserRole")
+            if tt.admin != (len(granted) == 1 && granted[0].args[1] == auth.RoleAdmin) {
+                t.Errorf("Got role changes %v", granted)
+            }
+        })
+    }
+}
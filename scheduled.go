@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/validate"
+	"github.com/google/uuid"
+)
+
+// how far ahead a chirp can be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// how often the scheduler looks for due chirps
+const schedulerInterval = 15 * time.Second
+
+type scheduledChirpRes struct {
+    chirpRes
+    PublishAt time.Time `json:"publish_at"`
+}
+
+func (cfg *apiConfig) toScheduledChirpsRes(ctx context.Context, chirps []database.Chirp) ([]scheduledChirpRes, error) {
+    loaded, err := cfg.loadChirps(ctx, chirps)
+    if err != nil {
+        return nil, err
+    }
+    res := make([]scheduledChirpRes, 0, len(chirps))
+    for i, chirp := range chirps {
+        res = append(res, scheduledChirpRes{
+            chirpRes: loaded[i],
+            PublishAt: chirp.PublishAt.Time,
+        })
+    }
+    return res, nil
+}
+
+// writes the scheduled chirp with its media
+func (cfg *apiConfig) writeScheduledChirp(w http.ResponseWriter, r *http.Request, code int, chirp database.Chirp) {
+    res, err := cfg.toScheduledChirpsRes(r.Context(), []database.Chirp{chirp})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error loading scheduled chirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    respondJSON(w, r, code, res[0])
+}
+
+// a publish_at in the past means "publish now"
+func isScheduled(publishAt *time.Time) bool {
+    return publishAt != nil && publishAt.After(time.Now())
+}
+
+func validatePublishAt(publishAt time.Time) error {
+    if !publishAt.After(time.Now()) {
+        return fmt.Errorf("publish_at must be in the future")
+    }
+    if publishAt.After(time.Now().Add(maxScheduleAhead)) {
+        return fmt.Errorf("publish_at can't be more than a year ahead")
+    }
+    return nil
+}
+
+// store a chirp to be published by the scheduler at publishAt
+// publishAt has been validated by the caller
+func (cfg *apiConfig) create_scheduled_chirp(w http.ResponseWriter, r *http.Request, userID uuid.UUID, body string, publishAt time.Time, mediaIDs []uuid.UUID, quoteOf, inReplyTo uuid.NullUUID) {
+
+    chirp, err := cfg.createChirp(r.Context(), body, userID, &publishAt, mediaIDs, quoteOf, inReplyTo)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error creating scheduled chirp in db", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    cfg.writeScheduledChirp(w, r, 201, chirp)
+}
+
+// scheduled chirps of the user, next to be published first
+func (cfg *apiConfig) get_scheduled_chirps(w http.ResponseWriter, r *http.Request) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for scheduled chirps", "err", err)
+        respondAuthError(w, r, err)
+        return
+    }
+
+    chirps, err := cfg.dbQueries.GetScheduledChirpsFromUser(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting scheduled chirps", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+
+    res, err := cfg.toScheduledChirpsRes(r.Context(), chirps)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error loading scheduled chirps", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    respondJSON(w, r, 200, res)
+}
+
+// scheduled chirp from the {chirpID} path value, owned by the user
+// writes the error response when it can't be used
+func (cfg *apiConfig) ownScheduledChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+    userID, err := cfg.authenticatedUser(r)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error authenticating user for scheduled chirp", "err", err)
+        respondAuthError(w, r, err)
+        return database.Chirp{}, false
+    }
+
+    chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "Error parsing scheduled chirp uuid", "err", err)
+        respondStatus(w, r, 404)
+        return database.Chirp{}, false
+    }
+
+    chirp, err := cfg.dbQueries.GetScheduledChirpByID(r.Context(), chirpID)
+    if err != nil {
+        slog.WarnContext(r.Context(), "Scheduled chirp not found", "err", err)
+        respondStatus(w, r, 404)
+        return database.Chirp{}, false
+    }
+
+    // other users' scheduled chirps don't exist for this user
+    if chirp.UserID != userID {
+        respondStatus(w, r, 404)
+        return database.Chirp{}, false
+    }
+    return chirp, true
+}
+
+// move a scheduled chirp to a new publish_at
+func (cfg *apiConfig) reschedule_chirp(w http.ResponseWriter, r *http.Request) {
+    type rescheduleParams struct {
+        PublishAt *time.Time `json:"publish_at"`
+    }
+
+    params := rescheduleParams{}
+    if !decodeJSON(w, r, &params) {
+        return
+    }
+    v := validate.Validator{}
+    if v.Check(params.PublishAt != nil, "publish_at", validate.CodeRequired, "Is required") {
+        if err := validatePublishAt(*params.PublishAt); err != nil {
+            v.Add("publish_at", validate.CodeInvalid, err.Error())
+        }
+    }
+    if !checkValid(w, r, &v) {
+        return
+    }
+
+    chirp, ok := cfg.ownScheduledChirp(w, r)
+    if !ok {
+        return
+    }
+
+    chirp, err := cfg.dbQueries.RescheduleChirp(r.Context(), database.RescheduleChirpParams{
+        ID: chirp.ID,
+        PublishAt: sql.NullTime{Time: params.PublishAt.UTC(), Valid: true},
+    })
+    if err != nil {
+        // published by the scheduler in the meantime
+        slog.WarnContext(r.Context(), "Scheduled chirp to reschedule not found", "err", err)
+        respondStatus(w, r, 404)
+        return
+    }
+
+    cfg.writeScheduledChirp(w, r, 200, chirp)
+}
+
+// drop a scheduled chirp before it goes out
+func (cfg *apiConfig) cancel_scheduled_chirp(w http.ResponseWriter, r *http.Request) {
+    chirp, ok := cfg.ownScheduledChirp(w, r)
+    if !ok {
+        return
+    }
+
+    cancelled, err := cfg.dbQueries.CancelScheduledChirp(r.Context(), chirp.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error cancelling scheduled chirp", "err", err)
+        respondStatus(w, r, 500)
+        return
+    }
+    if cancelled == 0 {
+        respondStatus(w, r, 404)
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// publish every chirp whose time has come
+// state lives in the db, so chirps due while the server was down
+// go out on the first run after a restart
+func (cfg *apiConfig) publishScheduledChirps(ctx context.Context) {
+    chirps, err := cfg.dbQueries.PublishDueChirps(ctx)
+    if err != nil {
+        slog.ErrorContext(ctx, "Error publishing scheduled chirps", "err", err)
+        return
+    }
+
+    for _, chirp := range chirps {
+        cfg.chirpPublished(ctx, chirp)
+    }
+    if len(chirps) > 0 {
+        slog.InfoContext(ctx, "Published scheduled chirps", "count", len(chirps))
+    }
+}
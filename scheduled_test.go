@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+// answer chirp inserts with the chirp written
+func echoChirps(fake *fakeDB) {
+    fake.on("CreateChirp", func(args []any) (any, error) {
+        now := time.Now().UTC()
+        return database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: args[0].(string), UserID: args[1].(uuid.UUID)}, nil
+    })
+    fake.on("CreateScheduledChirp", func(args []any) (any, error) {
+        now := time.Now().UTC()
+        return database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: args[0].(string), UserID: args[1].(uuid.UUID),
+            PublishAt: args[2].(sql.NullTime)}, nil
+    })
+}
+
+func TestCreateScheduledChirp(t *testing.T) {
+    tests := []struct {
+        name      string
+        publishAt time.Time
+        status    int
+        // the insert used, none when invalid
+        query     string
+        published bool
+    }{
+        {name: "future", publishAt: time.Now().Add(time.Hour), status: 201, query: "CreateScheduledChirp"},
+        {name: "past is now", publishAt: time.Now().Add(-time.Hour), status: 201, query: "CreateChirp", published: true},
+        {name: "over a year ahead", publishAt: time.Now().Add(maxScheduleAhead + time.Hour), status: 422},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, "user")
+            echoChirps(fake)
+            sub := events.NewSubscriber(4)
+            cfg.events.Subscribe(events.GlobalChannel, sub)
+
+            body, _ := json.Marshal(map[string]any{"body": "later", "publish_at": tt.publishAt})
+            rec := serve(t, "POST /api/chirps", http.HandlerFunc(cfg.create_chirp), "/api/chirps", testToken(t, user.ID, time.Hour), string(body))
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+
+            created := append(fake.called("CreateChirp"), fake.called("CreateScheduledChirp")...)
+            if tt.query == "" {
+                if len(created) != 0 {
+                    t.Errorf("Created: %v", created)
+                }
+                return
+            }
+            if calls := fake.called(tt.query); len(created) != 1 || len(calls) != 1 {
+                t.Fatalf("Got inserts %v, want %s", created, tt.query)
+            }
+            // a scheduled chirp stays private until the scheduler publishes it
+            if published := len(sub.C) > 0; published != tt.published {
+                t.Errorf("Published: %v, want %v", published, tt.published)
+            }
+            if !tt.published {
+                res := scheduledChirpRes{}
+                json.Unmarshal(rec.Body.Bytes(), &res)
+                if !res.PublishAt.Equal(tt.publishAt) {
+                    t.Errorf("Got publish_at %v, want %v", res.PublishAt, tt.publishAt)
+                }
+            }
+        })
+    }
+}
+
+func TestRescheduleChirp(t *testing.T) {
+    tests := []struct {
+        name      string
+        other     bool
+        publishAt time.Time
+        status    int
+    }{
+        {name: "author", publishAt: time.Now().Add(2 * time.Hour), status: 200},
+        {name: "someone else's", other: true, publishAt: time.Now().Add(2 * time.Hour), status: 404},
+        {name: "in the past", publishAt: time.Now().Add(-time.Hour), status: 422},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            author := testUser(fake, "user")
+            other := testUser(fake, "user")
+            now := time.Now().UTC()
+            chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "later", UserID: author.ID,
+                PublishAt: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}
+            fake.answer("GetScheduledChirpByID", chirp)
+            fake.answer("RescheduleChirp", chirp)
+            caller := author
+            if tt.other {
+                caller = other
+            }
+
+            body, _ := json.Marshal(map[string]any{"publish_at": tt.publishAt})
+            rec := serve(t, "PUT /api/scheduled_chirps/{chirpID}", http.HandlerFunc(cfg.reschedule_chirp), "/api/scheduled_chirps/"+chirp.ID.String(), testToken(t, caller.ID, time.Hour), string(body))
+            if rec.Code != tt.status {
+                t.Fatalf("Got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+            }
+            calls := fake.called("RescheduleChirp")
+            if (tt.status == 200) != (len(calls) == 1) {
+                t.Errorf("Got reschedules %v", calls)
+            }
+        })
+    }
+}
+
+func TestCancelScheduledChirp(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    now := time.Now().UTC()
+    chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "later", UserID: user.ID,
+        PublishAt: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}
+    fake.answer("GetScheduledChirpByID", chirp)
+    token := testToken(t, user.ID, time.Hour)
+
+    rec := serve(t, "DELETE /api/scheduled_chirps/{chirpID}", http.HandlerFunc(cfg.cancel_scheduled_chirp), "/api/scheduled_chirps/"+chirp.ID.String(), token, "")
+    if rec.Code != 204 {
+        t.Errorf("Got status %d", rec.Code)
+    }
+
+    // published by the scheduler in the meantime
+    fake.answer("CancelScheduledChirp", int64(0))
+    rec = serve(t, "DELETE /api/scheduled_chirps/{chirpID}", http.HandlerFunc(cfg.cancel_scheduled_chirp), "/api/scheduled_chirps/"+chirp.ID.String(), token, "")
+    if rec.Code != 404 {
+        t.Errorf("Cancelling a published chirp got status %d", rec.Code)
+    }
+}
+
+func TestPublishScheduledChirps(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    now := time.Now().UTC()
+    due := []database.Chirp{
+        {ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "one", UserID: user.ID},
+        {ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "two", UserID: user.ID},
+    }
+    fake.answer("PublishDueChirps", due)
+    sub := events.NewSubscriber(4)
+    cfg.events.Subscribe(events.AuthorChannel(user.ID), sub)
+
+    cfg.publishScheduledChirps(context.Background())
+
+    for _, chirp := range due {
+        select {
+        case ev := <-sub.C:
+            if ev.Type != events.ChirpCreated || ev.Data.(chirpRes).ID != chirp.ID {
+                t.Errorf("Got event %+v, want %s created", ev, chirp.ID)
+            }
+        default:
+            t.Errorf("%s wasn't published", chirp.ID)
+        }
+    }
+}
@@ -0,0 +1,38 @@
+-- name: LockAuditLog :exec
+SELECT pg_advisory_xact_lock(7201);
+
+-- name: GetLastAuditHash :one
+SELECT hash FROM audit_log ORDER BY seq DESC LIMIT 1;
+
+-- name: InsertAuditEntry :one
+INSERT INTO audit_log (id, created_at, event_type, actor_id, target_type, target_id, ip, user_agent, outcome, detail, prev_hash, hash)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
+)
+RETURNING *;
+
+-- name: GetAuditEntries :many
+SELECT * FROM audit_log
+WHERE (sqlc.arg(event_type)::text = '' OR event_type = sqlc.arg(event_type))
+    AND (sqlc.arg(actor_id)::text = '' OR actor_id::text = sqlc.arg(actor_id))
+    AND (sqlc.arg(target_id)::text = '' OR target_id = sqlc.arg(target_id))
+    AND seq < sqlc.arg(before_seq)
+ORDER BY seq DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetAuditChain :many
+SELECT * FROM audit_log
+WHERE seq > $1
+ORDER BY seq
+LIMIT $2;
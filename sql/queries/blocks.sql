@@ -0,0 +1,38 @@
+-- name: BlockUser :exec
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlocks :many
+SELECT * FROM blocks WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: MuteUser :exec
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (muter_id, muted_id) DO NOTHING;
+
+-- name: UnmuteUser :execrows
+DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: GetMutes :many
+SELECT * FROM mutes WHERE muter_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetHiddenUsers :many
+SELECT * FROM hidden_users WHERE viewer_id = $1;
+
+-- name: IsBlocked :one
+SELECT EXISTS (
+    SELECT 1 FROM hidden_users
+    WHERE viewer_id = $1 AND user_id = $2 AND blocked
+);
+
+-- name: IsHidden :one
+SELECT EXISTS (
+    SELECT 1 FROM hidden_users
+    WHERE viewer_id = $1 AND user_id = $2
+);
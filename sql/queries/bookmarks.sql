@@ -0,0 +1,24 @@
+-- name: CreateBookmark :exec
+INSERT INTO bookmarks (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteBookmark :execrows
+DELETE FROM bookmarks WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetBookmarks :many
+SELECT bookmarks.created_at AS bookmarked_at, chirps.* FROM bookmarks
+JOIN chirps ON chirps.id = bookmarks.chirp_id
+WHERE bookmarks.user_id = sqlc.arg(user_id)
+    AND (sqlc.narg(before_created_at)::timestamp IS NULL
+        OR (bookmarks.created_at, bookmarks.chirp_id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_chirp_id)::uuid))
+    AND chirps.deleted_at IS NULL AND chirps.publish_at IS NULL
+    AND chirps.user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND chirps.user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = sqlc.arg(user_id) AND blocked)
+ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetAllBookmarksFromUser :many
+SELECT * FROM bookmarks
+WHERE user_id = $1
+ORDER BY created_at;
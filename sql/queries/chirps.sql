@@ -1,22 +1,177 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of, in_reply_to)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
 RETURNING *;
 
 -- name: GetChirps :many
-SELECT * FROM chirps ORDER BY created_at;
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = sqlc.arg(viewer_id))
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+            AND originals.user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = sqlc.arg(viewer_id))
+    ))
+ORDER BY created_at;
 
 -- name: GetChirpByID :one
-SELECT * FROM chirps WHERE id = $1;
+SELECT * FROM chirps
+WHERE id = $1 AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+    ));
 
 -- name: GetChirpsFromUser :many
-SELECT * FROM chirps WHERE user_id = $1 ORDER BY created_at;
+SELECT * FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = sqlc.arg(viewer_id))
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+            AND originals.user_id NOT IN (SELECT user_id FROM hidden_users WHERE viewer_id = sqlc.arg(viewer_id))
+    ))
+ORDER BY created_at;
+
+-- name: GetLatestChirps :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+    ))
+ORDER BY created_at DESC
+LIMIT $1;
+
+-- name: GetLatestChirpsFromUser :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND (repost_of IS NULL OR repost_of IN (
+        SELECT originals.id FROM chirps AS originals
+        JOIN users ON users.id = originals.user_id
+        WHERE originals.deleted_at IS NULL AND users.deleted_at IS NULL
+    ))
+ORDER BY created_at DESC
+LIMIT $2;
 
 -- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1;
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetDeletedChirpByID :one
+SELECT * FROM chirps WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL AND hidden_at IS NULL
+RETURNING *;
+
+-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at IS NOT NULL AND deleted_at < $1 AND hidden_at IS NULL;
+
+-- name: CountChirpsFromUser :one
+SELECT COUNT(*) FROM chirps WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL;
+
+-- name: CountOriginalChirpsFromUser :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at IS NULL AND repost_of IS NULL;
+
+-- name: CreateScheduledChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, quote_of, in_reply_to)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetScheduledChirpsFromUser :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND publish_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY publish_at;
+
+-- name: GetAllChirpsFromUser :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: GetScheduledChirpByID :one
+SELECT * FROM chirps
+WHERE id = $1 AND publish_at IS NOT NULL AND deleted_at IS NULL;
+
+-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $2, updated_at = NOW()
+WHERE id = $1 AND publish_at IS NOT NULL AND deleted_at IS NULL
+RETURNING *;
+
+-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND publish_at IS NOT NULL;
+
+-- name: PublishDueChirps :many
+UPDATE chirps
+SET publish_at = NULL, created_at = publish_at, updated_at = NOW()
+WHERE publish_at IS NOT NULL AND publish_at <= NOW() AND deleted_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+    AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL)
+RETURNING *;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::uuid[]) AND deleted_at IS NULL AND publish_at IS NULL
+    AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL);
+
+-- name: CreateRepost :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, repost_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+RETURNING *;
+
+-- name: GetRepost :one
+SELECT * FROM chirps
+WHERE user_id = $1 AND repost_of = $2 AND deleted_at IS NULL;
+
+-- name: GetRepostsOf :many
+SELECT * FROM chirps
+WHERE repost_of = $1 AND deleted_at IS NULL;
+
+-- name: DeleteRepost :exec
+DELETE FROM chirps WHERE id = $1 AND repost_of IS NOT NULL;
+
+-- name: HideChirp :one
+UPDATE chirps
+SET deleted_at = COALESCE(deleted_at, NOW()), hidden_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL
+RETURNING *;
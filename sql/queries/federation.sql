@@ -0,0 +1,22 @@
+-- name: CreateActorKey :exec
+INSERT INTO actor_keys (user_id, created_at, public_key_pem, private_key_pem)
+VALUES ($1, NOW(), $2, $3)
+ON CONFLICT (user_id) DO NOTHING;
+
+-- name: GetActorKey :one
+SELECT * FROM actor_keys WHERE user_id = $1;
+
+-- name: AddRemoteFollower :exec
+INSERT INTO remote_followers (user_id, actor_id, created_at, inbox, follow_activity_id)
+VALUES ($1, $2, NOW(), $3, $4)
+ON CONFLICT (user_id, actor_id)
+DO UPDATE SET inbox = EXCLUDED.inbox, follow_activity_id = EXCLUDED.follow_activity_id;
+
+-- name: RemoveRemoteFollower :exec
+DELETE FROM remote_followers WHERE user_id = $1 AND actor_id = $2;
+
+-- name: GetRemoteFollowers :many
+SELECT * FROM remote_followers WHERE user_id = $1 ORDER BY created_at;
+
+-- name: CountRemoteFollowers :one
+SELECT COUNT(*) FROM remote_followers WHERE user_id = $1;
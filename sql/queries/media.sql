@@ -0,0 +1,103 @@
+-- name: CreateMediaFile :one
+INSERT INTO media_files (id, created_at, user_id, content_type, size_bytes, blob_key, status, status_updated_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetMediaFileByID :one
+SELECT * FROM media_files WHERE id = $1;
+
+-- name: IsMediaVisible :one
+SELECT EXISTS (
+    SELECT 1 FROM chirp_attachments
+    JOIN chirps ON chirps.id = chirp_attachments.chirp_id
+    JOIN users ON users.id = chirps.user_id
+    WHERE chirp_attachments.media_id = $1
+        AND chirps.deleted_at IS NULL AND chirps.publish_at IS NULL
+        AND users.deleted_at IS NULL
+        AND chirps.user_id NOT IN (
+            SELECT user_id FROM hidden_users WHERE viewer_id = sqlc.arg(viewer_id) AND blocked
+        )
+);
+
+-- name: GetMediaFilesByIDs :many
+SELECT * FROM media_files WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: AttachMediaToChirp :exec
+INSERT INTO chirp_attachments (chirp_id, media_id, position)
+VALUES ($1, $2, $3);
+
+-- name: GetMediaForChirps :many
+SELECT chirp_attachments.chirp_id, media_files.* FROM chirp_attachments
+JOIN media_files ON media_files.id = chirp_attachments.media_id
+WHERE chirp_attachments.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_attachments.chirp_id, chirp_attachments.position;
+
+-- name: GetOrphanMediaFiles :many
+SELECT * FROM media_files
+WHERE created_at < $1
+    AND NOT EXISTS (SELECT 1 FROM chirp_attachments WHERE media_id = media_files.id);
+
+-- name: GetMediaFilesOfDeletedUsers :many
+SELECT media_files.* FROM media_files
+JOIN users ON users.id = media_files.user_id
+WHERE users.deleted_at IS NOT NULL AND users.deleted_at < $1;
+
+-- name: DeleteMediaFile :exec
+DELETE FROM media_files WHERE id = $1;
+
+-- name: ClaimMediaFile :one
+UPDATE media_files
+SET status = 'processing', status_updated_at = NOW()
+WHERE id = $1 AND status = 'pending'
+RETURNING *;
+
+-- name: FinishMediaFile :exec
+UPDATE media_files
+SET status = 'ready', status_updated_at = NOW(),
+    size_bytes = $2, width = $3, height = $4, blurhash = $5
+WHERE id = $1;
+
+-- name: FailMediaFile :exec
+UPDATE media_files
+SET status = 'failed', status_updated_at = NOW(), processing_error = $2
+WHERE id = $1;
+
+-- name: GetPendingMediaFiles :many
+SELECT id FROM media_files
+WHERE status = 'pending'
+ORDER BY created_at
+LIMIT $1;
+
+-- name: ResetStuckMediaFiles :execrows
+UPDATE media_files
+SET status = 'pending', status_updated_at = NOW()
+WHERE status = 'processing' AND status_updated_at < $1;
+
+-- name: UpsertMediaThumbnail :exec
+INSERT INTO media_thumbnails (media_id, size, width, height, content_type, size_bytes, blob_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (media_id, size)
+DO UPDATE SET width = EXCLUDED.width, height = EXCLUDED.height, content_type = EXCLUDED.content_type,
+    size_bytes = EXCLUDED.size_bytes, blob_key = EXCLUDED.blob_key;
+
+-- name: GetMediaThumbnail :one
+SELECT * FROM media_thumbnails WHERE media_id = $1 AND size = $2;
+
+-- name: GetThumbnailsForMedia :many
+SELECT * FROM media_thumbnails
+WHERE media_id = ANY(sqlc.arg(media_ids)::uuid[])
+ORDER BY media_id, width;
+
+-- name: GetMediaFilesFromUser :many
+SELECT * FROM media_files
+WHERE user_id = $1
+ORDER BY created_at;
@@ -13,6 +13,9 @@ RETURNING *;
 -- name: GetUserFromRToken :one
 SELECT * FROM refresh_tokens WHERE token = $1;
 
+-- name: GetRTokensFromUser :many
+SELECT * FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at;
+
 -- name: RefreshRToken :exec
 UPDATE refresh_tokens
 SET token = $2, updated_at = NOW(), expires_at = $3
@@ -23,3 +26,12 @@ UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
 WHERE token = $1;
 
+-- name: RevokeUserRTokensExcept :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND token <> $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserRTokens :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
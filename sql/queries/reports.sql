@@ -0,0 +1,57 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, reporter_id, chirp_id, reason, comment)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetReportByID :one
+SELECT * FROM reports WHERE id = $1;
+
+-- name: GetReportsByStatus :many
+SELECT reports.*, chirps.body AS chirp_body, chirps.user_id AS chirp_author_id, chirps.hidden_at AS chirp_hidden_at
+FROM reports
+JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.status = $1
+ORDER BY reports.created_at
+LIMIT $2;
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed', claimed_by = $2, claimed_at = NOW()
+WHERE id = $1 AND (status = 'open' OR (status = 'claimed' AND claimed_by = $2))
+RETURNING *;
+
+-- name: ResolveReport :one
+UPDATE reports
+SET status = 'resolved', resolved_at = NOW(), resolution = $3
+WHERE id = $1 AND status = 'claimed' AND claimed_by = $2
+RETURNING *;
+
+-- name: ResolveReportsForChirp :execrows
+UPDATE reports
+SET status = 'resolved', resolved_at = NOW(), resolution = $2
+WHERE chirp_id = $1 AND status <> 'resolved';
+
+-- name: CreateModerationAction :exec
+INSERT INTO moderation_actions (id, created_at, moderator_id, action, report_id, chirp_id, user_id, note)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
+
+-- name: GetModerationActions :many
+SELECT * FROM moderation_actions
+ORDER BY created_at DESC
+LIMIT $1;
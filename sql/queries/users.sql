@@ -10,18 +10,76 @@ VALUES (
 RETURNING *;
 
 -- name: GetUserByEmail :one
-SELECT * FROM users WHERE email = $1;
+SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL;
 
 -- name: GetUserByID :one
-SELECT * FROM users WHERE id = $1;
+SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: UpdateUser :exec
 UPDATE users
 SET email = $2, updated_at = NOW(), hashed_password = $3
 WHERE id = $1;
 
--- name: UpgradeUser :exec
+-- name: UpgradeUser :execrows
 UPDATE users
 SET is_chirpy_red = true, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users WHERE handle = $1 AND deleted_at IS NULL;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = $2, display_name = $3, bio = $4, avatar_url = $5, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SoftDeleteUser :exec
+UPDATE users
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND deleted_at < $1;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET suspended_at = NOW(), suspension_reason = $2, updated_at = NOW()
 WHERE id = $1;
 
+-- name: UnsuspendUser :exec
+UPDATE users
+SET suspended_at = NULL, suspension_reason = '', updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE email ILIKE sqlc.arg(pattern) OR handle ILIKE sqlc.arg(pattern)
+ORDER BY created_at
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetAnyUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: SetChirpyRed :exec
+UPDATE users
+SET is_chirpy_red = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: RequirePasswordReset :exec
+UPDATE users
+SET password_reset_hash = $2, password_reset_expires_at = $3, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ResetPassword :one
+UPDATE users
+SET hashed_password = $2, password_reset_hash = '', password_reset_expires_at = NULL, updated_at = NOW()
+WHERE password_reset_hash = $1 AND password_reset_expires_at > NOW() AND deleted_at IS NULL
+RETURNING *;
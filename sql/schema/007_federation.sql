@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE actor_keys (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    public_key_pem TEXT NOT NULL,
+    private_key_pem TEXT NOT NULL
+);
+
+CREATE TABLE remote_followers (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    inbox TEXT NOT NULL,
+    follow_activity_id TEXT NOT NULL,
+    PRIMARY KEY (user_id, actor_id)
+);
+
+-- +goose Down
+DROP TABLE remote_followers;
+DROP TABLE actor_keys;
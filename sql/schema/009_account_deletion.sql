@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE subscription_events;
+ALTER TABLE users DROP COLUMN deleted_at;
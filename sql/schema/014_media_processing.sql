@@ -0,0 +1,33 @@
+-- +goose Up
+-- uploads from before processing existed are served as they are
+ALTER TABLE media_files
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'ready',
+    ADD COLUMN status_updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD COLUMN width INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN height INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN blurhash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN processing_error TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX media_files_status_idx ON media_files (status) WHERE status <> 'ready';
+
+CREATE TABLE media_thumbnails (
+    media_id UUID NOT NULL REFERENCES media_files(id) ON DELETE CASCADE,
+    size TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    blob_key TEXT NOT NULL UNIQUE,
+    PRIMARY KEY (media_id, size)
+);
+
+-- +goose Down
+DROP TABLE media_thumbnails;
+DROP INDEX media_files_status_idx;
+ALTER TABLE media_files
+    DROP COLUMN status,
+    DROP COLUMN status_updated_at,
+    DROP COLUMN width,
+    DROP COLUMN height,
+    DROP COLUMN blurhash,
+    DROP COLUMN processing_error;
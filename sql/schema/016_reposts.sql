@@ -0,0 +1,18 @@
+-- +goose Up
+-- a rechirp has no body of its own and goes away with its original,
+-- a quote keeps its commentary when the quoted chirp is gone
+ALTER TABLE chirps
+    ADD COLUMN repost_of UUID REFERENCES chirps(id) ON DELETE CASCADE,
+    ADD COLUMN quote_of UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+-- one rechirp of the same chirp per user
+CREATE UNIQUE INDEX chirps_repost_idx ON chirps (user_id, repost_of)
+    WHERE repost_of IS NOT NULL AND deleted_at IS NULL;
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of) WHERE quote_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_quote_of_idx;
+DROP INDEX chirps_repost_idx;
+ALTER TABLE chirps
+    DROP COLUMN repost_of,
+    DROP COLUMN quote_of;
@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE blocks (
+    blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX blocks_blocked_id_idx ON blocks (blocked_id);
+
+CREATE TABLE mutes (
+    muter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    muted_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (muter_id, muted_id),
+    CHECK (muter_id <> muted_id)
+);
+
+-- users whose chirps viewer_id doesn't get in timelines:
+-- the ones they muted or blocked, and the ones who blocked them
+CREATE VIEW hidden_users AS
+    SELECT muter_id AS viewer_id, muted_id AS user_id, FALSE AS blocked FROM mutes
+    UNION ALL
+    SELECT blocker_id, blocked_id, TRUE FROM blocks
+    UNION ALL
+    SELECT blocked_id, blocker_id, TRUE FROM blocks;
+
+-- +goose Down
+DROP VIEW hidden_users;
+DROP TABLE mutes;
+DROP TABLE blocks;
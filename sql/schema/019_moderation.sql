@@ -0,0 +1,54 @@
+-- +goose Up
+-- moderators are set by operators for now
+ALTER TABLE users
+    ADD COLUMN is_moderator BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN suspended_at TIMESTAMP,
+    ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+
+-- hidden chirps are also deleted, but can't be restored by their author
+-- and are kept past the retention period
+ALTER TABLE chirps ADD COLUMN hidden_at TIMESTAMP;
+
+CREATE TABLE reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    reporter_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    -- open, claimed or resolved
+    status TEXT NOT NULL DEFAULT 'open',
+    claimed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    claimed_at TIMESTAMP,
+    resolved_at TIMESTAMP,
+    resolution TEXT NOT NULL DEFAULT ''
+);
+
+-- one pending report of a chirp per user
+CREATE UNIQUE INDEX reports_reporter_chirp_idx ON reports (reporter_id, chirp_id)
+    WHERE status <> 'resolved';
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at);
+
+-- every moderator action, rows are never updated or deleted
+-- ids are kept without foreign keys so the trail outlives what it points to
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    moderator_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    report_id UUID,
+    chirp_id UUID,
+    user_id UUID,
+    note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX moderation_actions_created_at_idx ON moderation_actions (created_at);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+DROP TABLE reports;
+ALTER TABLE chirps DROP COLUMN hidden_at;
+ALTER TABLE users
+    DROP COLUMN is_moderator,
+    DROP COLUMN suspended_at,
+    DROP COLUMN suspension_reason;
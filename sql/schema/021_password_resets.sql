@@ -0,0 +1,10 @@
+-- +goose Up
+-- set by an admin forcing a password reset, only the sha256 of the token is kept
+ALTER TABLE users
+    ADD COLUMN password_reset_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN password_reset_expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN password_reset_hash,
+    DROP COLUMN password_reset_expires_at;
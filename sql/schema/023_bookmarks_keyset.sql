@@ -0,0 +1,8 @@
+-- +goose Up
+-- bookmarks are paged by (created_at, chirp_id)
+DROP INDEX bookmarks_user_id_created_at_idx;
+CREATE INDEX bookmarks_user_id_created_at_chirp_id_idx ON bookmarks (user_id, created_at, chirp_id);
+
+-- +goose Down
+DROP INDEX bookmarks_user_id_created_at_chirp_id_idx;
+CREATE INDEX bookmarks_user_id_created_at_idx ON bookmarks (user_id, created_at);
@@ -0,0 +1,20 @@
+-- +goose Up
+-- a reply keeps its body when the chirp it answers is gone
+ALTER TABLE chirps
+    ADD COLUMN in_reply_to UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to) WHERE in_reply_to IS NOT NULL;
+
+CREATE TABLE likes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX likes_chirp_id_idx ON likes (chirp_id);
+
+-- +goose Down
+DROP TABLE likes;
+DROP INDEX chirps_in_reply_to_idx;
+ALTER TABLE chirps DROP COLUMN in_reply_to;
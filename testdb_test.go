@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/audit"
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// handler tests run against fakeDB, a database/sql driver answering
+// sqlc queries by their name with whatever the test set up
+// there is no postgres here, so the sql itself is never checked
+
+// a query the handler ran, args as the sqlc code passed them
+type fakeCall struct {
+    name string
+    args []any
+}
+
+type fakeAnswer func(args []any) (any, error)
+
+// one row with these columns
+type fakeRow []any
+
+type fakeDB struct {
+    mu      sync.Mutex
+    answers map[string]fakeAnswer
+    calls   []fakeCall
+    users   map[uuid.UUID]database.User
+}
+
+func newFakeDB() *fakeDB {
+    f := &fakeDB{
+        answers: map[string]fakeAnswer{},
+        users: map[uuid.UUID]database.User{},
+    }
+    // users added with addUser, deleted ones are gone like in GetUserByID
+    f.on("GetUserByID", func(args []any) (any, error) {
+        f.mu.Lock()
+        defer f.mu.Unlock()
+        user, ok := f.users[args[0].(uuid.UUID)]
+        if !ok || user.DeletedAt.Valid {
+            return nil, nil
+        }
+        return user, nil
+    })
+    // the entry read back is the one written, after its seq
+    f.on("InsertAuditEntry", func(args []any) (any, error) {
+        return append(fakeRow{int64(len(f.called("InsertAuditEntry")))}, args...), nil
+    })
+    return f
+}
+
+// answer a query with rows built from the returned value:
+// a struct or a fakeRow is a row with a column per field, a slice is a row per element,
+// anything else is a row of one column and nil is no rows
+// for statements, an int64 is the number of rows affected
+// queries without an answer return no rows and statements affect one
+func (f *fakeDB) on(name string, answer fakeAnswer) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.answers[name] = answer
+}
+
+// the same value every time
+func (f *fakeDB) answer(name string, v any) {
+    f.on(name, func([]any) (any, error) { return v, nil })
+}
+
+func (f *fakeDB) addUser(user database.User) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.users[user.ID] = user
+}
+
+// every run of the query name
+func (f *fakeDB) called(name string) []fakeCall {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    var calls []fakeCall
+    for _, c := range f.calls {
+        if c.name == name {
+            calls = append(calls, c)
+        }
+    }
+    return calls
+}
+
+// audit events recorded of type eventType, by their outcome
+func (f *fakeDB) audited(eventType string) []string {
+    var outcomes []string
+    for _, c := range f.called("InsertAuditEntry") {
+        if c.args[2] == eventType {
+            outcomes = append(outcomes, c.args[8].(string))
+        }
+    }
+    return outcomes
+}
+
+func (f *fakeDB) run(query string, args []driver.NamedValue) (any, error) {
+    name := queryName(query)
+    values := make([]any, len(args))
+    for i, a := range args {
+        values[i] = a.Value
+    }
+
+    f.mu.Lock()
+    f.calls = append(f.calls, fakeCall{name: name, args: values})
+    answer := f.answers[name]
+    f.mu.Unlock()
+
+    if answer == nil {
+        return nil, nil
+    }
+    return answer(values)
+}
+
+// driver.Connector, for sql.OpenDB
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+    return &fakeConn{db: f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+    return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+    return nil, errors.New("open the fake db with sql.OpenDB")
+}
+
+type fakeConn struct {
+    db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+    return nil, errors.New("fake db: prepared statements aren't supported")
+}
+
+func (c *fakeConn) Close() error {
+    return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+    return fakeTx{}, nil
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+    return fakeTx{}, nil
+}
+
+// args reach the answers as the sqlc code passed them
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error {
+    return nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    v, err := c.db.run(query, args)
+    if err != nil {
+        return nil, err
+    }
+    return newFakeRows(v), nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    v, err := c.db.run(query, args)
+    if err != nil {
+        return nil, err
+    }
+    if n, ok := v.(int64); ok {
+        return driver.RowsAffected(n), nil
+    }
+    return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+    columns []string
+    rows    [][]driver.Value
+}
+
+func newFakeRows(v any) *fakeRows {
+    r := &fakeRows{}
+    rv := reflect.ValueOf(v)
+    switch row, ok := v.(fakeRow); {
+    case v == nil:
+        return r
+    case ok:
+        values := make([]driver.Value, len(row))
+        for i, c := range row {
+            values[i] = columnValue(c)
+        }
+        r.rows = append(r.rows, values)
+    case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8:
+        for i := 0; i < rv.Len(); i++ {
+            r.rows = append(r.rows, rowValues(rv.Index(i)))
+        }
+    default:
+        r.rows = append(r.rows, rowValues(rv))
+    }
+    width := 1
+    if len(r.rows) > 0 {
+        width = len(r.rows[0])
+    }
+    for i := 0; i < width; i++ {
+        r.columns = append(r.columns, fmt.Sprintf("c%d", i))
+    }
+    return r
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// the columns of one row, structs are flattened field by field
+func rowValues(v reflect.Value) []driver.Value {
+    if v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}) && !v.Type().Implements(valuerType) {
+        var values []driver.Value
+        for i := 0; i < v.NumField(); i++ {
+            values = append(values, rowValues(v.Field(i))...)
+        }
+        return values
+    }
+    return []driver.Value{columnValue(v.Interface())}
+}
+
+func columnValue(v any) driver.Value {
+    if valuer, ok := v.(driver.Valuer); ok {
+        value, err := valuer.Value()
+        if err != nil {
+            panic(err)
+        }
+        return value
+    }
+    value, err := driver.DefaultParameterConverter.ConvertValue(v)
+    if err != nil {
+        panic(err)
+    }
+    return value
+}
+
+func (r *fakeRows) Columns() []string {
+    return r.columns
+}
+
+func (r *fakeRows) Close() error {
+    return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+    if len(r.rows) == 0 {
+        return io.EOF
+    }
+    copy(dest, r.rows[0])
+    r.rows = r.rows[1:]
+    return nil
+}
+
+const testSecret = "test secret"
+
+// an apiConfig on a fake db, with nothing else to reach
+func newTestConfig(t *testing.T) (*apiConfig, *fakeDB) {
+    t.Helper()
+    fake := newFakeDB()
+    db := sql.OpenDB(fake)
+    t.Cleanup(func() { db.Close() })
+
+    tp := sdktrace.NewTracerProvider()
+    cfg := &apiConfig{
+        metrics: newAppMetrics(),
+        tracerProvider: tp,
+        tracer: tp.Tracer(tracerName),
+        db: db,
+        secret: testSecret,
+        events: events.NewHub(),
+    }
+    cfg.dbQueries = database.New(cfg.instrumentDB(db))
+    cfg.auditLog = audit.New(db, cfg.instrumentDB)
+    return cfg, fake
+}
+
+// a user known to the fake db
+func testUser(fake *fakeDB, role string) database.User {
+    user := database.User{
+        ID: uuid.New(),
+        CreatedAt: time.Now().UTC(),
+        UpdatedAt: time.Now().UTC(),
+        Email: role + "-" + uuid.NewString()[:8] + "@example.com",
+        Role: role,
+    }
+    fake.addUser(user)
+    return user
+}
+
+func testToken(t *testing.T, userID uuid.UUID, expiresIn time.Duration) string {
+    t.Helper()
+    token, err := auth.MakeJWT(userID, testSecret, expiresIn)
+    if err != nil {
+        t.Fatalf("Couldn't make jwt: %v", err)
+    }
+    return token
+}
+
+// run a request to target through handler, with the method and path values of pattern
+// token is sent as a bearer token unless empty
+func serve(t *testing.T, pattern string, handler http.Handler, target, token, body string) *httptest.ResponseRecorder {
+    t.Helper()
+    mux := http.NewServeMux()
+    mux.Handle(pattern, handler)
+
+    var reader io.Reader
+    if body != "" {
+        reader = strings.NewReader(body)
+    }
+    method, _, _ := strings.Cut(pattern, " ")
+    req := httptest.NewRequest(method, target, reader)
+    if token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+    rec := httptest.NewRecorder()
+    mux.ServeHTTP(rec, req)
+    return rec
+}
+
+// the code of an error response
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+    t.Helper()
+    var body apiError
+    if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+        t.Fatalf("Couldn't decode error %q: %v", rec.Body.String(), err)
+    }
+    return body.Code
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elfabri/bdd-Chirpy-project/internal/auth"
+	"github.com/coder/websocket"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+// per connection limits
+const (
+    wsAuthWait         = time.Second * 10
+    wsPongWait         = time.Second * 60
+    wsPingPeriod       = time.Second * 30
+    wsWriteWait        = time.Second * 10
+    wsMaxMessageSize   = 4096
+    wsSendBuffer       = 64
+    wsMaxSubscriptions = 32
+    // app defined close code, token expired
+    wsCloseTokenExpired websocket.StatusCode = 4001
+    wsCloseUnauthorized websocket.StatusCode = 4003
+)
+
+// message sent by the client
+type wsClientMessage struct {
+    Type    string `json:"type"`
+    Token   string `json:"token,omitempty"`
+    Channel string `json:"channel,omitempty"`
+}
+
+// message sent by the server, besides events.Event
+type wsServerMessage struct {
+    Type      string `json:"type"`
+    Channel   string `json:"channel,omitempty"`
+    Error     string `json:"error,omitempty"`
+    ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// publish chirp events on the global feed and the author's channel
+func (cfg *apiConfig) publishChirpEvent(eventType string, chirp chirpRes) {
+    cfg.events.Publish(events.GlobalChannel, eventType, chirp)
+    cfg.events.Publish(events.AuthorChannel(chirp.UserID), eventType, chirp)
+}
+
+// chirp events from users hidden from the connection, or quoting a blocked one
+func wsHidden(chirp chirpRes, hidden map[uuid.UUID]bool) bool {
+    if _, ok := hidden[chirp.UserID]; ok {
+        return true
+    }
+    return chirp.Quoted != nil && hidden[chirp.Quoted.UserID]
+}
+
+func wsSend(ctx context.Context, conn *websocket.Conn, v any) error {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+    ctx, cancel := context.WithTimeout(ctx, wsWriteWait)
+    defer cancel()
+    return conn.Write(ctx, websocket.MessageText, data)
+}
+
+// map the channel requested by the client to a hub channel
+// "notifications" is always the authenticated user's own channel
+func wsResolveChannel(channel string, userID uuid.UUID) (string, bool) {
+    switch {
+    case channel == events.GlobalChannel:
+        return events.GlobalChannel, true
+    case channel == "notifications":
+        return events.NotificationsChannel(userID), true
+    case strings.HasPrefix(channel, "author:"):
+        authorID, err := uuid.Parse(strings.TrimPrefix(channel, "author:"))
+        if err != nil {
+            return "", false
+        }
+        return events.AuthorChannel(authorID), true
+    }
+    return "", false
+}
+
+// like authenticatedAccount, a valid token of a deleted or suspended user is refused
+func (cfg *apiConfig) wsValidateToken(ctx context.Context, token string) (uuid.UUID, time.Time, error) {
+    userID, expiresAt, err := auth.ValidateJWTWithExpiry(token, cfg.secret)
+    if err != nil {
+        return uuid.UUID{}, time.Time{}, err
+    }
+    if _, err := cfg.activeAccount(ctx, userID); err != nil {
+        return uuid.UUID{}, time.Time{}, err
+    }
+    return userID, expiresAt, nil
+}
+
+// the first frame must be {"type": "auth", "token": <jwt>}
+func (cfg *apiConfig) wsAuthenticate(ctx context.Context, conn *websocket.Conn) (uuid.UUID, time.Time, bool) {
+    readCtx, cancel := context.WithTimeout(ctx, wsAuthWait)
+    defer cancel()
+    _, data, err := conn.Read(readCtx)
+    if err != nil {
+        slog.WarnContext(ctx, "Websocket closed before auth", "err", err)
+        return uuid.UUID{}, time.Time{}, false
+    }
+
+    msg := wsClientMessage{}
+    if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "auth" {
+        wsSend(ctx, conn, wsServerMessage{Type: "error", Error: "first message must be auth"})
+        conn.Close(wsCloseUnauthorized, "unauthorized")
+        return uuid.UUID{}, time.Time{}, false
+    }
+
+    userID, expiresAt, err := cfg.wsValidateToken(ctx, msg.Token)
+    if err != nil {
+        slog.WarnContext(ctx, "Error validating websocket token", "err", err)
+        wsSend(ctx, conn, wsServerMessage{Type: "error", Error: "invalid token"})
+        conn.Close(wsCloseUnauthorized, "unauthorized")
+        return uuid.UUID{}, time.Time{}, false
+    }
+
+    return userID, expiresAt, true
+}
+
+// websocket api for live timeline and notifications
+// auth with the same jwt as create_chirp, sent in the first frame
+func (cfg *apiConfig) ws_connect(w http.ResponseWriter, r *http.Request) {
+    // the token comes in the first message, not from cookies,
+    // so pages from any origin can connect
+    conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: []string{"*"}})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error upgrading to websocket", "err", err)
+        return
+    }
+    defer conn.CloseNow()
+    cfg.metrics.websocketConnections.Inc()
+    defer cfg.metrics.websocketConnections.Dec()
+    conn.SetReadLimit(wsMaxMessageSize)
+
+    userID, expiresAt, ok := cfg.wsAuthenticate(r.Context(), conn)
+    if !ok {
+        return
+    }
+    if err := wsSend(r.Context(), conn, wsServerMessage{
+        Type: "auth.ok",
+        ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+    }); err != nil {
+        return
+    }
+
+    sub := events.NewSubscriber(wsSendBuffer)
+    defer cfg.events.UnsubscribeAll(sub)
+    subscribed := map[string]bool{}
+
+    // reader goroutine, hands client messages to the write loop
+    incoming := make(chan wsClientMessage)
+    readErr := make(chan error, 1)
+    done := make(chan struct{})
+    defer close(done)
+
+    go func() {
+        for {
+            _, data, err := conn.Read(r.Context())
+            if err != nil {
+                readErr <- err
+                return
+            }
+
+            msg := wsClientMessage{}
+            if err := json.Unmarshal(data, &msg); err != nil {
+                msg = wsClientMessage{Type: "invalid"}
+            }
+            select {
+            case incoming <- msg:
+            case <-done:
+                return
+            }
+        }
+    }()
+
+    // a client that doesn't answer pings is dropped, which ends the reader
+    go func() {
+        ping := time.NewTicker(wsPingPeriod)
+        defer ping.Stop()
+        for {
+            select {
+            case <-ping.C:
+                ctx, cancel := context.WithTimeout(r.Context(), wsPongWait)
+                err := conn.Ping(ctx)
+                cancel()
+                if err != nil {
+                    conn.CloseNow()
+                    return
+                }
+            case <-done:
+                return
+            }
+        }
+    }()
+
+    expiry := time.NewTimer(time.Until(expiresAt))
+    defer expiry.Stop()
+    recheck := time.NewTicker(wsPingPeriod)
+    defer recheck.Stop()
+
+    // chirps of muted and blocked users are skipped,
+    // refreshed with every recheck so new blocks apply without reconnecting
+    hidden, err := cfg.hiddenUsers(r.Context(), userID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "Error getting hidden users for websocket", "err", err)
+    }
+
+    for {
+        select {
+        case ev := <-sub.C:
+            if chirp, ok := ev.Data.(chirpRes); ok && wsHidden(chirp, hidden) {
+                continue
+            }
+            if err := wsSend(r.Context(), conn, ev); err != nil {
+                slog.ErrorContext(r.Context(), "Error writing websocket event", "err", err)
+                return
+            }
+
+        case <-sub.Overflow():
+            // the client is not reading fast enough
+            slog.WarnContext(r.Context(), "Closing slow websocket consumer", "user_id", userID)
+            conn.Close(websocket.StatusTryAgainLater, "slow consumer")
+            return
+
+        case <-expiry.C:
+            wsSend(r.Context(), conn, wsServerMessage{Type: "auth.expired"})
+            conn.Close(wsCloseTokenExpired, "token expired")
+            return
+
+        case <-recheck.C:
+            if h, err := cfg.hiddenUsers(r.Context(), userID); err == nil {
+                hidden = h
+            }
+            // deleted, suspended or made to reset the password
+            // since the connection was authenticated
+            _, err := cfg.activeAccount(r.Context(), userID)
+            var suspended *suspendedError
+            if errors.Is(err, sql.ErrNoRows) || errors.As(err, &suspended) || errors.Is(err, errPasswordResetRequired) {
+                slog.InfoContext(r.Context(), "Closing websocket of a locked out user", "user_id", userID)
+                conn.Close(wsCloseUnauthorized, "unauthorized")
+                return
+            }
+
+        case err := <-readErr:
+            if websocket.CloseStatus(err) == -1 {
+                slog.ErrorContext(r.Context(), "Error reading websocket message", "err", err)
+            }
+            return
+
+        case msg := <-incoming:
+            var reply wsServerMessage
+            switch msg.Type {
+            case "auth":
+                // token renewal, must belong to the same user
+                newID, newExp, err := cfg.wsValidateToken(r.Context(), msg.Token)
+                if err != nil || newID != userID {
+                    reply = wsServerMessage{Type: "error", Error: "invalid token"}
+                    break
+                }
+                expiry.Reset(time.Until(newExp))
+                reply = wsServerMessage{Type: "auth.ok", ExpiresAt: newExp.UTC().Format(time.RFC3339)}
+
+            case "subscribe":
+                channel, ok := wsResolveChannel(msg.Channel, userID)
+                if !ok {
+                    reply = wsServerMessage{Type: "error", Channel: msg.Channel, Error: "unknown channel"}
+                    break
+                }
+                if !subscribed[channel] && len(subscribed) >= wsMaxSubscriptions {
+                    reply = wsServerMessage{Type: "error", Channel: msg.Channel, Error: "too many subscriptions"}
+                    break
+                }
+                subscribed[channel] = true
+                cfg.events.Subscribe(channel, sub)
+                reply = wsServerMessage{Type: "subscribed", Channel: msg.Channel}
+
+            case "unsubscribe":
+                channel, ok := wsResolveChannel(msg.Channel, userID)
+                if !ok {
+                    reply = wsServerMessage{Type: "error", Channel: msg.Channel, Error: "unknown channel"}
+                    break
+                }
+                delete(subscribed, channel)
+                cfg.events.Unsubscribe(channel, sub)
+                reply = wsServerMessage{Type: "unsubscribed", Channel: msg.Channel}
+
+            case "ping":
+                reply = wsServerMessage{Type: "pong"}
+
+            default:
+                reply = wsServerMessage{Type: "error", Error: "unknown message type"}
+            }
+
+            if err := wsSend(r.Context(), conn, reply); err != nil {
+                return
+            }
+        }
+    }
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/elfabri/bdd-Chirpy-project/internal/database"
+	"github.com/elfabri/bdd-Chirpy-project/internal/events"
+	"github.com/google/uuid"
+)
+
+type wsTestClient struct {
+    t    *testing.T
+    conn *websocket.Conn
+}
+
+func wsDial(t *testing.T, cfg *apiConfig) *wsTestClient {
+    t.Helper()
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /api/ws", cfg.ws_connect)
+    server := httptest.NewServer(mux)
+    t.Cleanup(server.Close)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+    if err != nil {
+        t.Fatalf("Couldn't dial: %v", err)
+    }
+    t.Cleanup(func() { conn.CloseNow() })
+    return &wsTestClient{t: t, conn: conn}
+}
+
+func (c *wsTestClient) send(v any) {
+    c.t.Helper()
+    payload, _ := json.Marshal(v)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := c.conn.Write(ctx, websocket.MessageText, payload); err != nil {
+        c.t.Fatalf("Couldn't send: %v", err)
+    }
+}
+
+// the next message, pings are answered by the library
+func (c *wsTestClient) read() (websocket.MessageType, []byte, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    return c.conn.Read(ctx)
+}
+
+func (c *wsTestClient) readMessage() map[string]any {
+    c.t.Helper()
+    typ, payload, err := c.read()
+    if err != nil {
+        c.t.Fatalf("Couldn't read message: %v", err)
+    }
+    if typ != websocket.MessageText {
+        c.t.Fatalf("Got message type %v, want a text message: %q", typ, payload)
+    }
+    msg := map[string]any{}
+    if err := json.Unmarshal(payload, &msg); err != nil {
+        c.t.Fatalf("Couldn't decode %q: %v", payload, err)
+    }
+    return msg
+}
+
+func (c *wsTestClient) expectClose(code websocket.StatusCode) {
+    c.t.Helper()
+    _, payload, err := c.read()
+    if status := websocket.CloseStatus(err); status != code {
+        c.t.Fatalf("Got %q %v, want close %d", payload, err, code)
+    }
+}
+
+func TestWebsocketAuth(t *testing.T) {
+    validToken := func(id uuid.UUID) any {
+        return wsClientMessage{Type: "auth", Token: testToken(t, id, time.Hour)}
+    }
+    tests := []struct {
+        name  string
+        first func(userID uuid.UUID) any
+        // applied to the user before connecting
+        account func(user *database.User)
+    }{
+        {name: "not auth", first: func(uuid.UUID) any { return wsClientMessage{Type: "subscribe", Channel: "global"} }},
+        {name: "expired token", first: func(id uuid.UUID) any {
+            return wsClientMessage{Type: "auth", Token: testToken(t, id, -time.Minute)}
+        }},
+        {name: "malformed token", first: func(uuid.UUID) any { return wsClientMessage{Type: "auth", Token: "not.a.jwt"} }},
+        {name: "deleted user", first: validToken, account: func(user *database.User) {
+            user.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+        }},
+        {name: "suspended user", first: validToken, account: func(user *database.User) {
+            user.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+        }},
+        {name: "password reset", first: validToken, account: func(user *database.User) {
+            user.PasswordResetHash = hashResetToken("reset-token")
+            user.PasswordResetExpiresAt = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, fake := newTestConfig(t)
+            user := testUser(fake, "user")
+            if tt.account != nil {
+                tt.account(&user)
+                fake.addUser(user)
+            }
+            client := wsDial(t, cfg)
+            client.send(tt.first(user.ID))
+
+            if msg := client.readMessage(); msg["type"] != "error" {
+                t.Errorf("Got %v, want an error", msg)
+            }
+            client.expectClose(wsCloseUnauthorized)
+        })
+    }
+}
+
+// a token renewal is refused once the account is suspended
+func TestWebsocketRenewalOfSuspendedUser(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+
+    client := wsDial(t, cfg)
+    client.send(wsClientMessage{Type: "auth", Token: testToken(t, user.ID, time.Hour)})
+    if msg := client.readMessage(); msg["type"] != "auth.ok" {
+        t.Fatalf("Got %v, want auth.ok", msg)
+    }
+
+    user.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+    fake.addUser(user)
+    client.send(wsClientMessage{Type: "auth", Token: testToken(t, user.ID, 2*time.Hour)})
+    if msg := client.readMessage(); msg["type"] != "error" {
+        t.Errorf("Renewal of a suspended user got %v", msg)
+    }
+}
+
+func TestWebsocketTimeline(t *testing.T) {
+    cfg, fake := newTestConfig(t)
+    user := testUser(fake, "user")
+    blocked := testUser(fake, "user")
+    muted := testUser(fake, "user")
+    other := testUser(fake, "user")
+    fake.answer("GetHiddenUsers", []database.HiddenUser{
+        {ViewerID: user.ID, UserID: blocked.ID, Blocked: true},
+        {ViewerID: user.ID, UserID: muted.ID},
+    })
+
+    client := wsDial(t, cfg)
+    client.send(wsClientMessage{Type: "auth", Token: testToken(t, user.ID, time.Hour)})
+    if msg := client.readMessage(); msg["type"] != "auth.ok" {
+        t.Fatalf("Got %v, want auth.ok", msg)
+    }
+
+    // another user's token can't take over the connection
+    client.send(wsClientMessage{Type: "auth", Token: testToken(t, other.ID, time.Hour)})
+    if msg := client.readMessage(); msg["type"] != "error" {
+        t.Errorf("Renewal with another user's token got %v", msg)
+    }
+    client.send(wsClientMessage{Type: "subscribe", Channel: "author:nope"})
+    if msg := client.readMessage(); msg["type"] != "error" || msg["channel"] != "author:nope" {
+        t.Errorf("Subscribing to a bad channel got %v", msg)
+    }
+
+    client.send(wsClientMessage{Type: "subscribe", Channel: events.GlobalChannel})
+    if msg := client.readMessage(); msg["type"] != "subscribed" {
+        t.Fatalf("Got %v, want subscribed", msg)
+    }
+
+    cfg.publishChirpEvent(events.ChirpCreated, chirpRes{ID: uuid.New(), UserID: blocked.ID, Body: "blocked"})
+    cfg.publishChirpEvent(events.ChirpCreated, chirpRes{ID: uuid.New(), UserID: muted.ID, Body: "muted"})
+    // quoting a blocked user is hidden too
+    cfg.publishChirpEvent(events.ChirpCreated, chirpRes{ID: uuid.New(), UserID: other.ID, Body: "quote",
+        Quoted: &chirpRes{ID: uuid.New(), UserID: blocked.ID}})
+    cfg.publishChirpEvent(events.ChirpCreated, chirpRes{ID: uuid.New(), UserID: other.ID, Body: "visible"})
+
+    msg := client.readMessage()
+    data, _ := msg["data"].(map[string]any)
+    if msg["type"] != events.ChirpCreated || data["Body"] != "visible" {
+        t.Errorf("Got %v, want only the visible chirp", msg)
+    }
+}